@@ -0,0 +1,43 @@
+package accrualrest
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/api"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+)
+
+type accrualAPIServer struct {
+	service api.CalculatorService
+	cfg     *config.AccrualConfig
+	limiter *clientLimiter
+	logger  *zap.SugaredLogger
+}
+
+func NewAccrualAPIServer(service api.CalculatorService, cfg *config.AccrualConfig, logger *zap.SugaredLogger) api.Server {
+	s := &accrualAPIServer{
+		service: service,
+		cfg:     cfg,
+		logger:  logger,
+	}
+	if cfg.RateLimit > 0 {
+		s.limiter = newClientLimiter(cfg.RateLimit)
+	}
+	return s
+}
+
+func (s *accrualAPIServer) RunServer(ctx context.Context) error {
+	router := gin.Default()
+	// requests are limited per client IP, so X-Forwarded-For is not trusted
+	if err := router.SetTrustedProxies(nil); err != nil {
+		return err
+	}
+	apiSubRouter := router.Group("/api")
+	apiSubRouter.POST("/goods", s.RegisterRewardRuleHandler(ctx))
+	apiSubRouter.POST("/orders", s.RegisterOrderHandler(ctx))
+	apiSubRouter.GET("/orders/:order", s.RateLimit(), s.GetOrderHandler(ctx))
+	return router.Run(s.cfg.RunAddress)
+}
@@ -0,0 +1,92 @@
+package accrualrest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+var validate = validator.New(validator.WithRequiredStructEnabled())
+
+func (s *accrualAPIServer) RegisterRewardRuleHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var rule model.RewardRule
+		if err := c.BindJSON(&rule); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(rule); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := s.service.RegisterRewardRule(ctx, rule); err != nil {
+			if errors.Is(err, apperrors.ErrRewardRuleAlreadyExists) {
+				s.logger.Error("RegisterRewardRule: ", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("RegisterRewardRule: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *accrualAPIServer) RegisterOrderHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var order model.AccrualOrder
+		if err := c.BindJSON(&order); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(order); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := s.service.RegisterOrder(ctx, order); err != nil {
+			if errors.Is(err, apperrors.ErrOrderAlreadyRegistered) {
+				s.logger.Error("RegisterOrder: ", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("RegisterOrder: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusAccepted)
+	}
+}
+
+func (s *accrualAPIServer) GetOrderHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var req model.AccrualResponse
+		if err := c.ShouldBindUri(&req); err != nil {
+			s.logger.Error("ShouldBindUri", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		resp, err := s.service.GetOrderAccrual(ctx, req.Order)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			s.logger.Error("GetOrderAccrual: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
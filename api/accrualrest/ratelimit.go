@@ -0,0 +1,82 @@
+package accrualrest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const rateLimitWindow = time.Minute
+
+// clientLimiter counts the requests of every client in fixed one-minute windows.
+type clientLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	windows map[string]clientWindow
+	sweptAt time.Time
+}
+
+type clientWindow struct {
+	startedAt time.Time
+	requests  int
+}
+
+func newClientLimiter(requestsPerMinute int) *clientLimiter {
+	return &clientLimiter{
+		limit:   requestsPerMinute,
+		windows: make(map[string]clientWindow),
+	}
+}
+
+// reserve counts a request of client and returns zero, or returns how long the client has to wait
+// for its next window if it has used up the current one.
+func (l *clientLimiter) reserve(client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	window, ok := l.windows[client]
+	if !ok || now.Sub(window.startedAt) >= rateLimitWindow {
+		window = clientWindow{startedAt: now}
+	}
+	if window.requests >= l.limit {
+		return window.startedAt.Add(rateLimitWindow).Sub(now)
+	}
+	window.requests++
+	l.windows[client] = window
+	return 0
+}
+
+// sweep forgets the clients whose window is over, at most once per window.
+func (l *clientLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < rateLimitWindow {
+		return
+	}
+	for client, window := range l.windows {
+		if now.Sub(window.startedAt) >= rateLimitWindow {
+			delete(l.windows, client)
+		}
+	}
+	l.sweptAt = now
+}
+
+// RateLimit answers 429 with Retry-After once a client has sent cfg.RateLimit requests within a minute,
+// in the format of the accrual system spec. A zero limit lets every request through.
+func (s *accrualAPIServer) RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.limiter == nil {
+			return
+		}
+		wait := s.limiter.reserve(c.ClientIP(), time.Now())
+		if wait <= 0 {
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.String(http.StatusTooManyRequests, fmt.Sprintf("No more than %d requests per minute allowed", s.limiter.limit))
+		c.Abort()
+	}
+}
@@ -0,0 +1,63 @@
+package accrualrest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/api"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+type stubCalculator struct {
+	api.CalculatorService
+}
+
+func (stubCalculator) GetOrderAccrual(_ context.Context, orderNumber string) (model.AccrualResponse, error) {
+	return model.AccrualResponse{Order: orderNumber, Status: model.AccrualStateRegistered}, nil
+}
+
+func Test_accrualAPIServer_RateLimit(t *testing.T) {
+	ctx := context.Background()
+	s := NewAccrualAPIServer(stubCalculator{}, &config.AccrualConfig{RateLimit: 2}, zap.NewNop().Sugar()).(*accrualAPIServer)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/orders/:order", s.RateLimit(), s.GetOrderHandler(ctx))
+	send := func(clientAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/orders/12345678903", nil)
+		req.RemoteAddr = clientAddr
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1001").Code)
+	w := send("10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, "No more than 2 requests per minute allowed", w.Body.String())
+
+	// other clients have their own quota
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000").Code)
+}
+
+func Test_clientLimiter_reserve(t *testing.T) {
+	now := time.Now()
+	l := newClientLimiter(1)
+
+	assert.Equal(t, time.Duration(0), l.reserve("a", now))
+	assert.Equal(t, 45*time.Second, l.reserve("a", now.Add(15*time.Second)))
+	assert.Equal(t, time.Duration(0), l.reserve("a", now.Add(time.Minute)))
+
+	// windows of idle clients are swept
+	assert.Equal(t, time.Duration(0), l.reserve("b", now.Add(3*time.Minute)))
+	assert.Len(t, l.windows, 1)
+}
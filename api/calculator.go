@@ -0,0 +1,14 @@
+package api
+
+import (
+	"context"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+type CalculatorService interface {
+	RegisterRewardRule(ctx context.Context, rule model.RewardRule) error
+	RegisterOrder(ctx context.Context, order model.AccrualOrder) error
+	GetOrderAccrual(ctx context.Context, orderNumber string) (model.AccrualResponse, error)
+	ProcessRegisteredOrders(ctx context.Context) error
+}
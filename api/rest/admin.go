@@ -0,0 +1,495 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// RequireRole lets through users with one of the roles; it goes after Auth.
+func (s *restAPIServer) RequireRole(roles ...model.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := getRoleFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getRoleFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				return
+			}
+		}
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
+
+// FindUserHandler looks a user up by the login query parameter.
+func (s *restAPIServer) FindUserHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		login := c.Query("login")
+		if login == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		user, err := s.service.FindUserByLogin(ctx, login)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("FindUserByLogin: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, user)
+	}
+}
+
+func (s *restAPIServer) GetUserHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		user, err := s.service.GetUserInfo(ctx, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("GetUserInfo: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, user)
+	}
+}
+
+func (s *restAPIServer) GetUserOrdersHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		orders, err := s.service.GetUserOrders(ctx, userID)
+		if err != nil {
+			s.logger.Error("GetUserOrders: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(orders) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, orders)
+	}
+}
+
+func (s *restAPIServer) GetUserWithdrawalsHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		withdrawals, err := s.service.ListUserWithdrawals(ctx, userID)
+		if err != nil {
+			s.logger.Error("ListUserWithdrawals: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(withdrawals) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, withdrawals)
+	}
+}
+
+func (s *restAPIServer) GetUserBalanceHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		balance, err := s.service.GetBalance(ctx, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("GetBalance: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, balance)
+	}
+}
+
+func (s *restAPIServer) SetUserRoleHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		var request model.SetRoleRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.SetUserRole(ctx, actorID, userID, request.Role); err != nil {
+			if errors.Is(err, apperrors.ErrInvalidRole) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, apperrors.ErrOwnRole) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("SetUserRole: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) UnlockHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.UnlockRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.Unlock(ctx, actorID, request); err != nil {
+			s.logger.Error("Unlock: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) AdjustBalanceHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		operatorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		var request model.BalanceAdjustmentRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		adjustment, err := s.service.AdjustBalance(ctx, operatorID, userID, request.Amount, request.Reason)
+		if err != nil {
+			if errors.Is(err, apperrors.ErrInvalidAmount) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, apperrors.ErrOwnBalance) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, apperrors.ErrNotEnoughFunds) {
+				c.AbortWithStatus(http.StatusPaymentRequired)
+				return
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("AdjustBalance: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, adjustment)
+	}
+}
+
+func (s *restAPIServer) ListBalanceAdjustmentsHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		adjustments, err := s.service.ListBalanceAdjustments(ctx, userID)
+		if err != nil {
+			s.logger.Error("ListBalanceAdjustments: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(adjustments) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, adjustments)
+	}
+}
+
+func (s *restAPIServer) ReverseWithdrawalHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		orderNumber := c.Param("order")
+		if err := validate.Var(orderNumber, "required,luhn_checksum"); err != nil {
+			s.logger.Error("validate OrderNumber: ", err)
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+
+		withdrawal, err := s.service.ReverseWithdrawal(ctx, actorID, orderNumber)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, apperrors.ErrWithdrawalAlreadyReversed) {
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("ReverseWithdrawal: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, withdrawal)
+	}
+}
+
+func (s *restAPIServer) ClawbackOrderHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		orderNumber := c.Param("order")
+		if err := validate.Var(orderNumber, "required,luhn_checksum"); err != nil {
+			s.logger.Error("validate OrderNumber: ", err)
+			c.AbortWithStatus(http.StatusUnprocessableEntity)
+			return
+		}
+
+		order, err := s.service.ClawbackOrder(ctx, actorID, orderNumber)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, apperrors.ErrOrderAlreadyReversed) || errors.Is(err, apperrors.ErrOrderNotProcessed) {
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			if errors.Is(err, apperrors.ErrNotEnoughFunds) {
+				c.AbortWithStatus(http.StatusPaymentRequired)
+				return
+			}
+			s.logger.Error("ClawbackOrder: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, order)
+	}
+}
+
+func (s *restAPIServer) CreateCampaignHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.CampaignRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := s.service.CreateCampaign(ctx, actorID, request)
+		if err != nil {
+			if errors.Is(err, apperrors.ErrInvalidCampaign) {
+				s.logger.Info("CreateCampaign: ", err)
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			s.logger.Error("CreateCampaign: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, campaign)
+	}
+}
+
+func (s *restAPIServer) ListCampaignsHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		campaigns, err := s.service.GetCampaigns(ctx)
+		if err != nil {
+			s.logger.Error("GetCampaigns: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(campaigns) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, campaigns)
+	}
+}
+
+func (s *restAPIServer) GetCampaignHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		id, err := getCampaignIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getCampaignIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		campaign, err := s.service.GetCampaign(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("GetCampaign: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, campaign)
+	}
+}
+
+func (s *restAPIServer) EndCampaignHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actorID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		id, err := getCampaignIDFromPath(c)
+		if err != nil {
+			s.logger.Errorf("getCampaignIDFromPath: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		campaign, err := s.service.EndCampaign(ctx, actorID, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			s.logger.Error("EndCampaign: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, campaign)
+	}
+}
+
+func getUserIDFromPath(c *gin.Context) (uint, error) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+func getCampaignIDFromPath(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// getRoleFromContext treats tokens issued before roles were introduced as RoleUser.
+func getRoleFromContext(c *gin.Context) (model.Role, error) {
+	role, exist := c.Get("role")
+	if !exist {
+		return "", errors.New("no role")
+	}
+	roleValue, ok := role.(model.Role)
+	if !ok {
+		return "", errors.New("error casting role")
+	}
+	if roleValue == "" {
+		return model.RoleUser, nil
+	}
+	return roleValue, nil
+}
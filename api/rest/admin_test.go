@@ -0,0 +1,44 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_restAPIServer_RequireRole(t *testing.T) {
+	s := &restAPIServer{logger: zap.NewNop().Sugar()}
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		role any
+		want int
+	}{
+		{"admin", model.RoleAdmin, http.StatusOK},
+		{"support", model.RoleSupport, http.StatusOK},
+		{"user", model.RoleUser, http.StatusForbidden},
+		{"token without role", model.Role(""), http.StatusForbidden},
+		{"no role", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.role != nil {
+					c.Set("role", tt.role)
+				}
+			}, s.RequireRole(model.RoleSupport, model.RoleAdmin), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
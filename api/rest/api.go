@@ -7,34 +7,81 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/mrkovshik/yandex_diploma/api"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
 	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
 	"github.com/mrkovshik/yandex_diploma/internal/service"
 )
 
 type restAPIServer struct {
 	service api.Service
 	storage service.Storage
+	auth    *auth.Service
 	cfg     *config.Config
 	logger  *zap.SugaredLogger
 }
 
-func NewRestAPIServer(service api.Service, storage service.Storage, cfg *config.Config, logger *zap.SugaredLogger) api.Server {
+func NewRestAPIServer(service api.Service, storage service.Storage, authSrv *auth.Service, cfg *config.Config, logger *zap.SugaredLogger) api.Server {
 	return &restAPIServer{
 		service: service,
 		storage: storage,
+		auth:    authSrv,
 		cfg:     cfg,
 		logger:  logger,
 	}
 }
 func (s *restAPIServer) RunServer(ctx context.Context) error {
+	go s.cleanupIdempotencyKeys(ctx)
 	router := gin.Default()
+	// the client IP throttles logins, so X-Forwarded-For is only taken from known proxies
+	if err := router.SetTrustedProxies(s.cfg.TrustedProxies); err != nil {
+		return err
+	}
+	router.GET("/.well-known/jwks.json", s.JWKSHandler())
 	userSubRouter := router.Group("/api/user")
 	userSubRouter.POST("/register", s.RegisterHandler(ctx))
 	userSubRouter.POST("/login", s.LoginHandler(ctx))
-	userSubRouter.POST("/orders", s.Auth(ctx), s.UploadOrderHandler(ctx))
+	userSubRouter.POST("/login/2fa", s.LoginTwoFactorHandler(ctx))
+	userSubRouter.POST("/token/refresh", s.RefreshTokenHandler(ctx))
+	userSubRouter.POST("/logout", s.Auth(ctx), s.LogoutHandler(ctx))
+	userSubRouter.POST("/logout/all", s.Auth(ctx), s.LogoutAllHandler(ctx))
+	userSubRouter.POST("/password", s.Auth(ctx), s.ChangePasswordHandler(ctx))
+	userSubRouter.POST("/password/reset/request", s.RequestPasswordResetHandler(ctx))
+	userSubRouter.POST("/password/reset", s.ResetPasswordHandler(ctx))
+	userSubRouter.POST("/2fa/setup", s.Auth(ctx), s.SetupTOTPHandler(ctx))
+	userSubRouter.POST("/2fa/confirm", s.Auth(ctx), s.ConfirmTOTPHandler(ctx))
+	userSubRouter.POST("/2fa/disable", s.Auth(ctx), s.DisableTOTPHandler(ctx))
+	userSubRouter.POST("/orders", s.Auth(ctx), s.Idempotency(ctx), s.UploadOrderHandler(ctx))
 	userSubRouter.GET("/orders", s.Auth(ctx), s.GetOrders(ctx))
-	userSubRouter.POST("/balance/withdraw", s.Auth(ctx), s.Withdraw(ctx))
+	userSubRouter.POST("/balance/withdraw", s.Auth(ctx), s.Idempotency(ctx), s.Withdraw(ctx))
 	userSubRouter.GET("/balance", s.Auth(ctx), s.GetBalance(ctx))
 	userSubRouter.GET("/withdrawals", s.Auth(ctx), s.ListWithdrawals(ctx))
+	userSubRouter.POST("/balance/transfer", s.Auth(ctx), s.Idempotency(ctx), s.TransferHandler(ctx))
+	userSubRouter.GET("/transfers", s.Auth(ctx), s.ListTransfersHandler(ctx))
+	userSubRouter.POST("/transfers/:id/accept", s.Auth(ctx), s.Idempotency(ctx), s.SettleTransferHandler(ctx, model.TransferStatusCompleted))
+	userSubRouter.POST("/transfers/:id/decline", s.Auth(ctx), s.Idempotency(ctx), s.SettleTransferHandler(ctx, model.TransferStatusDeclined))
+	userSubRouter.POST("/transfers/:id/cancel", s.Auth(ctx), s.Idempotency(ctx), s.SettleTransferHandler(ctx, model.TransferStatusCancelled))
+	userSubRouter.GET("/transactions", s.Auth(ctx), s.ListTransactionsHandler(ctx))
+	userSubRouter.GET("/profile", s.Auth(ctx), s.GetProfileHandler(ctx))
+	userSubRouter.GET("/referrals", s.Auth(ctx), s.GetReferralsHandler(ctx))
+	adminSubRouter := router.Group("/api/admin", s.Auth(ctx))
+	staff := s.RequireRole(model.RoleSupport, model.RoleAdmin)
+	adminSubRouter.GET("/users", staff, s.FindUserHandler(ctx))
+	adminSubRouter.GET("/users/:id", staff, s.GetUserHandler(ctx))
+	adminSubRouter.GET("/users/:id/orders", staff, s.GetUserOrdersHandler(ctx))
+	adminSubRouter.GET("/users/:id/withdrawals", staff, s.GetUserWithdrawalsHandler(ctx))
+	adminSubRouter.GET("/users/:id/balance", staff, s.GetUserBalanceHandler(ctx))
+	adminSubRouter.POST("/users/:id/adjustments", staff, s.Idempotency(ctx), s.AdjustBalanceHandler(ctx))
+	adminSubRouter.GET("/users/:id/adjustments", staff, s.ListBalanceAdjustmentsHandler(ctx))
+	adminSubRouter.POST("/unlock", staff, s.UnlockHandler(ctx))
+	adminSubRouter.PUT("/users/:id/role", s.RequireRole(model.RoleAdmin), s.SetUserRoleHandler(ctx))
+	adminSubRouter.POST("/withdrawals/:order/reversal", s.RequireRole(model.RoleSupport, model.RoleAdmin, model.RoleShop),
+		s.Idempotency(ctx), s.ReverseWithdrawalHandler(ctx))
+	adminSubRouter.POST("/orders/:order/clawback", s.RequireRole(model.RoleSupport, model.RoleAdmin, model.RoleShop),
+		s.Idempotency(ctx), s.ClawbackOrderHandler(ctx))
+	adminSubRouter.POST("/campaigns", s.RequireRole(model.RoleAdmin), s.Idempotency(ctx), s.CreateCampaignHandler(ctx))
+	adminSubRouter.GET("/campaigns", staff, s.ListCampaignsHandler(ctx))
+	adminSubRouter.GET("/campaigns/:id", staff, s.GetCampaignHandler(ctx))
+	adminSubRouter.POST("/campaigns/:id/end", s.RequireRole(model.RoleAdmin), s.Idempotency(ctx), s.EndCampaignHandler(ctx))
 	return router.Run(s.cfg.RunAddress)
 }
@@ -16,10 +16,12 @@ import (
 	"go.uber.org/zap/zapcore"
 
 	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
 	"github.com/mrkovshik/yandex_diploma/internal/config"
 	"github.com/mrkovshik/yandex_diploma/internal/model"
 	"github.com/mrkovshik/yandex_diploma/internal/service/accrual"
 	"github.com/mrkovshik/yandex_diploma/internal/service/loyalty"
+	"github.com/mrkovshik/yandex_diploma/internal/service/notify"
 	mock_service "github.com/mrkovshik/yandex_diploma/mocks"
 	accrualMock "github.com/mrkovshik/yandex_diploma/mocks/accrual"
 )
@@ -34,8 +36,8 @@ const (
 	userHashedPass1    = "$2a$10$XVc79vBoRda4wdsx/uqMd.obXNtIbOvGttqUsgfBC4YfvuoD0fvrG"
 	UserID1            = uint(123)
 	UserID2            = uint(1232)
-	withdrawalSumUser1 = 555.55
-	balanceUser1       = float64(1000)
+	withdrawalSumUser1 = model.Amount(55555)
+	balanceUser1       = model.Amount(100000)
 )
 
 type GetOrderResp struct {
@@ -50,7 +52,7 @@ type GetOrderResp struct {
 var (
 	withdrawalUser1 = model.Withdrawal{
 		ID:          324324,
-		Amount:      300,
+		Amount:      30000,
 		ProcessedAt: time.Now(),
 		OrderNumber: fmt.Sprint(orderExistingUser1),
 		UserID:      UserID1,
@@ -58,7 +60,7 @@ var (
 	withdrawalUser1a = model.Withdrawal{
 
 		ID:          3433,
-		Amount:      500,
+		Amount:      50000,
 		ProcessedAt: time.Now(),
 		OrderNumber: fmt.Sprint(orderExistingUser1),
 		UserID:      UserID1,
@@ -106,9 +108,14 @@ func Test_restAPIServer_RunServer(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockStorage := defineStorage(ctx, ctrl)
-	accrualService := accrual.NewAccrualService(cfg.AccrualSystemAddress)
-	service := loyalty.NewBasicService(mockStorage, accrualService, cfg, sugar)
-	srv := NewRestAPIServer(service, mockStorage, cfg, sugar)
+	keys, err := auth.NewKeySet(auth.NewHMACKey([]byte("secret")))
+	if err != nil {
+		sugar.Fatal("auth.NewKeySet", err)
+	}
+	authService := auth.NewAuthService(keys, cfg.AccessTokenTTL)
+	accrualService := accrual.NewAccrualService(cfg.AccrualSystemAddress, cfg.AccrualRateLimit)
+	service := loyalty.NewBasicService(mockStorage, accrualService, authService, notify.NewLogNotifier(sugar), cfg, sugar)
+	srv := NewRestAPIServer(service, mockStorage, authService, cfg, sugar)
 	go func() {
 		if err := srv.RunServer(ctx); err != nil {
 			return
@@ -269,6 +276,50 @@ func Test_restAPIServer_RunServer(t *testing.T) {
 
 	})
 
+	t.Run("refresh_token", func(t *testing.T) {
+		url := fmt.Sprintf("http://%v/api/user/token/refresh", cfg.RunAddress)
+		client := resty.New()
+
+		// Malformed token
+		resp, err := client.R().SetHeader("Content-Type", "application/json").
+			SetBody(`{"refresh_token":"malformed"}`).
+			Post(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+		// No token
+		resp, err = client.R().SetHeader("Content-Type", "application/json").
+			SetBody(`{}`).
+			Post(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	})
+
+	t.Run("jwks", func(t *testing.T) {
+		client := resty.New()
+
+		// HMAC secrets are not published
+		resp, err := client.R().Get(fmt.Sprintf("http://%v/.well-known/jwks.json", cfg.RunAddress))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+		assert.JSONEq(t, `{"keys":[]}`, string(resp.Body()))
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		url := fmt.Sprintf("http://%v/api/user/logout", cfg.RunAddress)
+		client := resty.New()
+
+		//Normal flow
+		resp, err := client.R().SetHeader("Authorization", authToken).Post(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+		//Not authorized
+		resp, err = client.R().Post(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+	})
+
 }
 
 func defineStorage(ctx context.Context, ctrl *gomock.Controller) *mock_service.MockStorage {
@@ -289,6 +340,19 @@ func defineStorage(ctx context.Context, ctrl *gomock.Controller) *mock_service.M
 		CreatedAt: time.Now(),
 	}, nil).AnyTimes()
 
+	storage.EXPECT().CreateSession(ctx, gomock.Any()).Return(nil).AnyTimes()
+	storage.EXPECT().GetSession(ctx, gomock.Any()).Return(model.Session{
+		UserID:    UserID1,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil).AnyTimes()
+	storage.EXPECT().RevokeSession(ctx, gomock.Any()).Return(nil).AnyTimes()
+
+	storage.EXPECT().GetLoginBlockedUntil(ctx, gomock.Any()).Return(time.Time{}, nil).AnyTimes()
+	storage.EXPECT().RecordLoginFailure(ctx, gomock.Any(), gomock.Any()).Return(1, time.Time{}, nil).AnyTimes()
+	storage.EXPECT().ForgetLoginFailure(ctx, gomock.Any()).Return(nil).AnyTimes()
+	storage.EXPECT().ResetLoginAttempts(ctx, model.LoginThrottleKey(UserLogin1)).Return(nil).AnyTimes()
+	storage.EXPECT().GetTOTP(ctx, gomock.Any()).Return(model.TOTP{}, sql.ErrNoRows).AnyTimes()
+
 	storage.EXPECT().AddUser(ctx, UserLoginNotExist, gomock.Any()).Return(UserID1, nil).AnyTimes()
 	storage.EXPECT().AddUser(ctx, UserLogin1, gomock.Any()).Return(uint(0), apperrors.ErrUserAlreadyExists).AnyTimes()
 
@@ -299,7 +363,7 @@ func defineStorage(ctx context.Context, ctrl *gomock.Controller) *mock_service.M
 		UserID:      UserID1,
 		Status:      model.OrderStateProcessed,
 		UploadedAt:  time.Now(),
-		Accrual:     1000,
+		Accrual:     100000,
 	}, nil).AnyTimes()
 	storage.EXPECT().GetOrderByNumber(ctx, orderExistingUser2).Return(model.Order{
 		ID:          878,
@@ -307,7 +371,7 @@ func defineStorage(ctx context.Context, ctrl *gomock.Controller) *mock_service.M
 		UserID:      UserID2,
 		Status:      model.OrderStateProcessed,
 		UploadedAt:  time.Now(),
-		Accrual:     1000,
+		Accrual:     100000,
 	}, nil).AnyTimes()
 	gomock.InOrder(
 
@@ -332,7 +396,7 @@ func defineStorage(ctx context.Context, ctrl *gomock.Controller) *mock_service.M
 				UserID:      UserID2,
 				Status:      model.OrderStateProcessed,
 				UploadedAt:  time.Now(),
-				Accrual:     1000,
+				Accrual:     100000,
 			},
 		}, nil),
 		storage.EXPECT().GetOrdersByUserID(ctx, UserID1).Return([]model.Order{}, nil).AnyTimes(),
@@ -5,7 +5,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -14,24 +18,42 @@ import (
 	"github.com/mrkovshik/yandex_diploma/internal/model"
 )
 
+// totpCodeHeader carries the TOTP code confirming a withdrawal, see config.WithdrawRequireTOTP.
+const totpCodeHeader = "X-TOTP-Code"
+
 var validate = validator.New(validator.WithRequiredStructEnabled())
 
+// abortIfBlocked responds 429 with Retry-After if err is a *apperrors.RetryAfterError.
+func abortIfBlocked(c *gin.Context, err error) bool {
+	var blocked *apperrors.RetryAfterError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+	c.AbortWithStatus(http.StatusTooManyRequests)
+	return true
+}
+
 func (s *restAPIServer) RegisterHandler(ctx context.Context) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		var user model.User
-		if err := c.BindJSON(&user); err != nil {
+		var request model.RegisterRequest
+		if err := c.BindJSON(&request); err != nil {
 			s.logger.Error("BindJSON", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := validate.Struct(user); err != nil {
+		if err := validate.Struct(request); err != nil {
 			s.logger.Error("validate.Struct", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
 
-		token, err := s.service.Register(ctx, user.Login, user.Password)
+		tokens, err := s.service.Register(ctx, request.Login, request.Password, request.ReferralCode)
 		if err != nil {
+			if errors.Is(err, apperrors.ErrInvalidReferralCode) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
 			if errors.Is(err, apperrors.ErrUserAlreadyExists) {
 				s.logger.Error("Register: ", err)
 				c.AbortWithStatus(http.StatusConflict)
@@ -42,8 +64,8 @@ func (s *restAPIServer) RegisterHandler(ctx context.Context) func(c *gin.Context
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		c.Header("Authorization", token)
-		c.AbortWithStatus(http.StatusOK)
+		c.Header("Authorization", tokens.AccessToken)
+		c.JSON(http.StatusOK, tokens)
 	}
 }
 
@@ -62,8 +84,12 @@ func (s *restAPIServer) LoginHandler(ctx context.Context) func(c *gin.Context) {
 			return
 		}
 
-		token, err := s.service.Login(ctx, user.Login, user.Password)
+		tokens, err := s.service.Login(ctx, user.Login, user.Password, c.ClientIP())
 		if err != nil {
+			if abortIfBlocked(c, err) {
+				s.logger.Error("Login: ", err)
+				return
+			}
 			if errors.Is(err, apperrors.ErrInvalidPassword) || errors.Is(err, sql.ErrNoRows) {
 				s.logger.Error("Login: ", err)
 				c.AbortWithStatus(http.StatusUnauthorized)
@@ -75,11 +101,320 @@ func (s *restAPIServer) LoginHandler(ctx context.Context) func(c *gin.Context) {
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		c.Header("Authorization", token)
+		if tokens.TwoFactorToken != "" {
+			// the client continues with LoginTwoFactorHandler
+			c.JSON(http.StatusOK, tokens)
+			return
+		}
+		c.Header("Authorization", tokens.AccessToken)
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func (s *restAPIServer) LoginTwoFactorHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request model.TwoFactorLoginRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := s.service.LoginTwoFactor(ctx, request.TwoFactorToken, request.Code)
+		if err != nil {
+			if abortIfBlocked(c, err) {
+				s.logger.Error("LoginTwoFactor: ", err)
+				return
+			}
+			if errors.Is(err, apperrors.ErrInvalidTwoFactorToken) || errors.Is(err, apperrors.ErrInvalidTOTPCode) {
+				s.logger.Error("LoginTwoFactor: ", err)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			s.logger.Error("LoginTwoFactor: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Header("Authorization", tokens.AccessToken)
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func (s *restAPIServer) RefreshTokenHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request model.RefreshTokenRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := s.service.RefreshToken(ctx, request.RefreshToken)
+		if err != nil {
+			if errors.Is(err, apperrors.ErrInvalidRefreshToken) {
+				s.logger.Error("RefreshToken: ", err)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			s.logger.Error("RefreshToken: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Header("Authorization", tokens.AccessToken)
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+func (s *restAPIServer) LogoutHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		sessionID, err := getSessionIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getSessionIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if err := s.service.Logout(ctx, sessionID); err != nil {
+			s.logger.Error("Logout: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) LogoutAllHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if err := s.service.LogoutAll(ctx, userID); err != nil {
+			s.logger.Error("LogoutAll: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) ChangePasswordHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		sessionID, err := getSessionIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getSessionIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.ChangePasswordRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.ChangePassword(ctx, userID, sessionID, request.CurrentPassword, request.NewPassword); err != nil {
+			if errors.Is(err, apperrors.ErrInvalidPassword) {
+				s.logger.Error("ChangePassword: ", err)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			s.logger.Error("ChangePassword: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) RequestPasswordResetHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request model.PasswordResetRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.RequestPasswordReset(ctx, request.Login); err != nil {
+			s.logger.Error("RequestPasswordReset: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusAccepted)
+	}
+}
+
+func (s *restAPIServer) ResetPasswordHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request model.ResetPasswordRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.ResetPassword(ctx, request.Token, request.NewPassword); err != nil {
+			if errors.Is(err, apperrors.ErrInvalidResetToken) {
+				s.logger.Error("ResetPassword: ", err)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			s.logger.Error("ResetPassword: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.AbortWithStatus(http.StatusOK)
+	}
+}
+
+func (s *restAPIServer) SetupTOTPHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		setup, err := s.service.SetupTOTP(ctx, userID)
+		if err != nil {
+			if errors.Is(err, apperrors.ErrTOTPAlreadyEnabled) {
+				s.logger.Error("SetupTOTP: ", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("SetupTOTP: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, setup)
+	}
+}
+
+func (s *restAPIServer) ConfirmTOTPHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.TOTPCodeRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		codes, err := s.service.ConfirmTOTP(ctx, userID, request.Code)
+		if err != nil {
+			if errors.Is(err, apperrors.ErrInvalidTOTPCode) {
+				s.logger.Error("ConfirmTOTP: ", err)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTOTPNotSetUp) || errors.Is(err, apperrors.ErrTOTPAlreadyEnabled) {
+				s.logger.Error("ConfirmTOTP: ", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("ConfirmTOTP: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+func (s *restAPIServer) DisableTOTPHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.DisableTOTPRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.service.DisableTOTP(ctx, userID, request.Password, request.Code); err != nil {
+			if abortIfBlocked(c, err) {
+				s.logger.Error("DisableTOTP: ", err)
+				return
+			}
+			if errors.Is(err, apperrors.ErrInvalidPassword) || errors.Is(err, apperrors.ErrInvalidTOTPCode) {
+				s.logger.Error("DisableTOTP: ", err)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTOTPNotEnabled) {
+				s.logger.Error("DisableTOTP: ", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("DisableTOTP: ", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
 		c.AbortWithStatus(http.StatusOK)
 	}
 }
 
+// JWKSHandler publishes the public keys that verify access tokens.
+func (s *restAPIServer) JWKSHandler() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "max-age=300")
+		c.JSON(http.StatusOK, s.auth.JWKS())
+	}
+}
+
 func (s *restAPIServer) UploadOrderHandler(ctx context.Context) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		orderNumber, err := getOrderNumberFromContext(c)
@@ -151,7 +486,7 @@ func (s *restAPIServer) Withdraw(ctx context.Context) func(c *gin.Context) {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		if err := validate.Var(withdrawRequest.Amount, "required,min=1"); err != nil {
+		if err := validate.Var(withdrawRequest.Amount, "required,gt=0"); err != nil {
 			s.logger.Error("validate Sum: ", err)
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
@@ -168,13 +503,27 @@ func (s *restAPIServer) Withdraw(ctx context.Context) func(c *gin.Context) {
 			OrderNumber: withdrawRequest.OrderNumber,
 			UserID:      userID,
 		}
-		if err := s.service.Withdraw(ctx, withdrawal); err != nil {
+		if err := s.service.Withdraw(ctx, withdrawal, c.GetHeader(totpCodeHeader)); err != nil {
+			if abortIfBlocked(c, err) {
+				s.logger.Error("Withdraw", err)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTOTPRequired) || errors.Is(err, apperrors.ErrInvalidTOTPCode) {
+				s.logger.Error("Withdraw", err)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
 			if errors.Is(err, apperrors.ErrNotEnoughFunds) {
 				s.logger.Error("Withdraw", err)
 				c.AbortWithStatus(http.StatusPaymentRequired)
 				c.Abort()
 				return
 			}
+			if errors.Is(err, apperrors.ErrWithdrawalAlreadyExists) {
+				s.logger.Error("Withdraw", err)
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
 			s.logger.Error("Withdraw", err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
@@ -201,6 +550,42 @@ func (s *restAPIServer) GetBalance(ctx context.Context) func(c *gin.Context) {
 	}
 }
 
+func (s *restAPIServer) GetProfileHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		profile, err := s.service.GetProfile(ctx, userID)
+		if err != nil {
+			s.logger.Errorf("GetProfile: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, profile)
+	}
+}
+
+func (s *restAPIServer) GetReferralsHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		referrals, err := s.service.GetReferrals(ctx, userID)
+		if err != nil {
+			s.logger.Errorf("GetReferrals: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, referrals)
+	}
+}
+
 func (s *restAPIServer) ListWithdrawals(ctx context.Context) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		userID, err := getUserIDFromContext(c)
@@ -222,6 +607,182 @@ func (s *restAPIServer) ListWithdrawals(ctx context.Context) func(c *gin.Context
 		c.IndentedJSON(http.StatusOK, withdrawals)
 	}
 }
+func (s *restAPIServer) TransferHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var request model.TransferRequest
+		if err := c.BindJSON(&request); err != nil {
+			s.logger.Error("BindJSON", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			s.logger.Error("validate.Struct", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		transfer, err := s.service.Transfer(ctx, userID, request, c.GetHeader(totpCodeHeader))
+		if err != nil {
+			if abortIfBlocked(c, err) {
+				s.logger.Error("Transfer", err)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTOTPRequired) || errors.Is(err, apperrors.ErrInvalidTOTPCode) {
+				s.logger.Error("Transfer", err)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, apperrors.ErrInvalidAmount) || errors.Is(err, apperrors.ErrTransferToSelf) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, apperrors.ErrNotEnoughFunds) {
+				c.AbortWithStatus(http.StatusPaymentRequired)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTransferLimitExceeded) {
+				c.AbortWithStatus(http.StatusTooManyRequests)
+				return
+			}
+			s.logger.Error("Transfer", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		status := http.StatusOK
+		if transfer.Status == model.TransferStatusPending {
+			status = http.StatusAccepted
+		}
+		c.IndentedJSON(status, transfer)
+	}
+}
+
+func (s *restAPIServer) ListTransfersHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		transfers, err := s.service.GetTransfers(ctx, userID)
+		if err != nil {
+			s.logger.Errorf("GetTransfers: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(transfers) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, transfers)
+	}
+}
+
+// SettleTransferHandler accepts (model.TransferStatusCompleted), declines or cancels the transfer in the path.
+func (s *restAPIServer) SettleTransferHandler(ctx context.Context, status model.TransferStatus) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		transferID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			s.logger.Errorf("ParseUint: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		transfer, err := s.service.SettleTransfer(ctx, userID, uint(transferID), status)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, apperrors.ErrTransferNotPending) {
+				c.AbortWithStatus(http.StatusConflict)
+				return
+			}
+			s.logger.Error("SettleTransfer", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, transfer)
+	}
+}
+
+func (s *restAPIServer) ListTransactionsHandler(ctx context.Context) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		query, err := getTransactionsQueryFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getTransactionsQueryFromContext: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		page, err := s.service.GetTransactions(ctx, userID, query)
+		if err != nil {
+			s.logger.Errorf("GetTransactions: %v", err)
+			if errors.Is(err, apperrors.ErrInvalidTransactionsQuery) {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(page.Transactions) == 0 {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, page)
+	}
+}
+
+// getTransactionsQueryFromContext reads the limit, cursor, type (repeated or comma-separated)
+// and RFC 3339 from and to query parameters.
+func getTransactionsQueryFromContext(c *gin.Context) (model.TransactionsQuery, error) {
+	query := model.TransactionsQuery{Cursor: c.Query("cursor")}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return model.TransactionsQuery{}, err
+		}
+		query.Limit = n
+	}
+	for _, types := range c.QueryArray("type") {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				query.Types = append(query.Types, model.LedgerEntryType(strings.ToUpper(t)))
+			}
+		}
+	}
+	for param, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return model.TransactionsQuery{}, err
+			}
+			*bound = t
+		}
+	}
+	return query, nil
+}
+
 func getOrderNumberFromContext(c *gin.Context) (string, error) {
 	buf := new(bytes.Buffer)
 	if _, err := buf.ReadFrom(c.Request.Body); err != nil {
@@ -247,3 +808,15 @@ func getUserIDFromContext(c *gin.Context) (uint, error) {
 	}
 	return userIDUint, nil
 }
+
+func getSessionIDFromContext(c *gin.Context) (string, error) {
+	sessionID, exist := c.Get("sessionID")
+	if !exist {
+		return "", errors.New("no sessionID")
+	}
+	sessionIDString, ok := sessionID.(string)
+	if !ok {
+		return "", errors.New("error casting sessionID")
+	}
+	return sessionIDString, nil
+}
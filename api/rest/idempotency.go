@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const (
+	idempotencyKeyHeader       = "Idempotency-Key"
+	idempotentReplayedHeader   = "Idempotent-Replayed"
+	maxIdempotencyKeyLength    = 255
+	idempotencyCleanupInterval = time.Hour
+)
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replays the first response to a request with the same Idempotency-Key
+// from the same user to the same URL path, so a key reused for another resource, e.g.
+// another transfer or order, does not replay the response about the first one.
+// Requests without the header are passed through unchanged.
+// A request holds its key for cfg.IdempotencyLockTTL; the key is released if the request
+// fails, panics or its response can not be saved.
+func (s *restAPIServer) Idempotency(ctx context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		userID, err := getUserIDFromContext(c)
+		if err != nil {
+			s.logger.Errorf("getUserIDFromContext: %v", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			s.logger.Errorf("ReadAll: %v", err)
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key = scopedIdempotencyKey(c.Request.URL.Path, key)
+		now := time.Now().UTC()
+		record := model.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash(c.Request.Method, c.Request.URL.Path, body),
+			LockedUntil: now.Add(s.cfg.IdempotencyLockTTL),
+			ExpiresAt:   now.Add(s.cfg.IdempotencyKeyTTL),
+		}
+		stored, created, err := s.storage.ReserveIdempotencyKey(ctx, record)
+		if err != nil {
+			s.logger.Errorf("ReserveIdempotencyKey: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !created {
+			switch {
+			case stored.RequestHash != record.RequestHash:
+				c.AbortWithStatus(http.StatusUnprocessableEntity)
+			case stored.StatusCode == 0:
+				c.AbortWithStatus(http.StatusConflict)
+			default:
+				c.Header(idempotentReplayedHeader, "true")
+				c.Data(stored.StatusCode, stored.ContentType, stored.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				s.releaseIdempotencyKey(ctx, userID, key)
+				panic(r)
+			}
+		}()
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if retryable(c.Writer.Status()) {
+			// let the client retry a failed request with the same key
+			s.releaseIdempotencyKey(ctx, userID, key)
+			return
+		}
+		record.StatusCode = c.Writer.Status()
+		record.ContentType = c.Writer.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+		if err := s.storage.SaveIdempotentResponse(ctx, record); err != nil {
+			s.logger.Errorf("SaveIdempotentResponse: %v", err)
+			s.releaseIdempotencyKey(ctx, userID, key)
+		}
+	}
+}
+
+func (s *restAPIServer) releaseIdempotencyKey(ctx context.Context, userID uint, key string) {
+	if err := s.storage.DeleteIdempotencyKey(ctx, userID, key); err != nil {
+		s.logger.Errorf("DeleteIdempotencyKey: %v", err)
+	}
+}
+
+func (s *restAPIServer) cleanupIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.storage.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+				s.logger.Errorf("DeleteExpiredIdempotencyKeys: %v", err)
+			}
+		}
+	}
+}
+
+// scopedIdempotencyKey is the key a request to path is stored under.
+func scopedIdempotencyKey(path, key string) string {
+	return path + " " + key
+}
+
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// retryable responses are not replayed: the request did nothing and may succeed later,
+// e.g. with a TOTP code or once the block is lifted.
+func retryable(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusForbidden || status == http.StatusTooManyRequests
+}
@@ -0,0 +1,183 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/memory"
+	mock_service "github.com/mrkovshik/yandex_diploma/mocks"
+)
+
+func Test_restAPIServer_Idempotency(t *testing.T) {
+	const (
+		key  = "d7b5c1f0"
+		path = "/api/user/balance/withdraw"
+		body = `{"order":"2377225624","sum":751}`
+	)
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	storage := mock_service.NewMockStorage(ctrl)
+	s := &restAPIServer{
+		storage: storage,
+		cfg:     &config.Config{IdempotencyKeyTTL: time.Hour},
+		logger:  zap.NewNop().Sugar(),
+	}
+	var handled int
+	status := http.StatusOK
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST(path, func(c *gin.Context) { c.Set("userID", UserID1) }, s.Idempotency(ctx), func(c *gin.Context) {
+		handled++
+		c.AbortWithStatus(status)
+	})
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set(idempotencyKeyHeader, key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	hash := requestHash(http.MethodPost, path, []byte(body))
+
+	// first request is processed and its response is saved
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+			assert.Equal(t, hash, r.RequestHash)
+			return r, true, nil
+		})
+	storage.EXPECT().SaveIdempotentResponse(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) error {
+			assert.Equal(t, http.StatusOK, r.StatusCode)
+			return nil
+		})
+	assert.Equal(t, http.StatusOK, send(body).Code)
+	assert.Equal(t, 1, handled)
+
+	// retry gets the saved response
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).Return(model.IdempotencyRecord{
+		UserID: UserID1, Key: scopedIdempotencyKey(path, key), RequestHash: hash, StatusCode: http.StatusOK,
+	}, false, nil)
+	w := send(body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, 1, handled)
+
+	// same key with another payload
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).Return(model.IdempotencyRecord{
+		UserID: UserID1, Key: scopedIdempotencyKey(path, key), RequestHash: hash, StatusCode: http.StatusOK,
+	}, false, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, send(`{"order":"2377225624","sum":1}`).Code)
+
+	// first request is still in progress
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).Return(model.IdempotencyRecord{
+		UserID: UserID1, Key: scopedIdempotencyKey(path, key), RequestHash: hash,
+	}, false, nil)
+	assert.Equal(t, http.StatusConflict, send(body).Code)
+	assert.Equal(t, 1, handled)
+
+	// failed request releases the key
+	status = http.StatusInternalServerError
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+			return r, true, nil
+		})
+	storage.EXPECT().DeleteIdempotencyKey(ctx, UserID1, scopedIdempotencyKey(path, key)).Return(nil)
+	assert.Equal(t, http.StatusInternalServerError, send(body).Code)
+	assert.Equal(t, 2, handled)
+
+	// so does a request rejected for a missing TOTP code, it can be retried with one
+	status = http.StatusForbidden
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+			return r, true, nil
+		})
+	storage.EXPECT().DeleteIdempotencyKey(ctx, UserID1, scopedIdempotencyKey(path, key)).Return(nil)
+	assert.Equal(t, http.StatusForbidden, send(body).Code)
+	assert.Equal(t, 3, handled)
+
+	// and a request whose response is not saved
+	status = http.StatusOK
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+			return r, true, nil
+		})
+	storage.EXPECT().SaveIdempotentResponse(ctx, gomock.Any()).Return(errors.New("connection reset"))
+	storage.EXPECT().DeleteIdempotencyKey(ctx, UserID1, scopedIdempotencyKey(path, key)).Return(nil)
+	assert.Equal(t, http.StatusOK, send(body).Code)
+	assert.Equal(t, 4, handled)
+}
+
+func Test_restAPIServer_Idempotency_panic(t *testing.T) {
+	const path = "/api/user/orders"
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	storage := mock_service.NewMockStorage(ctrl)
+	s := &restAPIServer{
+		storage: storage,
+		cfg:     &config.Config{IdempotencyKeyTTL: time.Hour, IdempotencyLockTTL: time.Minute},
+		logger:  zap.NewNop().Sugar(),
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST(path, func(c *gin.Context) { c.Set("userID", UserID1) }, s.Idempotency(ctx), func(c *gin.Context) {
+		panic("handler bug")
+	})
+
+	storage.EXPECT().ReserveIdempotencyKey(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, r model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+			assert.WithinDuration(t, time.Now().Add(time.Minute), r.LockedUntil, time.Second)
+			return r, true, nil
+		})
+	storage.EXPECT().DeleteIdempotencyKey(ctx, UserID1, scopedIdempotencyKey(path, "key")).Return(nil)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString("12345678903"))
+	req.Header.Set(idempotencyKeyHeader, "key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func Test_restAPIServer_Idempotency_pathParams(t *testing.T) {
+	ctx := context.Background()
+	s := &restAPIServer{
+		storage: memory.NewStorage(),
+		cfg:     &config.Config{IdempotencyKeyTTL: time.Hour, IdempotencyLockTTL: time.Minute},
+		logger:  zap.NewNop().Sugar(),
+	}
+	handled := make(map[string]int)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/user/transfers/:id/accept", func(c *gin.Context) { c.Set("userID", UserID1) }, s.Idempotency(ctx), func(c *gin.Context) {
+		handled[c.Param("id")]++
+		c.String(http.StatusOK, c.Param("id"))
+	})
+	send := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/user/transfers/"+id+"/accept", nil)
+		req.Header.Set(idempotencyKeyHeader, "d7b5c1f0")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// the same key accepts two transfers, each of them once
+	for _, id := range []string{"1", "2", "1", "2"} {
+		w := send(id)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, id, w.Body.String())
+	}
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, handled)
+}
@@ -3,13 +3,13 @@ package rest
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
-
-	"github.com/mrkovshik/yandex_diploma/internal/auth"
 )
 
+// Auth accepts a valid access token of an active session; logging out revokes the session,
+// so its access tokens stop working before they expire.
 func (s *restAPIServer) Auth(ctx context.Context) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
@@ -17,19 +17,20 @@ func (s *restAPIServer) Auth(ctx context.Context) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		claims := &auth.Claims{}
-		if _, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(s.cfg.SecretKey), nil
-		}); err != nil {
+		claims, err := s.auth.ValidateToken(token)
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
-		if _, err := s.storage.GetUserByID(ctx, claims.UserID); err != nil {
+		session, err := s.storage.GetSession(ctx, claims.SessionID)
+		if err != nil || session.UserID != claims.UserID || !session.Active(time.Now()) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("role", claims.Role)
 	}
 }
 
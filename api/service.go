@@ -7,13 +7,43 @@ import (
 )
 
 type Service interface {
-	Register(ctx context.Context, login, password string) (string, error)
-	Login(ctx context.Context, login, password string) (string, error)
+	Register(ctx context.Context, login, password, referralCode string) (model.AuthTokens, error)
+	Login(ctx context.Context, login, password, ip string) (model.AuthTokens, error)
+	RefreshToken(ctx context.Context, refreshToken string) (model.AuthTokens, error)
+	Logout(ctx context.Context, sessionID string) error
+	LogoutAll(ctx context.Context, userID uint) error
+	ChangePassword(ctx context.Context, userID uint, sessionID, currentPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	LoginTwoFactor(ctx context.Context, twoFactorToken, code string) (model.AuthTokens, error)
+	SetupTOTP(ctx context.Context, userID uint) (model.TOTPSetupResponse, error)
+	ConfirmTOTP(ctx context.Context, userID uint, code string) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, userID uint, password, code string) error
+	GetUserInfo(ctx context.Context, userID uint) (model.UserInfo, error)
+	FindUserByLogin(ctx context.Context, login string) (model.UserInfo, error)
+	SetUserRole(ctx context.Context, actorID, userID uint, role model.Role) error
+	Unlock(ctx context.Context, actorID uint, request model.UnlockRequest) error
+	AdjustBalance(ctx context.Context, operatorID, userID uint, amount model.Amount, reason string) (model.BalanceAdjustment, error)
+	ListBalanceAdjustments(ctx context.Context, userID uint) ([]model.BalanceAdjustment, error)
+	ReverseWithdrawal(ctx context.Context, actorID uint, orderNumber string) (model.Withdrawal, error)
+	ClawbackOrder(ctx context.Context, actorID uint, orderNumber string) (model.Order, error)
+	CreateCampaign(ctx context.Context, actorID uint, request model.CampaignRequest) (model.Campaign, error)
+	GetCampaigns(ctx context.Context) ([]model.Campaign, error)
+	GetCampaign(ctx context.Context, id uint) (model.Campaign, error)
+	EndCampaign(ctx context.Context, actorID, id uint) (model.Campaign, error)
 	UploadOrder(ctx context.Context, number string, userID uint) (bool, error)
 	UpdateOrderAccrual(ctx context.Context, orderNumber string) error
 	GetUserOrders(ctx context.Context, userID uint) ([]model.Order, error)
-	UpdatePendingOrders(ctx context.Context) error
-	Withdraw(ctx context.Context, withdrawal model.Withdrawal) error
+	PollPendingOrders(ctx context.Context)
+	ExpirePoints(ctx context.Context)
+	RecalculateTiers(ctx context.Context)
+	Withdraw(ctx context.Context, withdrawal model.Withdrawal, totpCode string) error
 	ListUserWithdrawals(ctx context.Context, userID uint) ([]model.Withdrawal, error)
 	GetBalance(ctx context.Context, userID uint) (model.GetBalanceResponse, error)
+	GetProfile(ctx context.Context, userID uint) (model.Profile, error)
+	GetReferrals(ctx context.Context, userID uint) (model.ReferralsResponse, error)
+	Transfer(ctx context.Context, senderID uint, request model.TransferRequest, totpCode string) (model.Transfer, error)
+	GetTransfers(ctx context.Context, userID uint) ([]model.Transfer, error)
+	SettleTransfer(ctx context.Context, userID, transferID uint, status model.TransferStatus) (model.Transfer, error)
+	GetTransactions(ctx context.Context, userID uint, query model.TransactionsQuery) (model.TransactionsPage, error)
 }
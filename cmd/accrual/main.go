@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/mrkovshik/yandex_diploma/api/accrualrest"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/migrate"
+	"github.com/mrkovshik/yandex_diploma/internal/service/calculator"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/postgres"
+)
+
+const migrationsTable = "accrual_schema_migrations"
+
+func main() {
+	loggerConfig := zap.Config{
+		Level:       zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		Development: false,
+		Encoding:    "json",
+		EncoderConfig: zapcore.EncoderConfig{
+			TimeKey:        "timestamp",
+			LevelKey:       "level",
+			NameKey:        "logger",
+			CallerKey:      "",
+			MessageKey:     "message",
+			StacktraceKey:  "",
+			LineEnding:     zapcore.DefaultLineEnding,
+			EncodeLevel:    zapcore.LowercaseLevelEncoder,
+			EncodeTime:     zapcore.ISO8601TimeEncoder,
+			EncodeDuration: zapcore.StringDurationEncoder,
+			EncodeCaller:   zapcore.ShortCallerEncoder,
+		},
+		OutputPaths:      []string{"stdout"},
+		ErrorOutputPaths: []string{"stderr"},
+	}
+
+	logger, err := loggerConfig.Build()
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	sugar := logger.Sugar()
+	ctx := context.Background()
+	cfg, err := config.GetAccrualConfigs()
+	if err != nil {
+		sugar.Fatal("config.GetAccrualConfigs", err)
+	}
+	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+	if err != nil {
+		sugar.Fatal("sql.Open", err)
+	}
+	migrator, err := migrate.New(db, postgres.CalculatorMigrations(), migrationsTable)
+	if err != nil {
+		sugar.Fatal("migrate.New", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		sugar.Fatal("migrator.Up", err)
+	}
+	storage := postgres.NewCalculatorStorage(db)
+	service := calculator.NewCalculatorService(storage, sugar)
+
+	srv := accrualrest.NewAccrualAPIServer(service, cfg, sugar)
+
+	processTicker := time.NewTicker(cfg.ProcessInterval)
+	go func() {
+		for range processTicker.C {
+			if err := service.ProcessRegisteredOrders(ctx); err != nil {
+				sugar.Errorf("ProcessRegisteredOrders: %v", err)
+			}
+		}
+	}()
+
+	if err := srv.RunServer(ctx); err != nil {
+		sugar.Fatal(err)
+	}
+}
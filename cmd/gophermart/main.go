@@ -2,49 +2,19 @@ package main
 
 import (
 	"context"
-	"time"
+	"flag"
 
-	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
 	"github.com/mrkovshik/yandex_diploma/api/rest"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
 	"github.com/mrkovshik/yandex_diploma/internal/config"
 	"github.com/mrkovshik/yandex_diploma/internal/service/accrual"
 	"github.com/mrkovshik/yandex_diploma/internal/service/loyalty"
-	"github.com/mrkovshik/yandex_diploma/internal/storage/postgres"
 )
 
-const accrualInterval = 10 * time.Second //TODO: move to config
-var schema = `
-CREATE TABLE IF NOT EXISTS users (
-	id serial4 NOT NULL,
-	login varchar NOT NULL,
-	"password" varchar NOT NULL,
-	created_at timestamptz NOT NULL,
-	balance float4 DEFAULT 0 NOT NULL,
-	CONSTRAINT users_pk PRIMARY KEY (id)
-);
-CREATE TABLE IF NOT EXISTS orders (
-	id serial4 NOT NULL,
-	order_number varchar NOT NULL,
-	user_id int4 NOT NULL,
-	uploaded_at timestamptz NOT NULL,
-	status varchar DEFAULT 'NEW'::character varying NOT NULL,
-	accrual float4 DEFAULT 0 NOT NULL,
-	CONSTRAINT orders_pk PRIMARY KEY (id),
-	CONSTRAINT orders_unique UNIQUE (order_number)
-);                                  
-    CREATE TABLE IF NOT EXISTS withdrawals (
-		id serial4 NOT NULL,
-	amount float4 NOT NULL,
-	processed_at timestamptz NOT NULL,
-	order_number varchar NOT NULL,
-	user_id int4 NOT NULL,
-	CONSTRAINT withdrawals_pk PRIMARY KEY (id)
-)`
-
 func main() {
 	loggerConfig := zap.Config{
 		Level:       zap.NewAtomicLevelAt(zapcore.InfoLevel),
@@ -78,25 +48,62 @@ func main() {
 	if err != nil {
 		sugar.Fatal("config.GetConfigs", err)
 	}
-	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+	storage, migrator, err := openStorage(cfg.DatabaseURI)
+	if err != nil {
+		sugar.Fatal("openStorage: ", err)
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if migrator == nil {
+			sugar.Fatal("migrate: the storage has no schema to migrate")
+		}
+		if err := runMigrate(ctx, migrator, args[1:], sugar); err != nil {
+			sugar.Fatal("migrate: ", err)
+		}
+		return
+	}
+	if migrator != nil {
+		if err := migrator.CheckUpToDate(ctx); err != nil {
+			sugar.Fatal("run `gophermart migrate up` first: ", err)
+		}
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "reconcile" {
+		if err := runReconcile(ctx, storage, sugar); err != nil {
+			sugar.Fatal("reconcile: ", err)
+		}
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "unlock" {
+		if err := runUnlock(ctx, storage, args[1:], sugar); err != nil {
+			sugar.Fatal("unlock: ", err)
+		}
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "role" {
+		if err := runRole(ctx, storage, args[1:], sugar); err != nil {
+			sugar.Fatal("role: ", err)
+		}
+		return
+	}
+	keys, generated, err := auth.LoadKeySet(cfg)
 	if err != nil {
-		sugar.Fatal("sql.Open", err)
+		sugar.Fatal("auth.LoadKeySet: ", err)
 	}
-	db.MustExec(schema)
-	accrualService := accrual.NewAccrualService(cfg.AccrualSystemAddress)
-	storage := postgres.NewStorage(db)
-	service := loyalty.NewBasicService(storage, accrualService, cfg, sugar)
+	if generated {
+		sugar.Warn("neither JWT_KEY_FILE nor SECRET_KEY is set, tokens are signed with a random key and will not survive a restart")
+	}
+	authService := auth.NewAuthService(keys, cfg.AccessTokenTTL)
+	accrualService := accrual.NewAccrualService(cfg.AccrualSystemAddress, cfg.AccrualRateLimit)
+	notifier, err := newNotifier(cfg, sugar)
+	if err != nil {
+		sugar.Fatal("newNotifier: ", err)
+	}
+	service := loyalty.NewBasicService(storage, accrualService, authService, notifier, cfg, sugar)
 
-	srv := rest.NewRestAPIServer(service, storage, cfg, sugar)
+	srv := rest.NewRestAPIServer(service, storage, authService, cfg, sugar)
 
-	accrualTicker := time.NewTicker(accrualInterval)
-	go func() {
-		for range accrualTicker.C {
-			if err := service.UpdatePendingOrders(ctx); err != nil {
-				sugar.Errorf("UpdatePendingOrders: %e", err)
-			}
-		}
-	}()
+	go service.PollPendingOrders(ctx)
+	go service.ExpirePoints(ctx)
+	go service.RecalculateTiers(ctx)
 
 	if err := srv.RunServer(ctx); err != nil {
 		sugar.Fatal(err)
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/migrate"
+)
+
+const migrationsTable = "schema_migrations"
+
+// runMigrate handles `gophermart [flags] migrate up|down [steps]|status`.
+func runMigrate(ctx context.Context, migrator *migrate.Migrator, args []string, logger *zap.SugaredLogger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected one of: up, down [steps], status")
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			logger.Infof("applied migration %04d_%s", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			logger.Infof("reverted migration %04d_%s", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				logger.Infof("%04d_%s pending", status.Version, status.Name)
+				continue
+			}
+			logger.Infof("%04d_%s applied at %v", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/service/loyalty"
+	"github.com/mrkovshik/yandex_diploma/internal/service/notify"
+)
+
+func newNotifier(cfg *config.Config, logger *zap.SugaredLogger) (loyalty.Notifier, error) {
+	switch cfg.Notifier {
+	case "log":
+		return notify.NewLogNotifier(logger), nil
+	case "file":
+		return notify.NewFileNotifier(cfg.NotifierFile), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Notifier)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+// runReconcile handles `gophermart [flags] reconcile`: it reports users whose
+// stored balance differs from their ledger and fails if there are any.
+func runReconcile(ctx context.Context, storage service.Storage, logger *zap.SugaredLogger) error {
+	discrepancies, err := storage.GetBalanceDiscrepancies(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range discrepancies {
+		logger.Warnf("user %v: balance %v, ledger %v", d.UserID, d.Balance, d.LedgerBalance)
+	}
+	if len(discrepancies) > 0 {
+		return fmt.Errorf("%d balances do not match the ledger", len(discrepancies))
+	}
+	logger.Info("all balances match the ledger")
+	return nil
+}
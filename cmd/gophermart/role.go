@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+// runRole handles `gophermart [flags] role <login> user|support|admin`. It is the way to
+// appoint the first admin; after that admins manage roles through the admin API.
+func runRole(ctx context.Context, storage service.Storage, args []string, logger *zap.SugaredLogger) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected: <login> user|support|admin")
+	}
+	role := model.Role(args[1])
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", args[1])
+	}
+	user, err := storage.GetUserByLogin(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := storage.SetUserRole(ctx, user.ID, role); err != nil {
+		return err
+	}
+	// sessions carry the role in their access tokens
+	if err := storage.RevokeUserSessions(ctx, user.ID, ""); err != nil {
+		return err
+	}
+	logger.Infof("%v is now %v", user.Login, role)
+	return nil
+}
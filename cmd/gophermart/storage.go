@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mrkovshik/yandex_diploma/internal/migrate"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/memory"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/postgres"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/sqlite"
+)
+
+// openStorage picks the storage backend by the scheme of DATABASE_URI.
+// The returned migrator is nil for backends that have no schema.
+func openStorage(uri string) (service.Storage, *migrate.Migrator, error) {
+	scheme, _, _ := strings.Cut(uri, "://")
+	switch scheme {
+	case "memory":
+		return memory.NewStorage(), nil, nil
+	case "postgres", "postgresql":
+		db, err := sqlx.Connect("postgres", uri)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sqlx.Connect: %w", err)
+		}
+		migrator, err := migrate.New(db, postgres.Migrations(), migrationsTable)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migrate.New: %w", err)
+		}
+		return postgres.NewStorage(db), migrator, nil
+	case "sqlite":
+		db, err := sqlite.Connect(uri)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sqlite.Connect: %w", err)
+		}
+		migrator, err := migrate.New(db, sqlite.Migrations(), migrationsTable)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migrate.New: %w", err)
+		}
+		return sqlite.NewStorage(db), migrator, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported database scheme %q", scheme)
+	}
+}
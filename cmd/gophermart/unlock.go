@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+	"github.com/mrkovshik/yandex_diploma/internal/service/loyalty"
+)
+
+// runUnlock handles `gophermart [flags] unlock login <login>|ip <address>`: it forgets
+// failed logins of the account or client IP and lifts their block. Unlocking a login
+// also forgets the wrong two-factor codes of the account.
+func runUnlock(ctx context.Context, storage service.Storage, args []string, logger *zap.SugaredLogger) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected one of: login <login>, ip <address>")
+	}
+	var request model.UnlockRequest
+	switch args[0] {
+	case "login":
+		request.Login = args[1]
+	case "ip":
+		request.IP = args[1]
+	default:
+		return fmt.Errorf("unknown unlock target %q", args[0])
+	}
+	keys, err := loyalty.ThrottleKeys(ctx, storage, request)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := storage.ResetLoginAttempts(ctx, key); err != nil {
+			return err
+		}
+		logger.Infof("%v is unlocked", key)
+	}
+	return nil
+}
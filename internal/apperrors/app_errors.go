@@ -1,16 +1,67 @@
 package apperrors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrUserAlreadyExists = errors.New("user is already exist")
 	ErrInvalidPassword   = errors.New("password is invalid")
 
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+	ErrSessionRevoked      = errors.New("session is expired or revoked")
+	ErrInvalidResetToken   = errors.New("password reset token is invalid, expired or used")
+	ErrLoginBlocked        = errors.New("too many failed login attempts")
+
+	ErrTOTPAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled        = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotSetUp          = errors.New("two-factor authentication is not set up")
+	ErrInvalidTOTPCode       = errors.New("two-factor authentication code is invalid or already used")
+	ErrTOTPRequired          = errors.New("two-factor authentication code is required")
+	ErrInvalidTwoFactorToken = errors.New("two-factor login token is invalid or expired")
+
+	ErrInvalidRole = errors.New("role is invalid")
+	ErrOwnRole     = errors.New("users can not change their own role")
+	ErrOwnBalance  = errors.New("users can not adjust their own balance")
+
+	ErrInvalidReferralCode = errors.New("referral code is invalid")
+	ErrReferralLimit       = errors.New("referrer has reached the limit of credited referrals")
+	ErrInvalidCampaign     = errors.New("campaign is invalid")
+
 	ErrOrderIsUploadedByAnotherUser = errors.New("order is uploaded by another user")
+	ErrOrderAlreadyUploaded         = errors.New("order is already uploaded")
+	ErrOrderNotProcessed            = errors.New("order accrual is not processed yet")
+	ErrOrderAlreadyReversed         = errors.New("order accrual is already clawed back")
 
 	ErrNoSuchOrder         = errors.New("order is not registered in loyalty program")
 	ErrInvalidResponseCode = errors.New("response code is invalid")
 	ErrTooManyRetrials     = errors.New("quota exceeded")
 
-	ErrNotEnoughFunds = errors.New("not enough funds on user's balance")
+	ErrNotEnoughFunds            = errors.New("not enough funds on user's balance")
+	ErrInvalidAmount             = errors.New("amount is invalid")
+	ErrWithdrawalAlreadyExists   = errors.New("order is already paid with points")
+	ErrWithdrawalAlreadyReversed = errors.New("withdrawal is already reversed")
+	ErrTransferToSelf            = errors.New("points can not be transferred to oneself")
+	ErrTransferLimitExceeded     = errors.New("daily transfer limit is exceeded")
+	ErrTransferNotPending        = errors.New("transfer is already settled")
+	ErrInvalidTransactionsQuery  = errors.New("transactions query is invalid")
+
+	ErrRewardRuleAlreadyExists = errors.New("reward rule with this match is already registered")
+	ErrOrderAlreadyRegistered  = errors.New("order is already registered in accrual system")
 )
+
+// RetryAfterError is Err that goes away after RetryAfter.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", e.Err, e.RetryAfter)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
@@ -1,49 +1,146 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+var (
+	ErrMalformedRefreshToken = errors.New("malformed refresh token")
+	ErrWrongTokenPurpose     = errors.New("token is not issued for this purpose")
 )
 
+// purposeTwoFactor marks tokens that only let the user pass the second login step.
+const purposeTwoFactor = "2fa"
+
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID uint
+	UserID    uint
+	SessionID string     `json:"sid"`
+	Role      model.Role `json:"role,omitempty"`
+	// Purpose is empty for access tokens.
+	Purpose string `json:"pur,omitempty"`
 }
 type Service struct {
-	secretKey string
-	tokenExp  int
+	keys     *KeySet
+	tokenTTL time.Duration
 }
 
-func NewAuthService(secretKey string, tokenExp int) *Service {
+// NewAuthService issues access tokens valid for tokenTTL signed with the current key of keys.
+func NewAuthService(keys *KeySet, tokenTTL time.Duration) *Service {
 	return &Service{
-		secretKey: secretKey,
-		tokenExp:  tokenExp,
+		keys:     keys,
+		tokenTTL: tokenTTL,
 	}
 }
-func (s *Service) GenerateToken(userID uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+
+// GenerateToken issues an access token of the user's session.
+func (s *Service) GenerateToken(userID uint, sessionID string, role model.Role) (string, error) {
+	return s.keys.sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(s.tokenExp) * time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
 	})
+}
 
-	tokenString, err := token.SignedString([]byte(s.secretKey))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+// GenerateTwoFactorToken issues a token that proves the user passed the password check.
+// It is exchanged for a session together with a TOTP code and is not an access token.
+func (s *Service) GenerateTwoFactorToken(userID uint, ttl time.Duration) (string, error) {
+	return s.keys.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		UserID:  userID,
+		Purpose: purposeTwoFactor,
+	})
 }
 
-// TODO: Add exp validation
+// ValidateToken checks the signature and expiry of an access token.
 func (s *Service) ValidateToken(token string) (Claims, error) {
+	return s.validate(token, "")
+}
+
+// ValidateTwoFactorToken checks a token issued by GenerateTwoFactorToken.
+func (s *Service) ValidateTwoFactorToken(token string) (Claims, error) {
+	return s.validate(token, purposeTwoFactor)
+}
+
+func (s *Service) validate(token, purpose string) (Claims, error) {
 	claims := Claims{}
-	if _, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(s.secretKey), nil
-	}); err != nil {
+	if _, err := jwt.ParseWithClaims(token, &claims, s.keys.keyFunc); err != nil {
 		return Claims{}, err
 	}
+	if claims.Purpose != purpose {
+		return Claims{}, ErrWrongTokenPurpose
+	}
 	return claims, nil
 }
+
+// JWKS returns the public keys that verify tokens of this service.
+func (s *Service) JWKS() JWKS {
+	return s.keys.JWKS()
+}
+
+// TokenTTL is the lifetime of access tokens.
+func (s *Service) TokenTTL() time.Duration {
+	return s.tokenTTL
+}
+
+// NewSessionID returns a random session identifier.
+func NewSessionID() (string, error) {
+	return randomHex(16)
+}
+
+// NewRefreshToken returns an opaque refresh token of the session and its hash to store.
+// Only the hash is kept server-side, so a leaked database does not leak tokens.
+func NewRefreshToken(sessionID string) (token string, hash string, err error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID + "." + secret, HashToken(secret), nil
+}
+
+// ParseRefreshToken splits a refresh token into the session ID and the hash of its secret.
+func ParseRefreshToken(token string) (sessionID string, hash string, err error) {
+	sessionID, secret, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", ErrMalformedRefreshToken
+	}
+	return sessionID, HashToken(secret), nil
+}
+
+// NewOneTimeToken returns a random token, e.g. for a password reset, and its hash to store.
+func NewOneTimeToken() (token string, hash string, err error) {
+	token, err = randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,35 +2,83 @@ package auth
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
 )
 
 const (
 	key = "akjsfdsf"
-	exp = 3
+	ttl = 15 * time.Minute
 )
 
 func TestService_GenerateToken(t *testing.T) {
 
 	tests := []struct {
-		name   string
-		userID uint
+		name      string
+		userID    uint
+		sessionID string
+		role      model.Role
 	}{
-		{"1", 7},
+		{"1", 7, "a1b2", model.RoleUser},
+		{"2", 8, "c3d4", model.RoleAdmin},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &Service{
-				secretKey: key,
-				tokenExp:  exp,
-			}
-			token, err := s.GenerateToken(tt.userID)
+			keys, err := NewKeySet(NewHMACKey([]byte(key)))
+			assert.NoError(t, err)
+			s := NewAuthService(keys, ttl)
+			token, err := s.GenerateToken(tt.userID, tt.sessionID, tt.role)
 			assert.NoError(t, err)
 			claims, err1 := s.ValidateToken(token)
 			assert.NoError(t, err1)
 			assert.Equal(t, tt.userID, claims.UserID)
+			assert.Equal(t, tt.sessionID, claims.SessionID)
+			assert.Equal(t, tt.role, claims.Role)
 
 		})
 	}
 }
+
+func TestService_ValidateToken_expired(t *testing.T) {
+	keys, err := NewKeySet(NewHMACKey([]byte(key)))
+	require.NoError(t, err)
+	s := NewAuthService(keys, -time.Minute)
+	token, err := s.GenerateToken(7, "a1b2", model.RoleUser)
+	require.NoError(t, err)
+	_, err = s.ValidateToken(token)
+	assert.Error(t, err)
+}
+
+func TestService_TwoFactorToken(t *testing.T) {
+	keys, err := NewKeySet(NewHMACKey([]byte(key)))
+	require.NoError(t, err)
+	s := NewAuthService(keys, ttl)
+	token, err := s.GenerateTwoFactorToken(7, time.Minute)
+	require.NoError(t, err)
+	claims, err := s.ValidateTwoFactorToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), claims.UserID)
+	// the tokens are not interchangeable
+	_, err = s.ValidateToken(token)
+	assert.ErrorIs(t, err, ErrWrongTokenPurpose)
+	access, err := s.GenerateToken(7, "a1b2", model.RoleUser)
+	require.NoError(t, err)
+	_, err = s.ValidateTwoFactorToken(access)
+	assert.ErrorIs(t, err, ErrWrongTokenPurpose)
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash, err := NewRefreshToken("a1b2")
+	require.NoError(t, err)
+	sessionID, parsedHash, err := ParseRefreshToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "a1b2", sessionID)
+	assert.Equal(t, hash, parsedHash)
+
+	_, _, err = ParseRefreshToken("a1b2")
+	assert.ErrorIs(t, err, ErrMalformedRefreshToken)
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+)
+
+var ErrUnknownKey = errors.New("token is signed with an unknown or retired key")
+
+// Key is a JWT signing or verification key. Keys loaded from public key files can only verify.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	// NotAfter is the end of the grace period of a previous key, zero for the current one.
+	NotAfter time.Time
+}
+
+func (k Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// NewHMACKey returns an HS256 key. Its ID is derived from the secret.
+func NewHMACKey(secret []byte) Key {
+	return Key{
+		ID:        keyID(secret),
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// NewAsymmetricKey returns an RS256 or EdDSA key of an *rsa.PrivateKey, ed25519.PrivateKey
+// or their public counterparts. Its ID is derived from the public key.
+func NewAsymmetricKey(key interface{}) (Key, error) {
+	var k Key
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k = Key{Method: jwt.SigningMethodRS256, signKey: key, verifyKey: key.Public()}
+	case *rsa.PublicKey:
+		k = Key{Method: jwt.SigningMethodRS256, verifyKey: key}
+	case ed25519.PrivateKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}
+	case ed25519.PublicKey:
+		k = Key{Method: jwt.SigningMethodEdDSA, verifyKey: key}
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(k.verifyKey)
+	if err != nil {
+		return Key{}, err
+	}
+	k.ID = keyID(der)
+	return k, nil
+}
+
+// GenerateKey returns a new random EdDSA key.
+func GenerateKey() (Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return NewAsymmetricKey(private)
+}
+
+// LoadKey reads a PEM encoded RSA or Ed25519 key: PKCS #8 or PKCS #1 private key, or PKIX public key.
+func LoadKey(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("%s: no PEM data", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewAsymmetricKey(key)
+}
+
+// KeySet signs tokens with the current key and verifies them with the current key
+// or with a previous key whose grace period has not ended yet.
+type KeySet struct {
+	current  Key
+	previous []Key
+}
+
+func NewKeySet(current Key, previous ...Key) (*KeySet, error) {
+	if !current.CanSign() {
+		return nil, fmt.Errorf("key %s cannot sign tokens", current.ID)
+	}
+	return &KeySet{current: current, previous: previous}, nil
+}
+
+// LoadKeySet builds the key set from the configuration:
+//   - JWT_KEY_FILE is the current key; without it SECRET_KEY is used for HS256;
+//   - JWT_PREVIOUS_KEY_FILES and, when JWT_KEY_FILE is set, SECRET_KEY are accepted
+//     for JWT_KEY_GRACE_PERIOD after start, so tokens issued before a rotation stay valid.
+//
+// generated reports that nothing is configured and a random key has been made up,
+// so tokens will not survive a restart.
+func LoadKeySet(cfg *config.Config) (keys *KeySet, generated bool, err error) {
+	var current Key
+	var previous []Key
+	notAfter := time.Now().Add(cfg.JWTKeyGracePeriod)
+	switch {
+	case cfg.JWTKeyFile != "":
+		if current, err = LoadKey(cfg.JWTKeyFile); err != nil {
+			return nil, false, err
+		}
+		if cfg.SecretKey != "" {
+			key := NewHMACKey([]byte(cfg.SecretKey))
+			key.NotAfter = notAfter
+			previous = append(previous, key)
+		}
+	case cfg.SecretKey != "":
+		current = NewHMACKey([]byte(cfg.SecretKey))
+	default:
+		if current, err = GenerateKey(); err != nil {
+			return nil, false, err
+		}
+		generated = true
+	}
+	if cfg.JWTKeyID != "" {
+		current.ID = cfg.JWTKeyID
+	}
+	for _, path := range cfg.JWTPreviousKeyFiles {
+		key, err := LoadKey(path)
+		if err != nil {
+			return nil, false, err
+		}
+		key.NotAfter = notAfter
+		previous = append(previous, key)
+	}
+	keys, err = NewKeySet(current, previous...)
+	return keys, generated, err
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.current.Method, claims)
+	token.Header["kid"] = ks.current.ID
+	return token.SignedString(ks.current.signKey)
+}
+
+// keyFunc picks the verification key by the kid header and checks that the token's
+// algorithm is the one of the key, so a public key is never used as an HMAC secret.
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.find(kid, time.Now())
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", t.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+func (ks *KeySet) find(kid string, now time.Time) (Key, bool) {
+	if kid == ks.current.ID {
+		return ks.current, true
+	}
+	for _, key := range ks.previous {
+		if key.ID == kid && now.Before(key.NotAfter) {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func keyID(material []byte) string {
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func rsaKeyFile(t *testing.T) (private string, public string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)), writePEM(t, "PUBLIC KEY", publicDER)
+}
+
+func ed25519KeyFile(t *testing.T) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return writePEM(t, "PRIVATE KEY", der)
+}
+
+func TestLoadKey(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaKeyFile(t)
+	tests := []struct {
+		name    string
+		path    string
+		alg     string
+		canSign bool
+	}{
+		{"rsa_private", rsaPrivate, "RS256", true},
+		{"rsa_public", rsaPublic, "RS256", false},
+		{"ed25519_private", ed25519KeyFile(t), "EdDSA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := LoadKey(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, key.Method.Alg())
+			assert.Equal(t, tt.canSign, key.CanSign())
+			assert.Len(t, key.ID, 16)
+		})
+	}
+	private, err := LoadKey(rsaPrivate)
+	require.NoError(t, err)
+	public, err := LoadKey(rsaPublic)
+	require.NoError(t, err)
+	assert.Equal(t, private.ID, public.ID)
+}
+
+func TestKeySet_rotation(t *testing.T) {
+	oldPrivate, oldPublic := rsaKeyFile(t)
+	newPrivate := ed25519KeyFile(t)
+
+	oldKeys, _, err := LoadKeySet(&config.Config{JWTKeyFile: oldPrivate})
+	require.NoError(t, err)
+	oldToken, err := NewAuthService(oldKeys, time.Hour).GenerateToken(7, "a1b2", model.RoleUser)
+	require.NoError(t, err)
+	hmacKeys, _, err := LoadKeySet(&config.Config{SecretKey: key})
+	require.NoError(t, err)
+	hmacToken, err := NewAuthService(hmacKeys, time.Hour).GenerateToken(7, "a1b2", model.RoleUser)
+	require.NoError(t, err)
+
+	keys, generated, err := LoadKeySet(&config.Config{
+		JWTKeyFile:          newPrivate,
+		SecretKey:           key,
+		JWTPreviousKeyFiles: []string{oldPublic},
+		JWTKeyGracePeriod:   time.Hour,
+	})
+	require.NoError(t, err)
+	assert.False(t, generated)
+	s := NewAuthService(keys, time.Hour)
+	newToken, err := s.GenerateToken(7, "a1b2", model.RoleUser)
+	require.NoError(t, err)
+	for _, token := range []string{newToken, oldToken, hmacToken} {
+		claims, err := s.ValidateToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, uint(7), claims.UserID)
+	}
+
+	jwks := s.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	// after the grace period only the current key is accepted
+	expired, _, err := LoadKeySet(&config.Config{
+		JWTKeyFile:          newPrivate,
+		SecretKey:           key,
+		JWTPreviousKeyFiles: []string{oldPublic},
+	})
+	require.NoError(t, err)
+	s = NewAuthService(expired, time.Hour)
+	_, err = s.ValidateToken(newToken)
+	assert.NoError(t, err)
+	for _, token := range []string{oldToken, hmacToken} {
+		_, err = s.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	}
+	assert.Len(t, s.JWKS().Keys, 1)
+}
+
+func TestKeySet_rejectsAlgorithmMismatch(t *testing.T) {
+	keys, generated, err := LoadKeySet(&config.Config{})
+	require.NoError(t, err)
+	assert.True(t, generated)
+	// an HS256 token that claims the kid of the EdDSA key must not be verified with it
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 7})
+	token.Header["kid"] = keys.current.ID
+	signed, err := token.SignedString([]byte(keys.current.verifyKey.(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = NewAuthService(keys, time.Hour).ValidateToken(signed)
+	assert.Error(t, err)
+}
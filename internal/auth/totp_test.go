@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHOTP_rfc6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, hotp(key, uint64(tt.unix/totpPeriod), 8))
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+	code, err := TOTPCode(secret, TOTPStep(now))
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), step)
+	// a code of the previous period is accepted for clock drift
+	_, ok = ValidateTOTP(secret, code, now.Add(totpPeriod*time.Second))
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(2*totpPeriod*time.Second))
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(secret, "000000", now)
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(secret, "28708", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+	uri, err := url.Parse(TOTPURI("Gophermart", "john", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Gophermart:john", uri.Path)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+	assert.Equal(t, "Gophermart", uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := NewRecoveryCode()
+	require.NoError(t, err)
+	assert.Len(t, code, 11)
+	assert.Equal(t, HashRecoveryCode(code), HashRecoveryCode(" "+code[:5]+code[6:]+" "))
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -11,8 +12,69 @@ type Config struct {
 	RunAddress           string `env:"RUN_ADDRESS"`
 	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
 	DatabaseURI          string `env:"DATABASE_URI"`
-	TokenExp             int    `env:"TOKEN_EXP" envDefault:"3"`
-	SecretKey            string `env:"SECRET_KEY" envDefault:"MyBaby'sGotASecret"`
+	TokenExp             int    `env:"TOKEN_EXP" envDefault:"3"` // refresh token lifetime in days
+	SecretKey            string `env:"SECRET_KEY"`
+
+	AccessTokenTTL      time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	JWTKeyFile          string        `env:"JWT_KEY_FILE"`
+	JWTKeyID            string        `env:"JWT_KEY_ID"`
+	JWTPreviousKeyFiles []string      `env:"JWT_PREVIOUS_KEY_FILES" envSeparator:","`
+	JWTKeyGracePeriod   time.Duration `env:"JWT_KEY_GRACE_PERIOD" envDefault:"1h"`
+
+	LoginFreeAttempts       int           `env:"LOGIN_FREE_ATTEMPTS" envDefault:"3"`
+	LoginLockoutThreshold   int           `env:"LOGIN_LOCKOUT_THRESHOLD" envDefault:"10"`
+	LoginIPFreeAttempts     int           `env:"LOGIN_IP_FREE_ATTEMPTS" envDefault:"20"`
+	LoginIPLockoutThreshold int           `env:"LOGIN_IP_LOCKOUT_THRESHOLD" envDefault:"100"`
+	LoginDelay              time.Duration `env:"LOGIN_DELAY" envDefault:"1s"`
+	LoginMaxDelay           time.Duration `env:"LOGIN_MAX_DELAY" envDefault:"1m"`
+	LoginLockoutDuration    time.Duration `env:"LOGIN_LOCKOUT_DURATION" envDefault:"15m"`
+	LoginFailureWindow      time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"1h"`
+	TrustedProxies          []string      `env:"TRUSTED_PROXIES" envSeparator:","` // whose X-Forwarded-For is believed; none by default
+
+	TOTPIssuer          string        `env:"TOTP_ISSUER" envDefault:"Gophermart"`
+	TwoFactorTokenTTL   time.Duration `env:"TWO_FACTOR_TOKEN_TTL" envDefault:"5m"`
+	WithdrawRequireTOTP bool          `env:"WITHDRAW_REQUIRE_TOTP" envDefault:"false"` // for users with 2FA enabled
+
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	Notifier         string        `env:"NOTIFIER" envDefault:"log"` // log or file
+	NotifierFile     string        `env:"NOTIFIER_FILE" envDefault:"notifications.log"`
+
+	AccrualInterval     time.Duration `env:"ACCRUAL_INTERVAL" envDefault:"10s"`
+	AccrualPollInterval time.Duration `env:"ACCRUAL_POLL_INTERVAL" envDefault:"1s"`
+	AccrualLeaseTime    time.Duration `env:"ACCRUAL_LEASE_TIME" envDefault:"1m"`
+	AccrualWorkers      int           `env:"ACCRUAL_WORKERS" envDefault:"2"`
+	AccrualBatchSize    int           `env:"ACCRUAL_BATCH_SIZE" envDefault:"10"`
+	AccrualRateLimit    int           `env:"ACCRUAL_RATE_LIMIT" envDefault:"0"`
+
+	IdempotencyKeyTTL  time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	IdempotencyLockTTL time.Duration `env:"IDEMPOTENCY_LOCK_TTL" envDefault:"1m"` // how long a request in progress holds its key
+
+	ClawbackAllowDebt bool `env:"CLAWBACK_ALLOW_DEBT" envDefault:"false"` // let a clawback leave a debt the balance does not cover
+
+	PointsExpiryMonths   int           `env:"POINTS_EXPIRY_MONTHS" envDefault:"0"` // 0 keeps points forever
+	PointsExpiryWarning  time.Duration `env:"POINTS_EXPIRY_WARNING" envDefault:"720h"`
+	PointsExpiryInterval time.Duration `env:"POINTS_EXPIRY_INTERVAL" envDefault:"1h"`
+
+	TierBasis            string        `env:"TIER_BASIS" envDefault:"accrued"` // accrued or spent
+	TierWindow           time.Duration `env:"TIER_WINDOW" envDefault:"8760h"`
+	TierRecalcInterval   time.Duration `env:"TIER_RECALC_INTERVAL" envDefault:"1h"`
+	TierSilverPoints     float64       `env:"TIER_SILVER_POINTS" envDefault:"1000"`
+	TierSilverMultiplier float64       `env:"TIER_SILVER_MULTIPLIER" envDefault:"1.05"`
+	TierGoldPoints       float64       `env:"TIER_GOLD_POINTS" envDefault:"5000"`
+	TierGoldMultiplier   float64       `env:"TIER_GOLD_MULTIPLIER" envDefault:"1.1"`
+
+	ReferralReferrerBonus  float64       `env:"REFERRAL_REFERRER_BONUS" envDefault:"100"`
+	ReferralRefereeBonus   float64       `env:"REFERRAL_REFEREE_BONUS" envDefault:"50"`
+	ReferralMinAccrual     float64       `env:"REFERRAL_MIN_ACCRUAL" envDefault:"1"` // minimal accrual of the first processed order of the referred user
+	ReferralWindow         time.Duration `env:"REFERRAL_WINDOW" envDefault:"720h"`
+	ReferralMaxPerReferrer int           `env:"REFERRAL_MAX_PER_REFERRER" envDefault:"20"`
+
+	CampaignsEnabled bool `env:"CAMPAIGNS_ENABLED" envDefault:"true"`
+
+	TransferConfirmation          string  `env:"TRANSFER_CONFIRMATION" envDefault:"above"` // never, always or above
+	TransferConfirmationThreshold float64 `env:"TRANSFER_CONFIRMATION_THRESHOLD" envDefault:"500"`
+	TransferDailyLimit            float64 `env:"TRANSFER_DAILY_LIMIT" envDefault:"1000"`
+	TransferDailyCount            int     `env:"TRANSFER_DAILY_COUNT" envDefault:"10"`
 }
 
 type serverConfigBuilder struct {
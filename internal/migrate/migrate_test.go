@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_users.up.sql":     {Data: []byte("CREATE TABLE users (id integer PRIMARY KEY, login varchar NOT NULL);")},
+	"0001_users.down.sql":   {Data: []byte("DROP TABLE users;")},
+	"0002_balance.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN balance bigint NOT NULL DEFAULT 0;")},
+	"0002_balance.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN balance;")},
+	"README.md":             {Data: []byte("not a migration")},
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := New(db, testMigrations, "schema_migrations")
+	require.NoError(t, err)
+	assert.ErrorIs(t, m.CheckUpToDate(ctx), ErrNotMigrated)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.NoError(t, m.CheckUpToDate(ctx))
+	_, err = db.ExecContext(ctx, "INSERT INTO users (id, login, balance) VALUES (1, 'gopher', 100)")
+	assert.NoError(t, err)
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.ErrorIs(t, m.CheckUpToDate(ctx), ErrNotMigrated)
+
+	reverted, err = m.Down(ctx, 5)
+	require.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestMigrator_failedMigrationIsNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	m, err := New(db, fstest.MapFS{
+		"0001_users.up.sql":  {Data: []byte("CREATE TABLE users (id integer PRIMARY KEY);")},
+		"0002_broken.up.sql": {Data: []byte("ALTER TABLE nope ADD COLUMN x int;")},
+	}, "schema_migrations")
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "broken", pending[0].Name)
+}
+
+func Test_load(t *testing.T) {
+	_, err := load(fstest.MapFS{"0001_users.down.sql": {Data: []byte("DROP TABLE users;")}})
+	assert.Error(t, err)
+	_, err = load(fstest.MapFS{
+		"0001_users.up.sql":  {Data: []byte("CREATE TABLE users (id integer);")},
+		"0001_people.up.sql": {Data: []byte("CREATE TABLE people (id integer);")},
+	})
+	assert.Error(t, err)
+}
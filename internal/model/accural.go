@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type AccrualState string
 
 const (
@@ -9,8 +11,36 @@ const (
 	AccrualStateProcessed  = AccrualState("PROCESSED")
 )
 
+type RewardType string
+
+const (
+	RewardTypePercent = RewardType("%")
+	RewardTypePoints  = RewardType("pt")
+)
+
 type AccrualResponse struct {
 	Order   string       `json:"order" uri:"order" binding:"required"`
 	Status  AccrualState `json:"status"`
-	Accrual float64      `json:"accrual"`
+	Accrual Amount       `json:"accrual,omitempty"`
+}
+
+type RewardRule struct {
+	ID         uint       `db:"id" json:"-"`
+	Match      string     `db:"match" json:"match" validate:"required"`
+	Reward     Amount     `db:"reward" json:"reward" validate:"gt=0"`
+	RewardType RewardType `db:"reward_type" json:"reward_type" validate:"oneof=% pt"`
+}
+
+type AccrualOrder struct {
+	ID          uint         `db:"id" json:"-"`
+	OrderNumber string       `db:"order_number" json:"order" validate:"required,luhn_checksum"`
+	Status      AccrualState `db:"status" json:"-"`
+	Accrual     Amount       `db:"accrual" json:"-"`
+	CreatedAt   time.Time    `db:"created_at" json:"-"`
+	Goods       []OrderGoods `db:"-" json:"goods" validate:"required,min=1,dive"`
+}
+
+type OrderGoods struct {
+	Description string `db:"description" json:"description" validate:"required"`
+	Price       Amount `db:"price" json:"price" validate:"gte=0"`
 }
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// BalanceAdjustment is a manual change of a user's balance by an operator, e.g. a compensation
+// or a correction of a wrong accrual. Adjustments form an append-only audit log.
+type BalanceAdjustment struct {
+	ID         uint      `db:"id" json:"id"`
+	UserID     uint      `db:"user_id" json:"user_id"`
+	OperatorID uint      `db:"operator_id" json:"operator_id"`
+	Amount     Amount    `db:"amount" json:"amount"` // negative amounts are debited
+	Reason     string    `db:"reason" json:"reason"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type BalanceAdjustmentRequest struct {
+	Amount Amount `json:"amount" validate:"required"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// LedgerEntry moves the amount between the user and the adjustments account.
+func (a BalanceAdjustment) LedgerEntry() LedgerEntry {
+	if a.Amount < 0 {
+		return LedgerEntry{
+			Type:          LedgerEntryAdjustment,
+			DebitAccount:  UserAccount(a.UserID),
+			CreditAccount: SystemAccountAdjustments,
+			Amount:        -a.Amount,
+		}
+	}
+	return LedgerEntry{
+		Type:          LedgerEntryAdjustment,
+		DebitAccount:  SystemAccountAdjustments,
+		CreditAccount: UserAccount(a.UserID),
+		Amount:        a.Amount,
+	}
+}
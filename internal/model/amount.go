@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount is a number of loyalty points stored in hundredths, so 1 point = Amount(100).
+// It is encoded in JSON as a plain decimal number, e.g. 729.98.
+type Amount int64
+
+const amountScale = 100
+
+func AmountFromFloat(f float64) Amount {
+	return Amount(math.Round(f * amountScale))
+}
+
+// Percent returns p percent of a rounded half away from zero, where p is an Amount as well.
+func (a Amount) Percent(p Amount) Amount {
+	product := new(big.Rat).SetFrac(new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(p))), big.NewInt(100*amountScale))
+	amount, err := ratToAmount(product)
+	if err != nil {
+		// saturate rather than wrap around
+		if product.Sign() < 0 {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return amount
+}
+
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	whole, frac := v/amountScale, v%amountScale
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, whole, frac), "0")
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON parses a JSON number exactly, without going through float64.
+// Values with more than two decimals are rounded to the nearest hundredth.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return fmt.Errorf("invalid amount %q", s)
+	}
+	amount, err := ratToAmount(r.Mul(r, big.NewRat(amountScale, 1)))
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	*a = amount
+	return nil
+}
+
+// ratToAmount rounds r to the nearest hundredth, failing if it does not fit into an Amount.
+func ratToAmount(r *big.Rat) (Amount, error) {
+	num, denom := r.Num(), r.Denom()
+	q, m := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(denom) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, errors.New("amount is out of range")
+	}
+	return Amount(q.Int64()), nil
+}
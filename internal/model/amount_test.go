@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAmount_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Amount
+		back string
+	}{
+		{"integer", "500", 50000, "500"},
+		{"two_decimals", "729.98", 72998, "729.98"},
+		{"one_decimal", "0.5", 50, "0.5"},
+		{"rounded", "333.335", 33334, "333.34"},
+		{"negative", "-12.05", -1205, "-12.05"},
+		{"exponent", "1e3", 100000, "1000"},
+		{"string", `"42.10"`, 4210, "42.1"},
+		{"zero", "0", 0, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Amount
+			assert.NoError(t, json.Unmarshal([]byte(tt.json), &got))
+			assert.Equal(t, tt.want, got)
+			back, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.back, string(back))
+		})
+	}
+
+	var invalid Amount
+	assert.Error(t, json.Unmarshal([]byte(`"ten"`), &invalid))
+	assert.Error(t, json.Unmarshal([]byte("1e30"), &invalid))
+	assert.Error(t, json.Unmarshal([]byte("-92233720368547758.09"), &invalid))
+	assert.Zero(t, invalid)
+}
+
+func TestAmount_Percent(t *testing.T) {
+	assert.Equal(t, Amount(70000), Amount(700000).Percent(1000))
+	assert.Equal(t, Amount(3333), Amount(33333).Percent(1000))
+	assert.Equal(t, Amount(2500), Amount(33333).Percent(750))
+	assert.Equal(t, Amount(-3333), Amount(-33333).Percent(1000))
+	assert.Equal(t, Amount(math.MaxInt64), Amount(math.MaxInt64).Percent(20000))
+}
+
+func TestAmount_sumIsExact(t *testing.T) {
+	var sum Amount
+	for i := 0; i < 10; i++ {
+		sum += AmountFromFloat(0.1)
+	}
+	assert.Equal(t, AmountFromFloat(1), sum)
+	assert.Equal(t, "1", sum.String())
+}
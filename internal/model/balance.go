@@ -1,6 +1,12 @@
 package model
 
+import "time"
+
 type GetBalanceResponse struct {
-	Balance   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Balance   Amount `json:"current"`
+	Withdrawn Amount `json:"withdrawn"`
+	Debt      Amount `json:"debt,omitempty"`
+	// Expiring points expire within the configured warning period, the first of them at ExpiringAt.
+	Expiring   Amount     `json:"expiring,omitempty"`
+	ExpiringAt *time.Time `json:"expiring_at,omitempty"`
 }
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Campaign grants a bonus on top of the accrual of orders uploaded between StartsAt and EndsAt.
+// The bonus is BonusPercent percent of the accrual plus BonusPoints, limited by PerUserCap
+// per user over the whole campaign. Empty Tiers or UserIDs make every user eligible.
+type Campaign struct {
+	ID           uint      `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	StartsAt     time.Time `db:"starts_at" json:"starts_at"`
+	EndsAt       time.Time `db:"ends_at" json:"ends_at"`
+	BonusPercent Amount    `db:"bonus_percent" json:"bonus_percent"`
+	BonusPoints  Amount    `db:"bonus_points" json:"bonus_points"`
+	Tiers        Tiers     `db:"tiers" json:"tiers,omitempty"`
+	UserIDs      []uint    `db:"-" json:"user_ids,omitempty"`
+	PerUserCap   Amount    `db:"per_user_cap" json:"per_user_cap"` // 0 means no cap
+	Granted      Amount    `db:"granted" json:"granted"`
+	CreatedBy    uint      `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type CampaignRequest struct {
+	Name         string    `json:"name" validate:"required,max=200"`
+	StartsAt     time.Time `json:"starts_at" validate:"required"`
+	EndsAt       time.Time `json:"ends_at" validate:"required,gtfield=StartsAt"`
+	BonusPercent Amount    `json:"bonus_percent" validate:"gte=0"`
+	BonusPoints  Amount    `json:"bonus_points" validate:"gte=0"`
+	Tiers        Tiers     `json:"tiers"`
+	UserIDs      []uint    `json:"user_ids"`
+	PerUserCap   Amount    `json:"per_user_cap" validate:"gte=0"`
+}
+
+// ActiveAt reports whether orders uploaded at t take part in the campaign.
+func (c Campaign) ActiveAt(t time.Time) bool {
+	return !t.Before(c.StartsAt) && t.Before(c.EndsAt)
+}
+
+// Eligible reports whether the user with the tier takes part in the campaign.
+func (c Campaign) Eligible(userID uint, tier Tier) bool {
+	if len(c.Tiers) > 0 && !c.Tiers.Contain(tier) {
+		return false
+	}
+	if len(c.UserIDs) == 0 {
+		return true
+	}
+	for _, id := range c.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Bonus returns the bonus for an order with the accrual, before the per-user cap.
+func (c Campaign) Bonus(accrual Amount) Amount {
+	return accrual.Percent(c.BonusPercent) + c.BonusPoints
+}
+
+// Tiers is stored as a comma-separated list.
+type Tiers []Tier
+
+func (t Tiers) Contain(tier Tier) bool {
+	for _, v := range t {
+		if v == tier {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Tiers) Value() (driver.Value, error) {
+	s := make([]string, len(t))
+	for i, v := range t {
+		s[i] = string(v)
+	}
+	return strings.Join(s, ","), nil
+}
+
+func (t *Tiers) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("can not scan %T into Tiers", src)
+	}
+	*t = Tiers{}
+	if s == "" {
+		return nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		*t = append(*t, Tier(v))
+	}
+	return nil
+}
+
+// CampaignBonus is a bonus of a campaign credited for an order, apart from the order's accrual.
+type CampaignBonus struct {
+	ID          uint      `db:"id" json:"-"`
+	CampaignID  uint      `db:"campaign_id" json:"campaign_id"`
+	UserID      uint      `db:"user_id" json:"-"`
+	OrderNumber string    `db:"order_number" json:"order"`
+	Amount      Amount    `db:"amount" json:"amount"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+func (b CampaignBonus) LedgerEntry() LedgerEntry {
+	return LedgerEntry{
+		Type:          LedgerEntryCampaign,
+		DebitAccount:  SystemAccountCampaigns,
+		CreditAccount: UserAccount(b.UserID),
+		Amount:        b.Amount,
+		OrderNumber:   b.OrderNumber,
+	}
+}
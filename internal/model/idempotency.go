@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is the first response to a request with an Idempotency-Key header.
+// StatusCode is zero while that request is still being processed; if it is not done by
+// LockedUntil, e.g. the instance died, another request with the key may take it over.
+type IdempotencyRecord struct {
+	UserID      uint      `db:"user_id"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	ContentType string    `db:"content_type"`
+	Body        []byte    `db:"response_body"`
+	LockedUntil time.Time `db:"locked_until"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
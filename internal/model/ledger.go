@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type LedgerEntryType string
+
+const (
+	LedgerEntryAccrual    = LedgerEntryType("ACCRUAL")
+	LedgerEntryWithdrawal = LedgerEntryType("WITHDRAWAL")
+	LedgerEntryReversal   = LedgerEntryType("REVERSAL")
+	LedgerEntryAdjustment = LedgerEntryType("ADJUSTMENT")
+	LedgerEntryExpiration = LedgerEntryType("EXPIRATION")
+	LedgerEntryReferral   = LedgerEntryType("REFERRAL")
+	LedgerEntryCampaign   = LedgerEntryType("CAMPAIGN")
+	LedgerEntryTransfer   = LedgerEntryType("TRANSFER")
+	LedgerEntryTier       = LedgerEntryType("TIER")
+)
+
+func (t LedgerEntryType) Valid() bool {
+	switch t {
+	case LedgerEntryAccrual, LedgerEntryWithdrawal, LedgerEntryReversal, LedgerEntryAdjustment, LedgerEntryExpiration,
+		LedgerEntryReferral, LedgerEntryCampaign, LedgerEntryTransfer, LedgerEntryTier:
+		return true
+	}
+	return false
+}
+
+// System accounts are the counterparties of user accounts in ledger entries.
+const (
+	SystemAccountAccruals    = "system:accruals"
+	SystemAccountWithdrawals = "system:withdrawals"
+	SystemAccountAdjustments = "system:adjustments"
+	SystemAccountExpirations = "system:expirations"
+	SystemAccountReferrals   = "system:referrals"
+	SystemAccountCampaigns   = "system:campaigns"
+	SystemAccountTransfers   = "system:transfers"
+	SystemAccountTiers       = "system:tiers"
+)
+
+func UserAccount(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// LedgerEntry moves Amount from DebitAccount to CreditAccount. Entries are never
+// updated or deleted: a movement is undone by a new entry in the opposite direction.
+type LedgerEntry struct {
+	ID            uint            `db:"id" json:"-"`
+	Type          LedgerEntryType `db:"entry_type" json:"type"`
+	DebitAccount  string          `db:"debit_account" json:"-"`
+	CreditAccount string          `db:"credit_account" json:"-"`
+	Amount        Amount          `db:"amount" json:"amount"`
+	OrderNumber   string          `db:"order_number" json:"order,omitempty"`
+	TransferID    uint            `db:"transfer_id" json:"-"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+}
+
+// BalanceDiscrepancy is a user whose stored balance, less the debt, differs from the ledger.
+type BalanceDiscrepancy struct {
+	UserID        uint   `db:"user_id"`
+	Balance       Amount `db:"balance"`
+	LedgerBalance Amount `db:"ledger_balance"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// Failed logins are counted per login and per client IP. These are the keys of the counters.
+
+func LoginThrottleKey(login string) string {
+	return "login:" + login
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// UnlockRequest names either a login or a client IP whose failed logins should be forgotten.
+type UnlockRequest struct {
+	Login string `json:"login,omitempty" validate:"required_without=IP,excluded_with=IP"`
+	IP    string `json:"ip,omitempty" validate:"omitempty,ip"`
+}
@@ -11,6 +11,8 @@ const (
 	OrderStateProcessing = OrderState("PROCESSING")
 	OrderStateInvalid    = OrderState("INVALID")
 	OrderStateProcessed  = OrderState("PROCESSED")
+	// OrderStateReversed marks a processed order whose accrual was clawed back after a refund.
+	OrderStateReversed = OrderState("REVERSED")
 )
 
 type Order struct {
@@ -19,5 +21,65 @@ type Order struct {
 	UserID      uint       `db:"user_id" json:"-"`
 	Status      OrderState `db:"status" json:"status"`
 	UploadedAt  time.Time  `db:"uploaded_at" json:"uploaded_at"`
-	Accrual     float64    `db:"accrual" json:"accrual,omitempty"`
+	Accrual     Amount     `db:"accrual" json:"accrual,omitempty"`
+	// TierBonus is credited on top of Accrual by the multiplier of the owner's loyalty tier.
+	TierBonus Amount `db:"tier_bonus" json:"tier_bonus,omitempty"`
+}
+
+// AccrualEntries are the ledger entries that credit the accrual and the tier bonus of the order to its owner.
+func (o Order) AccrualEntries() []LedgerEntry {
+	var entries []LedgerEntry
+	if o.Accrual > 0 {
+		entries = append(entries, LedgerEntry{
+			Type:          LedgerEntryAccrual,
+			DebitAccount:  SystemAccountAccruals,
+			CreditAccount: UserAccount(o.UserID),
+			Amount:        o.Accrual,
+			OrderNumber:   o.OrderNumber,
+		})
+	}
+	if o.TierBonus > 0 {
+		entries = append(entries, LedgerEntry{
+			Type:          LedgerEntryTier,
+			DebitAccount:  SystemAccountTiers,
+			CreditAccount: UserAccount(o.UserID),
+			Amount:        o.TierBonus,
+			OrderNumber:   o.OrderNumber,
+		})
+	}
+	return entries
+}
+
+// ClawbackEntries are the ledger entries that take the accrual, the tier bonus and the campaign bonuses
+// of the order back from its owner.
+func (o Order) ClawbackEntries(campaignBonuses Amount) []LedgerEntry {
+	var entries []LedgerEntry
+	if o.Accrual > 0 {
+		entries = append(entries, LedgerEntry{
+			Type:          LedgerEntryReversal,
+			DebitAccount:  UserAccount(o.UserID),
+			CreditAccount: SystemAccountAccruals,
+			Amount:        o.Accrual,
+			OrderNumber:   o.OrderNumber,
+		})
+	}
+	if o.TierBonus > 0 {
+		entries = append(entries, LedgerEntry{
+			Type:          LedgerEntryReversal,
+			DebitAccount:  UserAccount(o.UserID),
+			CreditAccount: SystemAccountTiers,
+			Amount:        o.TierBonus,
+			OrderNumber:   o.OrderNumber,
+		})
+	}
+	if campaignBonuses > 0 {
+		entries = append(entries, LedgerEntry{
+			Type:          LedgerEntryReversal,
+			DebitAccount:  UserAccount(o.UserID),
+			CreditAccount: SystemAccountCampaigns,
+			Amount:        campaignBonuses,
+			OrderNumber:   o.OrderNumber,
+		})
+	}
+	return entries
 }
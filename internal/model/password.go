@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// PasswordResetToken lets the user set a new password once before ExpiresAt.
+// Only the hash of the token is stored.
+type PasswordResetToken struct {
+	TokenHash string     `db:"token_hash"`
+	UserID    uint       `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type PasswordResetRequest struct {
+	Login string `json:"login" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
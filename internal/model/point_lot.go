@@ -0,0 +1,46 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// PointLot is a portion of the balance credited at once. Debits consume the oldest lots first,
+// and whatever remains of a lot expires together with it.
+type PointLot struct {
+	ID        uint      `db:"id" json:"-"`
+	UserID    uint      `db:"user_id" json:"-"`
+	Amount    Amount    `db:"amount" json:"amount"`
+	Remaining Amount    `db:"remaining" json:"remaining"`
+	AccruedAt time.Time `db:"accrued_at" json:"accrued_at"`
+}
+
+// CarryPointLots splits a credit of amount points, of which only credited reach the balance, into the lots
+// to open. The points keep the accrual time of the lots they were debited from, so that moving them does
+// not extend their expiry; the part not taken from any lot counts as accrued now. The rest paid off a debt
+// and is taken from the oldest lots first, as a debit would.
+func CarryPointLots(from []PointLot, amount, credited Amount, now time.Time) []PointLot {
+	portions := make([]PointLot, 0, len(from)+1)
+	portions = append(portions, from...)
+	sort.SliceStable(portions, func(i, j int) bool { return portions[i].AccruedAt.Before(portions[j].AccruedAt) })
+	var carried Amount
+	for _, lot := range portions {
+		carried += lot.Amount
+	}
+	if carried < amount {
+		portions = append(portions, PointLot{Amount: amount - carried, AccruedAt: now})
+	}
+	credited = min(max(credited, 0), amount)
+	paid := amount - credited
+	lots := make([]PointLot, 0, len(portions))
+	for _, lot := range portions {
+		used := min(lot.Amount, paid)
+		paid -= used
+		left := min(lot.Amount-used, credited)
+		credited -= left
+		if left > 0 {
+			lots = append(lots, PointLot{Amount: left, Remaining: left, AccruedAt: lot.AccruedAt})
+		}
+	}
+	return lots
+}
@@ -0,0 +1,80 @@
+package model
+
+import "time"
+
+type ReferralStatus string
+
+const (
+	// ReferralStatusPending waits for the first qualifying order of the referred user.
+	ReferralStatusPending  = ReferralStatus("PENDING")
+	ReferralStatusCredited = ReferralStatus("CREDITED")
+	ReferralStatusRejected = ReferralStatus("REJECTED")
+	// ReferralStatusReversed took the bonuses back when the order that settled the referral was clawed back.
+	ReferralStatusReversed = ReferralStatus("REVERSED")
+)
+
+// Referral links a user registered with a referral code to the owner of the code.
+type Referral struct {
+	ReferredID    uint           `db:"referred_id" json:"-"`
+	ReferredLogin string         `db:"referred_login" json:"login"`
+	ReferrerID    uint           `db:"referrer_id" json:"-"`
+	Status        ReferralStatus `db:"status" json:"status"`
+	RejectReason  string         `db:"reject_reason" json:"reject_reason,omitempty"`
+	OrderNumber   string         `db:"order_number" json:"-"`
+	ReferrerBonus Amount         `db:"referrer_bonus" json:"bonus,omitempty"`
+	RefereeBonus  Amount         `db:"referee_bonus" json:"-"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+	SettledAt     *time.Time     `db:"settled_at" json:"settled_at,omitempty"`
+}
+
+// ReferralsResponse is what GET /api/user/referrals shows to the referrer.
+type ReferralsResponse struct {
+	Code      string     `json:"code"`
+	Earned    Amount     `json:"earned"`
+	Referrals []Referral `json:"referrals"`
+}
+
+type RegisterRequest struct {
+	Login        string `json:"login" validate:"required"`
+	Password     string `json:"password" validate:"required"`
+	ReferralCode string `json:"referral_code"`
+}
+
+// ReferralBonus is a bonus credited to one of the parties of a referral.
+type ReferralBonus struct {
+	UserID uint
+	Amount Amount
+}
+
+// Bonuses lists the non-zero bonuses of the referral, the referrer's first.
+func (r Referral) Bonuses() []ReferralBonus {
+	var bonuses []ReferralBonus
+	if r.ReferrerBonus > 0 {
+		bonuses = append(bonuses, ReferralBonus{UserID: r.ReferrerID, Amount: r.ReferrerBonus})
+	}
+	if r.RefereeBonus > 0 {
+		bonuses = append(bonuses, ReferralBonus{UserID: r.ReferredID, Amount: r.RefereeBonus})
+	}
+	return bonuses
+}
+
+func (b ReferralBonus) LedgerEntry(orderNumber string) LedgerEntry {
+	return LedgerEntry{
+		Type:          LedgerEntryReferral,
+		DebitAccount:  SystemAccountReferrals,
+		CreditAccount: UserAccount(b.UserID),
+		Amount:        b.Amount,
+		OrderNumber:   orderNumber,
+	}
+}
+
+// ReversalEntry takes the bonus back when the order that settled the referral is clawed back.
+func (b ReferralBonus) ReversalEntry(orderNumber string) LedgerEntry {
+	return LedgerEntry{
+		Type:          LedgerEntryReversal,
+		DebitAccount:  UserAccount(b.UserID),
+		CreditAccount: SystemAccountReferrals,
+		Amount:        b.Amount,
+		OrderNumber:   orderNumber,
+	}
+}
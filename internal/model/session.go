@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Session is a login of a user. It is identified by a refresh token, which is
+// rotated on every refresh; access tokens carry the session ID.
+type Session struct {
+	ID               string     `db:"id"`
+	UserID           uint       `db:"user_id"`
+	RefreshTokenHash string     `db:"refresh_token_hash"`
+	CreatedAt        time.Time  `db:"created_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+// Active reports whether the session may still be used at the moment now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// AuthTokens are issued on login. If the user has two-factor authentication enabled,
+// the password check only yields TwoFactorToken, to be exchanged for the other tokens
+// together with a TOTP code.
+type AuthTokens struct {
+	AccessToken    string `json:"access_token,omitempty"`
+	RefreshToken   string `json:"refresh_token,omitempty"`
+	ExpiresIn      int    `json:"expires_in,omitempty"`
+	TwoFactorToken string `json:"two_factor_token,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
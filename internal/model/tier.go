@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// Tier is the loyalty level of a user. Higher tiers get a larger share of the accrual.
+type Tier string
+
+const (
+	TierBronze Tier = "bronze"
+	TierSilver Tier = "silver"
+	TierGold   Tier = "gold"
+)
+
+func (t Tier) Valid() bool {
+	switch t {
+	case TierBronze, TierSilver, TierGold:
+		return true
+	}
+	return false
+}
+
+// Tier points are counted either from accrued or from spent points.
+const (
+	TierBasisAccrued = "accrued"
+	TierBasisSpent   = "spent"
+)
+
+// TierLevel is reached with MinPoints tier points and multiplies accruals by Multiplier.
+type TierLevel struct {
+	Tier       Tier
+	MinPoints  Amount
+	Multiplier float64
+}
+
+// Apply multiplies the accrual by the level's multiplier.
+func (l TierLevel) Apply(accrual Amount) Amount {
+	return accrual.Percent(AmountFromFloat(l.Multiplier * 100))
+}
+
+// UserTier is the tier of the user as of the last recalculation.
+type UserTier struct {
+	UserID    uint      `db:"user_id"`
+	Tier      Tier      `db:"tier"`
+	Points    Amount    `db:"points"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// Turnover is the net amount of points a user has received from an account.
+type Turnover struct {
+	UserID uint   `db:"user_id"`
+	Amount Amount `db:"amount"`
+}
+
+// Profile is what GET /api/user/profile shows to the user.
+type Profile struct {
+	Login             string    `json:"login"`
+	Role              Role      `json:"role"`
+	Tier              Tier      `json:"tier"`
+	TierPoints        Amount    `json:"tier_points"`
+	AccrualMultiplier float64   `json:"accrual_multiplier"`
+	NextTier          Tier      `json:"next_tier,omitempty"`
+	NextTierPoints    Amount    `json:"next_tier_points,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// TOTP is the authenticator app secret of a user. Two-factor authentication is
+// enabled once the user confirms the secret with a valid code.
+type TOTP struct {
+	UserID       uint       `db:"user_id"`
+	Secret       string     `db:"secret"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ConfirmedAt  *time.Time `db:"confirmed_at"`
+	LastUsedStep int64      `db:"last_used_step"`
+}
+
+func (t TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	TwoFactorToken string `json:"two_factor_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// TOTPThrottleKey is the key of the counter of wrong TOTP and recovery codes of the user.
+func TOTPThrottleKey(userID uint) string {
+	return "totp:" + fmt.Sprint(userID)
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// Transaction is a ledger entry as seen by one of the users: Amount is negative for debits,
+// and Counterparty is the login of the other user of a transfer.
+type Transaction struct {
+	ID           uint            `db:"id" json:"id"`
+	Type         LedgerEntryType `db:"entry_type" json:"type"`
+	Amount       Amount          `db:"amount" json:"amount"`
+	OrderNumber  string          `db:"order_number" json:"order,omitempty"`
+	TransferID   uint            `db:"transfer_id" json:"transfer_id,omitempty"`
+	Counterparty string          `db:"counterparty" json:"counterparty,omitempty"`
+	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
+}
+
+// TransactionCursor is the position of a transaction in the history, which is ordered by
+// CreatedAt and ID, the latest first.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+func (t Transaction) Cursor() TransactionCursor {
+	return TransactionCursor{CreatedAt: t.CreatedAt, ID: t.ID}
+}
+
+// Before reports whether the transaction comes after the cursor in the history.
+func (c TransactionCursor) Before(t Transaction) bool {
+	return t.CreatedAt.Before(c.CreatedAt) || t.CreatedAt.Equal(c.CreatedAt) && t.ID < c.ID
+}
+
+// String encodes the cursor as an opaque token for clients.
+func (c TransactionCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt.UnixNano(), c.ID)))
+}
+
+func ParseTransactionCursor(s string) (TransactionCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return TransactionCursor{}, err
+	}
+	var nanos int64
+	var id uint
+	if _, err := fmt.Sscanf(string(b), "%d:%d", &nanos, &id); err != nil {
+		return TransactionCursor{}, err
+	}
+	return TransactionCursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// TransactionFilter selects the transactions of the user created in [From, To) that come after
+// the After cursor, up to Limit of them. Zero values do not restrict the selection.
+type TransactionFilter struct {
+	UserID uint
+	Types  []LedgerEntryType
+	From   time.Time
+	To     time.Time
+	After  *TransactionCursor
+	Limit  int
+}
+
+// TransactionsQuery is what the user asks GET /api/user/transactions for.
+type TransactionsQuery struct {
+	Types  []LedgerEntryType
+	From   time.Time
+	To     time.Time
+	Cursor string
+	Limit  int
+}
+
+// TransactionsPage is a page of the history; NextCursor is empty on the last page.
+type TransactionsPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,76 @@
+package model
+
+import "time"
+
+type TransferStatus string
+
+const (
+	// TransferStatusPending holds the points on the transfers account until the recipient accepts them.
+	TransferStatusPending   = TransferStatus("PENDING")
+	TransferStatusCompleted = TransferStatus("COMPLETED")
+	TransferStatusDeclined  = TransferStatus("DECLINED")
+	TransferStatusCancelled = TransferStatus("CANCELLED")
+)
+
+// Transfer confirmation policies: whether the recipient has to accept a transfer.
+const (
+	TransferConfirmationNever  = "never"
+	TransferConfirmationAlways = "always"
+	TransferConfirmationAbove  = "above"
+)
+
+// Transfer moves points from the balance of one user to another.
+type Transfer struct {
+	ID             uint           `db:"id" json:"id"`
+	SenderID       uint           `db:"sender_id" json:"-"`
+	SenderLogin    string         `db:"sender_login" json:"from"`
+	RecipientID    uint           `db:"recipient_id" json:"-"`
+	RecipientLogin string         `db:"recipient_login" json:"to"`
+	Amount         Amount         `db:"amount" json:"sum"`
+	Comment        string         `db:"comment" json:"comment,omitempty"`
+	Status         TransferStatus `db:"status" json:"status"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+	SettledAt      *time.Time     `db:"settled_at" json:"settled_at,omitempty"`
+}
+
+type TransferRequest struct {
+	To      string `json:"to" validate:"required"`
+	Amount  Amount `json:"sum" validate:"gt=0"`
+	Comment string `json:"comment" validate:"max=200"`
+}
+
+// TransferLimits restrict the transfers a user sends since Since. Zero Amount or Count means no limit.
+type TransferLimits struct {
+	Since  time.Time
+	Amount Amount
+	Count  int
+}
+
+// Exceeded reports whether one more transfer of amount breaks the limits, given the amount and
+// the number of transfers sent since l.Since.
+func (l TransferLimits) Exceeded(sent Amount, count int, amount Amount) bool {
+	return l.Amount > 0 && sent+amount > l.Amount || l.Count > 0 && count+1 > l.Count
+}
+
+// LedgerEntry moves the points of the transfer from its previous status to t.Status. A transfer
+// completed at once goes from the sender to the recipient, a pending one waits on the transfers
+// account, and a declined or cancelled one returns to the sender.
+func (t Transfer) LedgerEntry(previous TransferStatus) LedgerEntry {
+	entry := LedgerEntry{
+		Type:          LedgerEntryTransfer,
+		DebitAccount:  UserAccount(t.SenderID),
+		CreditAccount: UserAccount(t.RecipientID),
+		Amount:        t.Amount,
+		TransferID:    t.ID,
+	}
+	if t.Status == TransferStatusPending {
+		entry.CreditAccount = SystemAccountTransfers
+	}
+	if previous == TransferStatusPending {
+		entry.DebitAccount = SystemAccountTransfers
+		if t.Status != TransferStatusCompleted {
+			entry.CreditAccount = UserAccount(t.SenderID)
+		}
+	}
+	return entry
+}
@@ -4,10 +4,47 @@ import (
 	"time"
 )
 
+// Role grants access to the admin API: support staff may look users up, admins may also change roles.
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+	// RoleShop is the service account of the shop, it may only reverse withdrawals of cancelled orders
+	// and claw back accruals of returned ones.
+	RoleShop Role = "shop"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleSupport, RoleAdmin, RoleShop:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	ID        uint      `db:"id"`
 	Login     string    `db:"login" validate:"required"`
 	Password  string    `db:"password" validate:"required"`
-	Balance   float64   `db:"balance"`
+	Role      Role      `db:"role"`
+	Balance   Amount    `db:"balance"`
+	Debt      Amount    `db:"debt"` // left by a clawback the balance did not cover, paid off by the next credits
 	CreatedAt time.Time `db:"created_at"`
 }
+
+// UserInfo is what the admin API shows about a user.
+type UserInfo struct {
+	ID               uint      `json:"id"`
+	Login            string    `json:"login"`
+	Role             Role      `json:"role"`
+	Balance          Amount    `json:"balance"`
+	Withdrawn        Amount    `json:"withdrawn"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type SetRoleRequest struct {
+	Role Role `json:"role" validate:"required"`
+}
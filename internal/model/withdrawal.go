@@ -2,10 +2,20 @@ package model
 
 import "time"
 
+type WithdrawalState string
+
+const (
+	WithdrawalStateProcessed = WithdrawalState("PROCESSED")
+	// WithdrawalStateReversed is a withdrawal whose points were returned, e.g. because the order was cancelled.
+	WithdrawalStateReversed = WithdrawalState("REVERSED")
+)
+
 type Withdrawal struct {
-	ID          uint      `db:"id" json:"-"`
-	Amount      float64   `db:"amount" json:"sum"`
-	ProcessedAt time.Time `db:"processed_at" json:"processed_at"`
-	OrderNumber string    `db:"order_number" json:"order"`
-	UserID      uint      `db:"user_id" json:"-"`
+	ID          uint            `db:"id" json:"-"`
+	Amount      Amount          `db:"amount" json:"sum"`
+	ProcessedAt time.Time       `db:"processed_at" json:"processed_at"`
+	OrderNumber string          `db:"order_number" json:"order"`
+	UserID      uint            `db:"user_id" json:"-"`
+	Status      WithdrawalState `db:"status" json:"status"`
+	ReversedAt  *time.Time      `db:"reversed_at" json:"reversed_at,omitempty"`
 }
@@ -1,9 +1,12 @@
 package accrual
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -13,43 +16,71 @@ import (
 	"github.com/mrkovshik/yandex_diploma/internal/service/loyalty"
 )
 
+const (
+	requestTimeout    = 10 * time.Second
+	defaultRetryAfter = 60 * time.Second
+)
+
+var quotaRe = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
 type service struct {
 	address string
+	client  *resty.Client
+	limiter *rateLimiter
 }
 
-func NewAccrualService(address string) loyalty.AccrualService {
-	return service{
+// NewAccrualService returns a client whose requests share one rate limit.
+// requestsPerMinute <= 0 leaves requests unthrottled until the accrual system reports its quota.
+func NewAccrualService(address string, requestsPerMinute int) loyalty.AccrualService {
+	return &service{
 		address: address,
+		client:  resty.New().SetTimeout(requestTimeout),
+		limiter: newRateLimiter(requestsPerMinute),
 	}
 }
 
-func (s service) GetOrderAccrual(orderNumber string) (model.AccrualResponse, error) {
+func (s *service) GetOrderAccrual(ctx context.Context, orderNumber string) (model.AccrualResponse, error) {
 	var orderResponse model.AccrualResponse
+	if err := s.limiter.Wait(ctx); err != nil {
+		return model.AccrualResponse{}, err
+	}
 	serviceURL := fmt.Sprintf("%v/api/orders/%v", s.address, orderNumber)
-	client := resty.New()
-	client.SetRetryCount(3).
-		SetRetryWaitTime(60 * time.Second).
-		SetRetryMaxWaitTime(90 * time.Second).
-		SetRetryAfter(func(client *resty.Client, resp *resty.Response) (time.Duration, error) {
-			return 60 * time.Second, apperrors.ErrTooManyRetrials
-		})
-	client.AddRetryCondition(
-		func(r *resty.Response, err error) bool {
-			return r.StatusCode() == http.StatusTooManyRequests
-		},
-	)
-	resp, err := client.R().Get(serviceURL)
+	resp, err := s.client.R().SetContext(ctx).Get(serviceURL)
 	if err != nil {
 		return model.AccrualResponse{}, err
 	}
-	if resp.StatusCode() != http.StatusOK {
-		if resp.StatusCode() == http.StatusNoContent {
-			return model.AccrualResponse{}, apperrors.ErrNoSuchOrder
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return model.AccrualResponse{}, apperrors.ErrNoSuchOrder
+	case http.StatusTooManyRequests:
+		retryAfter := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now())
+		s.limiter.PauseFor(retryAfter)
+		if m := quotaRe.FindSubmatch(resp.Body()); m != nil {
+			if quota, err := strconv.Atoi(string(m[1])); err == nil {
+				s.limiter.SetRate(quota)
+			}
 		}
-		return model.AccrualResponse{}, fmt.Errorf("status code: %v", resp.StatusCode())
+		return model.AccrualResponse{}, fmt.Errorf("%w: retry after %v", apperrors.ErrTooManyRetrials, retryAfter)
+	default:
+		return model.AccrualResponse{}, fmt.Errorf("%w: %v", apperrors.ErrInvalidResponseCode, resp.StatusCode())
 	}
 	if err := json.Unmarshal(resp.Body(), &orderResponse); err != nil {
 		return model.AccrualResponse{}, err
 	}
 	return orderResponse, nil
 }
+
+// parseRetryAfter accepts both forms of the header: delay in seconds and HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
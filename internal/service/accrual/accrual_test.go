@@ -1,11 +1,13 @@
 package accrual
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -30,13 +32,15 @@ func Test_service_GetOrderScore(t *testing.T) {
 		case "/api/orders/456":
 			w.WriteHeader(http.StatusNoContent)
 		case "/api/orders/789":
+			w.Header().Set("Retry-After", "30")
 			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte("No more than 120 requests per minute allowed"))
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}))
 	defer mockServer.Close()
-	s := NewAccrualService(mockServer.URL)
+	s := NewAccrualService(mockServer.URL, 0)
 	tests := []struct {
 		name        string
 		orderNumber string
@@ -62,9 +66,48 @@ func Test_service_GetOrderScore(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.GetOrderAccrual(tt.orderNumber)
+			got, err := s.GetOrderAccrual(context.Background(), tt.orderNumber)
 			assert.Equal(t, tt.want, got)
 			assert.Equal(t, errors.Is(err, tt.err), true)
 		})
 	}
 }
+
+func Test_service_GetOrderAccrual_backsOffAfterTooManyRequests(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("No more than 120 requests per minute allowed"))
+	}))
+	defer mockServer.Close()
+	s := NewAccrualService(mockServer.URL, 0).(*service)
+
+	_, err := s.GetOrderAccrual(context.Background(), "123")
+	assert.ErrorIs(t, err, apperrors.ErrTooManyRetrials)
+	assert.Equal(t, float64(2), s.limiter.rate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = s.GetOrderAccrual(ctx, "123")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"seconds", "120", 2 * time.Minute},
+		{"http_date", now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"past_date", now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"empty", "", defaultRetryAfter},
+		{"garbage", "soon", defaultRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRetryAfter(tt.header, now))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every request to the accrual system.
+// A zero rate means the quota is not known yet and requests are not throttled,
+// but the bucket can still be paused after the accrual system answers 429.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens per second
+	burst       float64
+	tokens      float64
+	updatedAt   time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(requestsPerMinute int) *rateLimiter {
+	l := &rateLimiter{updatedAt: time.Now()}
+	l.SetRate(requestsPerMinute)
+	return l
+}
+
+// SetRate changes the quota to requestsPerMinute, evenly spread over the minute.
+func (l *rateLimiter) SetRate(requestsPerMinute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if requestsPerMinute <= 0 {
+		l.rate, l.burst = 0, 0
+		return
+	}
+	l.rate = float64(requestsPerMinute) / 60
+	l.burst = 1
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// PauseFor blocks all waiters for at least d.
+func (l *rateLimiter) PauseFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = 0
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait before trying again.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate == 0 {
+		return 0
+	}
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.updatedAt); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.updatedAt = now
+}
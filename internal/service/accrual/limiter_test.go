@@ -0,0 +1,37 @@
+package accrual
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rateLimiter_reserve(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(60)
+	l.updatedAt = now
+	l.tokens = 1
+
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Second, l.reserve(now))
+	assert.Equal(t, time.Duration(0), l.reserve(now.Add(time.Second)))
+}
+
+func Test_rateLimiter_unlimited(t *testing.T) {
+	l := newRateLimiter(0)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Wait(context.Background()))
+	}
+}
+
+func Test_rateLimiter_PauseFor(t *testing.T) {
+	l := newRateLimiter(0)
+	l.PauseFor(time.Hour)
+	assert.Greater(t, l.reserve(time.Now()), 59*time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx), context.DeadlineExceeded)
+}
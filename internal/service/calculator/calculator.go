@@ -0,0 +1,101 @@
+package calculator
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/api"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+type calculatorService struct {
+	storage Storage
+	logger  *zap.SugaredLogger
+}
+
+func NewCalculatorService(storage Storage, logger *zap.SugaredLogger) api.CalculatorService {
+	return &calculatorService{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+func (s *calculatorService) RegisterRewardRule(ctx context.Context, rule model.RewardRule) error {
+	return s.storage.AddRewardRule(ctx, rule)
+}
+
+func (s *calculatorService) RegisterOrder(ctx context.Context, order model.AccrualOrder) error {
+	order.Status = model.AccrualStateRegistered
+	return s.storage.AddOrder(ctx, order)
+}
+
+func (s *calculatorService) GetOrderAccrual(ctx context.Context, orderNumber string) (model.AccrualResponse, error) {
+	order, err := s.storage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		return model.AccrualResponse{}, err
+	}
+	return model.AccrualResponse{
+		Order:   order.OrderNumber,
+		Status:  order.Status,
+		Accrual: order.Accrual,
+	}, nil
+}
+
+func (s *calculatorService) ProcessRegisteredOrders(ctx context.Context) error {
+	orders, err := s.storage.GetRegisteredOrders(ctx)
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+	rules, err := s.storage.GetRewardRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		status, accrual := calculateAccrual(order.Goods, rules)
+		if err := s.storage.SetOrderResult(ctx, order.OrderNumber, status, accrual); err != nil {
+			return err
+		}
+		s.logger.Debugf("calculated order %v: state = %v, accrual = %v", order.OrderNumber, status, accrual)
+	}
+	return nil
+}
+
+// calculateAccrual applies the first matching rule to every item of the order.
+// An order without a single matching item is not eligible for any reward.
+func calculateAccrual(goods []model.OrderGoods, rules []model.RewardRule) (model.AccrualState, model.Amount) {
+	var (
+		total   model.Amount
+		matched bool
+	)
+	for _, item := range goods {
+		rule, ok := findRule(item.Description, rules)
+		if !ok {
+			continue
+		}
+		matched = true
+		switch rule.RewardType {
+		case model.RewardTypePercent:
+			total += item.Price.Percent(rule.Reward)
+		case model.RewardTypePoints:
+			total += rule.Reward
+		}
+	}
+	if !matched {
+		return model.AccrualStateInvalid, 0
+	}
+	return model.AccrualStateProcessed, total
+}
+
+func findRule(description string, rules []model.RewardRule) (model.RewardRule, bool) {
+	for _, rule := range rules {
+		if strings.Contains(description, rule.Match) {
+			return rule, true
+		}
+	}
+	return model.RewardRule{}, false
+}
@@ -0,0 +1,41 @@
+package calculator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_calculateAccrual(t *testing.T) {
+	rules := []model.RewardRule{
+		{ID: 1, Match: "Bork", Reward: 1000, RewardType: model.RewardTypePercent},
+		{ID: 2, Match: "LG", Reward: 50000, RewardType: model.RewardTypePoints},
+		{ID: 3, Match: "Bork Kettle", Reward: 100, RewardType: model.RewardTypePoints},
+	}
+	tests := []struct {
+		name        string
+		goods       []model.OrderGoods
+		wantStatus  model.AccrualState
+		wantAccrual model.Amount
+	}{
+		{"percent", []model.OrderGoods{{Description: "Чайник Bork", Price: 700000}}, model.AccrualStateProcessed, 70000},
+		{"points", []model.OrderGoods{{Description: "Телевизор LG", Price: 7000000}}, model.AccrualStateProcessed, 50000},
+		{"first_rule_wins", []model.OrderGoods{{Description: "Bork Kettle", Price: 100000}}, model.AccrualStateProcessed, 10000},
+		{"mixed", []model.OrderGoods{
+			{Description: "Чайник Bork", Price: 33333},
+			{Description: "Телевизор LG", Price: 7000000},
+			{Description: "Стиральная машинка Samsung", Price: 5000000},
+		}, model.AccrualStateProcessed, 53333},
+		{"no_match", []model.OrderGoods{{Description: "Стиральная машинка Samsung", Price: 5000000}}, model.AccrualStateInvalid, 0},
+		{"empty", nil, model.AccrualStateInvalid, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, accrual := calculateAccrual(tt.goods, rules)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantAccrual, accrual)
+		})
+	}
+}
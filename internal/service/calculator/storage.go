@@ -0,0 +1,16 @@
+package calculator
+
+import (
+	"context"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+type Storage interface {
+	AddRewardRule(ctx context.Context, rule model.RewardRule) error
+	GetRewardRules(ctx context.Context) ([]model.RewardRule, error)
+	AddOrder(ctx context.Context, order model.AccrualOrder) error
+	GetOrderByNumber(ctx context.Context, orderNumber string) (model.AccrualOrder, error)
+	GetRegisteredOrders(ctx context.Context) ([]model.AccrualOrder, error)
+	SetOrderResult(ctx context.Context, orderNumber string, status model.AccrualState, accrual model.Amount) error
+}
@@ -1,9 +1,11 @@
 package loyalty
 
 import (
+	"context"
+
 	"github.com/mrkovshik/yandex_diploma/internal/model"
 )
 
 type AccrualService interface {
-	GetOrderAccrual(orderNumber string) (model.AccrualResponse, error)
+	GetOrderAccrual(ctx context.Context, orderNumber string) (model.AccrualResponse, error)
 }
@@ -0,0 +1,110 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *basicService) GetUserInfo(ctx context.Context, userID uint) (model.UserInfo, error) {
+	user, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.UserInfo{}, err
+	}
+	return s.userInfo(ctx, user)
+}
+
+func (s *basicService) FindUserByLogin(ctx context.Context, login string) (model.UserInfo, error) {
+	user, err := s.storage.GetUserByLogin(ctx, login)
+	if err != nil {
+		return model.UserInfo{}, err
+	}
+	return s.userInfo(ctx, user)
+}
+
+// SetUserRole changes the role of the user on behalf of actorID. Sessions of the user are revoked,
+// so a demoted user can not keep using access tokens issued with the old role.
+func (s *basicService) SetUserRole(ctx context.Context, actorID, userID uint, role model.Role) error {
+	if !role.Valid() {
+		return apperrors.ErrInvalidRole
+	}
+	if actorID == userID {
+		return apperrors.ErrOwnRole
+	}
+	if err := s.storage.SetUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+	s.Logger.Infof("user %v set the role of user %v to %v", actorID, userID, role)
+	return s.storage.RevokeUserSessions(ctx, userID, "")
+}
+
+func (s *basicService) userInfo(ctx context.Context, user model.User) (model.UserInfo, error) {
+	withdrawn, err := s.storage.GetWithdrawalsSumByUserID(ctx, user.ID)
+	if err != nil {
+		return model.UserInfo{}, err
+	}
+	_, err = s.enabledTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, apperrors.ErrTOTPNotEnabled) {
+		return model.UserInfo{}, err
+	}
+	return model.UserInfo{
+		ID:               user.ID,
+		Login:            user.Login,
+		Role:             user.Role,
+		Balance:          user.Balance,
+		Withdrawn:        withdrawn,
+		TwoFactorEnabled: err == nil,
+		CreatedAt:        user.CreatedAt,
+	}, nil
+}
+
+// AdjustBalance credits (positive amount) or debits (negative amount) the user's balance on behalf
+// of operatorID. The adjustment is kept in the audit log together with the reason.
+// Operators can not adjust their own balance.
+func (s *basicService) AdjustBalance(ctx context.Context, operatorID, userID uint, amount model.Amount, reason string) (model.BalanceAdjustment, error) {
+	if amount == 0 {
+		return model.BalanceAdjustment{}, apperrors.ErrInvalidAmount
+	}
+	if operatorID == userID {
+		return model.BalanceAdjustment{}, apperrors.ErrOwnBalance
+	}
+	adjustment, err := s.storage.AdjustBalance(ctx, model.BalanceAdjustment{
+		UserID:     userID,
+		OperatorID: operatorID,
+		Amount:     amount,
+		Reason:     reason,
+	})
+	if err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	s.Logger.Infof("user %v adjusted the balance of user %v by %v: %v", operatorID, userID, amount, reason)
+	return adjustment, nil
+}
+
+func (s *basicService) ListBalanceAdjustments(ctx context.Context, userID uint) ([]model.BalanceAdjustment, error) {
+	return s.storage.GetBalanceAdjustments(ctx, userID)
+}
+
+// ReverseWithdrawal returns the points paid for a cancelled order, on behalf of actorID.
+func (s *basicService) ReverseWithdrawal(ctx context.Context, actorID uint, orderNumber string) (model.Withdrawal, error) {
+	withdrawal, err := s.storage.ReverseWithdrawal(ctx, orderNumber)
+	if err != nil {
+		return model.Withdrawal{}, err
+	}
+	s.Logger.Infof("user %v reversed the withdrawal of %v for order %v of user %v", actorID, withdrawal.Amount, orderNumber, withdrawal.UserID)
+	return withdrawal, nil
+}
+
+// ClawbackOrder takes back the points accrued for a refunded order, on behalf of actorID.
+// With cfg.ClawbackAllowDebt what the balance does not cover becomes the user's debt, otherwise the clawback
+// fails with apperrors.ErrNotEnoughFunds if the points are already spent.
+func (s *basicService) ClawbackOrder(ctx context.Context, actorID uint, orderNumber string) (model.Order, error) {
+	order, err := s.storage.ClawbackOrder(ctx, orderNumber, s.cfg.ClawbackAllowDebt)
+	if err != nil {
+		return model.Order{}, err
+	}
+	s.Logger.Infof("user %v clawed back the accrual of %v for order %v of user %v", actorID, order.Accrual, orderNumber, order.UserID)
+	return order, nil
+}
@@ -0,0 +1,142 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_SetUserRole(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{TokenExp: 3, AccessTokenTTL: time.Minute})
+	claimsOf := func(tokens model.AuthTokens) auth.Claims {
+		claims, err := s.auth.ValidateToken(tokens.AccessToken)
+		require.NoError(t, err)
+		return claims
+	}
+
+	admin, err := s.Register(ctx, "admin", "password", "")
+	require.NoError(t, err)
+	adminID := claimsOf(admin).UserID
+	assert.Equal(t, model.RoleUser, claimsOf(admin).Role)
+	assert.ErrorIs(t, s.SetUserRole(ctx, adminID, adminID, model.RoleAdmin), apperrors.ErrOwnRole)
+
+	user, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	userID := claimsOf(user).UserID
+	assert.ErrorIs(t, s.SetUserRole(ctx, adminID, userID, "root"), apperrors.ErrInvalidRole)
+	assert.ErrorIs(t, s.SetUserRole(ctx, adminID, userID+100, model.RoleSupport), sql.ErrNoRows)
+	require.NoError(t, s.SetUserRole(ctx, adminID, userID, model.RoleSupport))
+
+	// the old session is gone, a new one carries the new role
+	_, err = s.RefreshToken(ctx, user.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+	user, err = s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleSupport, claimsOf(user).Role)
+
+	info, err := s.FindUserByLogin(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, model.UserInfo{
+		ID:        userID,
+		Login:     "user",
+		Role:      model.RoleSupport,
+		CreatedAt: info.CreatedAt,
+	}, info)
+	_, err = s.GetUserInfo(ctx, userID+100)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func Test_basicService_AdjustBalance(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{})
+	userID, err := s.storage.AddUser(ctx, "user", "hash")
+	require.NoError(t, err)
+	operatorID, err := s.storage.AddUser(ctx, "support", "hash")
+	require.NoError(t, err)
+
+	_, err = s.AdjustBalance(ctx, operatorID, userID, 0, "nothing")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidAmount)
+	_, err = s.AdjustBalance(ctx, operatorID, operatorID, 25000, "a raise")
+	assert.ErrorIs(t, err, apperrors.ErrOwnBalance)
+	_, err = s.AdjustBalance(ctx, operatorID, userID, -100, "debit first")
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+	adjustment, err := s.AdjustBalance(ctx, operatorID, userID, 25000, "compensation for a lost order")
+	require.NoError(t, err)
+	assert.Equal(t, operatorID, adjustment.OperatorID)
+
+	balance, err := s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(25000), balance.Balance)
+	adjustments, err := s.ListBalanceAdjustments(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []model.BalanceAdjustment{adjustment}, adjustments)
+	discrepancies, err := s.storage.GetBalanceDiscrepancies(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, discrepancies)
+}
+
+func Test_basicService_ReverseWithdrawal(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{})
+	userID, err := s.storage.AddUser(ctx, "user", "hash")
+	require.NoError(t, err)
+	shopID, err := s.storage.AddUser(ctx, "shop", "hash")
+	require.NoError(t, err)
+	_, err = s.AdjustBalance(ctx, shopID, userID, 50000, "opening balance")
+	require.NoError(t, err)
+	require.NoError(t, s.Withdraw(ctx, model.Withdrawal{Amount: 20000, OrderNumber: "2377225624", UserID: userID}, ""))
+
+	withdrawal, err := s.ReverseWithdrawal(ctx, shopID, "2377225624")
+	require.NoError(t, err)
+	assert.Equal(t, model.WithdrawalStateReversed, withdrawal.Status)
+	_, err = s.ReverseWithdrawal(ctx, shopID, "2377225624")
+	assert.ErrorIs(t, err, apperrors.ErrWithdrawalAlreadyReversed)
+
+	balance, err := s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.GetBalanceResponse{Balance: 50000, Withdrawn: 0}, balance)
+	withdrawals, err := s.ListUserWithdrawals(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, model.WithdrawalStateReversed, withdrawals[0].Status)
+	assert.NotNil(t, withdrawals[0].ReversedAt)
+}
+
+func Test_basicService_ClawbackOrder(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+	s := newTestService(t, cfg)
+	userID, err := s.storage.AddUser(ctx, "user", "hash")
+	require.NoError(t, err)
+	shopID, err := s.storage.AddUser(ctx, "shop", "hash")
+	require.NoError(t, err)
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "12345678903"))
+	require.NoError(t, s.storage.FinalizeOrderAndUpdateBalance(ctx, "12345678903", 50000, 0))
+	require.NoError(t, s.Withdraw(ctx, model.Withdrawal{Amount: 20000, OrderNumber: "2377225624", UserID: userID}, ""))
+
+	_, err = s.ClawbackOrder(ctx, shopID, "12345678903")
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+
+	cfg.ClawbackAllowDebt = true
+	order, err := s.ClawbackOrder(ctx, shopID, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStateReversed, order.Status)
+
+	balance, err := s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.GetBalanceResponse{Balance: 0, Withdrawn: 20000, Debt: 20000}, balance)
+	orders, err := s.GetUserOrders(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, model.OrderStateReversed, orders[0].Status)
+}
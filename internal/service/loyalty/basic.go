@@ -16,57 +16,97 @@ import (
 	"github.com/mrkovshik/yandex_diploma/internal/service"
 )
 
-const workersQty = 2
-
 type (
 	basicService struct {
-		storage service.Storage
-		cfg     *config.Config
-		accrual AccrualService
-		Logger  *zap.SugaredLogger
+		storage  service.Storage
+		cfg      *config.Config
+		accrual  AccrualService
+		auth     *auth.Service
+		notifier Notifier
+		Logger   *zap.SugaredLogger
 	}
 )
 
-func NewBasicService(storage service.Storage, accrual AccrualService, cfg *config.Config, logger *zap.SugaredLogger) api.Service {
+func NewBasicService(storage service.Storage, accrual AccrualService, authSrv *auth.Service, notifier Notifier, cfg *config.Config, logger *zap.SugaredLogger) api.Service {
 	return &basicService{
-		storage: storage,
-		accrual: accrual,
-		cfg:     cfg,
-		Logger:  logger,
+		storage:  storage,
+		accrual:  accrual,
+		auth:     authSrv,
+		notifier: notifier,
+		cfg:      cfg,
+		Logger:   logger,
 	}
 }
 
-func (s *basicService) Register(ctx context.Context, login, password string) (string, error) {
+// Register creates the user. A non-empty referralCode must belong to an existing user, who then
+// becomes the referrer of the new one.
+func (s *basicService) Register(ctx context.Context, login, password, referralCode string) (model.AuthTokens, error) {
+	var referrerID uint
+	if referralCode != "" {
+		var err error
+		if referrerID, err = s.referrerByCode(ctx, referralCode); err != nil {
+			return model.AuthTokens{}, err
+		}
+	}
 	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		return "", err
+		return model.AuthTokens{}, err
 	}
 	userID, err := s.storage.AddUser(ctx, login, hashedPassword)
 	if err != nil {
-		return "", err
+		return model.AuthTokens{}, err
 	}
-	authSrv := auth.NewAuthService(s.cfg.SecretKey, s.cfg.TokenExp)
-	token, err := authSrv.GenerateToken(userID)
-	if err != nil {
-		return "", err
+	if referrerID != 0 {
+		s.registerReferral(ctx, userID, referrerID)
 	}
-	return token, nil
+	return s.startSession(ctx, userID, model.RoleUser)
 }
 
-func (s *basicService) Login(ctx context.Context, login, password string) (string, error) {
+// Login checks the password unless the login or the client IP are blocked after too many
+// failures, in which case it fails with a *apperrors.RetryAfterError. Users with two-factor
+// authentication enabled only get a token for LoginTwoFactor.
+func (s *basicService) Login(ctx context.Context, login, password, ip string) (model.AuthTokens, error) {
+	throttles := s.loginThrottles(login, ip)
+	if err := s.checkLoginBlocked(ctx, throttles); err != nil {
+		return model.AuthTokens{}, err
+	}
+	failures, err := s.chargeLoginAttempt(ctx, throttles)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
 	user, err := s.storage.GetUserByLogin(ctx, login)
+	if err == nil && !checkPasswordHash(password, user.Password) {
+		err = apperrors.ErrInvalidPassword
+	}
 	if err != nil {
-		return "", err
+		if errors.Is(err, apperrors.ErrInvalidPassword) || errors.Is(err, sql.ErrNoRows) {
+			if err := s.recordLoginFailure(ctx, throttles, failures); err != nil {
+				return model.AuthTokens{}, err
+			}
+		}
+		return model.AuthTokens{}, err
 	}
-	if !checkPasswordHash(password, user.Password) {
-		return "", apperrors.ErrInvalidPassword
+	if err := s.storage.ResetLoginAttempts(ctx, model.LoginThrottleKey(login)); err != nil {
+		return model.AuthTokens{}, err
 	}
-	authSrv := auth.NewAuthService(s.cfg.SecretKey, s.cfg.TokenExp)
-	token, err := authSrv.GenerateToken(user.ID)
+	if ip != "" {
+		// other logins behind the same address keep their failures
+		if err := s.storage.ForgetLoginFailure(ctx, model.IPThrottleKey(ip)); err != nil {
+			return model.AuthTokens{}, err
+		}
+	}
+	_, err = s.enabledTOTP(ctx, user.ID)
+	switch {
+	case errors.Is(err, apperrors.ErrTOTPNotEnabled):
+		return s.startSession(ctx, user.ID, user.Role)
+	case err != nil:
+		return model.AuthTokens{}, err
+	}
+	token, err := s.auth.GenerateTwoFactorToken(user.ID, s.cfg.TwoFactorTokenTTL)
 	if err != nil {
-		return "", err
+		return model.AuthTokens{}, err
 	}
-	return token, nil
+	return model.AuthTokens{TwoFactorToken: token}, nil
 }
 
 func (s *basicService) UploadOrder(ctx context.Context, orderNumber string, userID uint) (bool, error) {
@@ -76,10 +116,14 @@ func (s *basicService) UploadOrder(ctx context.Context, orderNumber string, user
 		if !errors.Is(err, sql.ErrNoRows) {
 			return false, err
 		}
-		if err := s.storage.UploadOrder(ctx, userID, orderNumber); err != nil {
+		err = s.storage.UploadOrder(ctx, userID, orderNumber)
+		if !errors.Is(err, apperrors.ErrOrderAlreadyUploaded) {
+			return false, err
+		}
+		// uploaded concurrently by another request, look up who owns it
+		if order, err = s.storage.GetOrderByNumber(ctx, orderNumber); err != nil {
 			return false, err
 		}
-		return false, nil
 	}
 
 	if order.UserID != userID {
@@ -89,7 +133,7 @@ func (s *basicService) UploadOrder(ctx context.Context, orderNumber string, user
 }
 
 func (s *basicService) UpdateOrderAccrual(ctx context.Context, orderNumber string) error {
-	res, err := s.accrual.GetOrderAccrual(orderNumber)
+	res, err := s.accrual.GetOrderAccrual(ctx, orderNumber)
 	if err != nil {
 		return err
 	}
@@ -105,10 +149,17 @@ func (s *basicService) UpdateOrderAccrual(ctx context.Context, orderNumber strin
 		}
 		s.Logger.Debugf("updated order %v state = PROCESSING", orderNumber)
 	case model.AccrualStateProcessed:
-		if err := s.storage.FinalizeOrderAndUpdateBalance(ctx, orderNumber, res.Accrual); err != nil {
+		tierBonus, err := s.tierBonus(ctx, orderNumber, res.Accrual)
+		if err != nil {
 			return err
 		}
-		s.Logger.Debugf("updated order %v with amount = %v and state = PROCESSED", orderNumber, res.Accrual)
+		if err := s.storage.FinalizeOrderAndUpdateBalance(ctx, orderNumber, res.Accrual, tierBonus); err != nil {
+			return err
+		}
+		s.Logger.Debugf("updated order %v with amount = %v, tier bonus = %v and state = PROCESSED", orderNumber, res.Accrual, tierBonus)
+		if err := s.settleOrderBonuses(ctx, orderNumber); err != nil {
+			s.Logger.Errorf("failed to credit the bonuses of order %v, will retry: %v", orderNumber, err)
+		}
 	default:
 		return errors.New("invalid accrual state")
 	}
@@ -116,23 +167,6 @@ func (s *basicService) UpdateOrderAccrual(ctx context.Context, orderNumber strin
 	return nil
 }
 
-func (s *basicService) UpdatePendingOrders(ctx context.Context) error {
-	s.Logger.Debug("updating orders started")
-	orders, err := s.storage.GetPendingOrders(ctx)
-	if err != nil {
-		return err
-	}
-	jobs := make(chan string, len(orders))
-	for w := 1; w <= workersQty; w++ {
-		go s.worker(ctx, w, jobs)
-	}
-	for _, id := range orders {
-		jobs <- id
-	}
-	close(jobs)
-	return nil
-}
-
 func (s *basicService) GetUserOrders(ctx context.Context, userID uint) ([]model.Order, error) {
 	orders, err := s.storage.GetOrdersByUserID(ctx, userID)
 	if err != nil {
@@ -141,7 +175,12 @@ func (s *basicService) GetUserOrders(ctx context.Context, userID uint) ([]model.
 	return orders, nil
 }
 
-func (s *basicService) Withdraw(ctx context.Context, withdrawal model.Withdrawal) error {
+func (s *basicService) Withdraw(ctx context.Context, withdrawal model.Withdrawal, totpCode string) error {
+	if s.cfg.WithdrawRequireTOTP {
+		if err := s.checkWithdrawalTOTP(ctx, withdrawal.UserID, totpCode); err != nil {
+			return err
+		}
+	}
 	if err := s.storage.ProcessWithdrawal(ctx, withdrawal); err != nil {
 		return err
 	}
@@ -157,10 +196,15 @@ func (s *basicService) GetBalance(ctx context.Context, userID uint) (model.GetBa
 	if err1 != nil {
 		return model.GetBalanceResponse{}, err1
 	}
-	return model.GetBalanceResponse{
+	balance := model.GetBalanceResponse{
 		Balance:   user.Balance,
 		Withdrawn: withdrawn,
-	}, nil
+		Debt:      user.Debt,
+	}
+	if err := s.expiringPoints(ctx, userID, &balance); err != nil {
+		return model.GetBalanceResponse{}, err
+	}
+	return balance, nil
 }
 
 func (s *basicService) ListUserWithdrawals(ctx context.Context, userID uint) ([]model.Withdrawal, error) {
@@ -181,13 +225,3 @@ func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
-
-func (s *basicService) worker(ctx context.Context, workerID int, jobs <-chan string) {
-	for orderNumber := range jobs {
-
-		if err := s.UpdateOrderAccrual(ctx, orderNumber); err != nil {
-			s.Logger.Errorf("failed to update order #%v by worker #%v: %v", orderNumber, workerID, err)
-			return
-		}
-	}
-}
@@ -0,0 +1,92 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/memory"
+)
+
+// newTestService returns a service over a fresh memory storage that signs tokens with a test key.
+func newTestService(t *testing.T, cfg *config.Config) *basicService {
+	keys, err := auth.NewKeySet(auth.NewHMACKey([]byte("secret")))
+	require.NoError(t, err)
+	return &basicService{
+		storage: memory.NewStorage(),
+		auth:    auth.NewAuthService(keys, cfg.AccessTokenTTL),
+		cfg:     cfg,
+		Logger:  zap.NewNop().Sugar(),
+	}
+}
+
+func Test_basicService_memoryStorage(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:         3,
+		AccessTokenTTL:   time.Minute,
+		AccrualInterval:  10 * time.Second,
+		AccrualLeaseTime: time.Minute,
+		AccrualBatchSize: 5,
+	}
+	accrual := stubAccrual{
+		"12345678903": {Order: "12345678903", Status: model.AccrualStateProcessed, Accrual: 50050},
+		"79927398713": {Order: "79927398713", Status: model.AccrualStateInvalid},
+	}
+	s := newTestService(t, cfg)
+	s.accrual = accrual
+
+	_, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	_, err = s.Register(ctx, "user", "password", "")
+	assert.ErrorIs(t, err, apperrors.ErrUserAlreadyExists)
+	_, err = s.Login(ctx, "user", "wrong", "")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+	_, err = s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	user, err := s.storage.GetUserByLogin(ctx, "user")
+	require.NoError(t, err)
+
+	for _, orderNumber := range []string{"12345678903", "79927398713"} {
+		uploaded, err := s.UploadOrder(ctx, orderNumber, user.ID)
+		require.NoError(t, err)
+		assert.False(t, uploaded)
+	}
+	uploaded, err := s.UploadOrder(ctx, "12345678903", user.ID)
+	require.NoError(t, err)
+	assert.True(t, uploaded)
+	_, err = s.UploadOrder(ctx, "12345678903", user.ID+1)
+	assert.ErrorIs(t, err, apperrors.ErrOrderIsUploadedByAnotherUser)
+
+	require.NoError(t, s.processLeasedOrders(ctx, 1))
+	orders, err := s.GetUserOrders(ctx, user.ID)
+	require.NoError(t, err)
+	statuses := map[string]model.OrderState{}
+	for _, o := range orders {
+		statuses[o.OrderNumber] = o.Status
+	}
+	assert.Equal(t, map[string]model.OrderState{
+		"12345678903": model.OrderStateProcessed,
+		"79927398713": model.OrderStateInvalid,
+	}, statuses)
+
+	require.NoError(t, s.Withdraw(ctx, model.Withdrawal{Amount: 30000, OrderNumber: "2377225624", UserID: user.ID}, ""))
+	err = s.Withdraw(ctx, model.Withdrawal{Amount: 30000, OrderNumber: "2377225625", UserID: user.ID}, "")
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+
+	balance, err := s.GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.GetBalanceResponse{Balance: 20050, Withdrawn: 30000}, balance)
+	withdrawals, err := s.ListUserWithdrawals(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "2377225624", withdrawals[0].OrderNumber)
+}
@@ -0,0 +1,126 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// CreateCampaign starts a campaign on behalf of actorID. A campaign must grant some bonus,
+// and its tiers and users must exist.
+func (s *basicService) CreateCampaign(ctx context.Context, actorID uint, request model.CampaignRequest) (model.Campaign, error) {
+	if request.BonusPercent <= 0 && request.BonusPoints <= 0 {
+		return model.Campaign{}, fmt.Errorf("%w: no bonus", apperrors.ErrInvalidCampaign)
+	}
+	if !request.EndsAt.After(request.StartsAt) {
+		return model.Campaign{}, fmt.Errorf("%w: the campaign ends before it starts", apperrors.ErrInvalidCampaign)
+	}
+	var tiers model.Tiers
+	for _, tier := range request.Tiers {
+		if !tier.Valid() {
+			return model.Campaign{}, fmt.Errorf("%w: unknown tier %q", apperrors.ErrInvalidCampaign, tier)
+		}
+		if !tiers.Contain(tier) {
+			tiers = append(tiers, tier)
+		}
+	}
+	var userIDs []uint
+	seen := make(map[uint]bool)
+	for _, userID := range request.UserIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		if _, err := s.storage.GetUserByID(ctx, userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.Campaign{}, fmt.Errorf("%w: unknown user %v", apperrors.ErrInvalidCampaign, userID)
+			}
+			return model.Campaign{}, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	campaign, err := s.storage.AddCampaign(ctx, model.Campaign{
+		Name:         request.Name,
+		StartsAt:     request.StartsAt,
+		EndsAt:       request.EndsAt,
+		BonusPercent: request.BonusPercent,
+		BonusPoints:  request.BonusPoints,
+		Tiers:        tiers,
+		UserIDs:      userIDs,
+		PerUserCap:   request.PerUserCap,
+		CreatedBy:    actorID,
+	})
+	if err != nil {
+		return model.Campaign{}, err
+	}
+	s.Logger.Infof("user %v created campaign %v %q", actorID, campaign.ID, campaign.Name)
+	return campaign, nil
+}
+
+func (s *basicService) GetCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	return s.storage.GetCampaigns(ctx)
+}
+
+func (s *basicService) GetCampaign(ctx context.Context, id uint) (model.Campaign, error) {
+	return s.storage.GetCampaign(ctx, id)
+}
+
+// EndCampaign stops the campaign on behalf of actorID: orders uploaded from now on get no bonus.
+// Bonuses that are already credited stay with the users.
+func (s *basicService) EndCampaign(ctx context.Context, actorID, id uint) (model.Campaign, error) {
+	campaign, err := s.storage.EndCampaign(ctx, id, time.Now())
+	if err != nil {
+		return model.Campaign{}, err
+	}
+	s.Logger.Infof("user %v ended campaign %v %q", actorID, campaign.ID, campaign.Name)
+	return campaign, nil
+}
+
+// applyCampaigns credits the bonuses of the campaigns that were active when the processed order was
+// uploaded and that its owner is eligible for. Bonuses are a share of the accrual reported by the
+// accrual system, so orders without an accrual get none.
+func (s *basicService) applyCampaigns(ctx context.Context, orderNumber string) error {
+	if !s.cfg.CampaignsEnabled {
+		return nil
+	}
+	order, err := s.storage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		return err
+	}
+	if order.Status != model.OrderStateProcessed || order.Accrual <= 0 {
+		return nil
+	}
+	campaigns, err := s.storage.GetActiveCampaigns(ctx, order.UploadedAt)
+	if err != nil || len(campaigns) == 0 {
+		return err
+	}
+	level, _, err := s.userLevel(ctx, order.UserID)
+	if err != nil {
+		return err
+	}
+	for _, campaign := range campaigns {
+		if !campaign.Eligible(order.UserID, level.Tier) {
+			continue
+		}
+		credited, err := s.storage.AddCampaignBonus(ctx, model.CampaignBonus{
+			CampaignID:  campaign.ID,
+			UserID:      order.UserID,
+			OrderNumber: orderNumber,
+			Amount:      campaign.Bonus(order.Accrual),
+		}, campaign.PerUserCap)
+		if err != nil {
+			return err
+		}
+		if credited > 0 {
+			s.Logger.Infof("campaign %v credited %v to user %v for order %v", campaign.ID, credited, order.UserID, orderNumber)
+		}
+	}
+	return nil
+}
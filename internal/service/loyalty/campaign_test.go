@@ -0,0 +1,153 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+func Test_basicService_campaigns(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{
+		CampaignsEnabled:     true,
+		TierSilverPoints:     1000,
+		TierSilverMultiplier: 1,
+		TierGoldPoints:       5000,
+		TierGoldMultiplier:   1,
+	})
+	s.accrual = stubAccrual{
+		"12345678903": {Order: "12345678903", Status: model.AccrualStateProcessed, Accrual: 10000},
+		"79927398713": {Order: "79927398713", Status: model.AccrualStateProcessed, Accrual: 10000},
+		"2377225624":  {Order: "2377225624", Status: model.AccrualStateProcessed, Accrual: 10000},
+		"49927398716": {Order: "49927398716", Status: model.AccrualStateProcessed},
+	}
+	aliceID, err := s.storage.AddUser(ctx, "alice", "hash")
+	require.NoError(t, err)
+	bobID, err := s.storage.AddUser(ctx, "bob", "hash")
+	require.NoError(t, err)
+	require.NoError(t, s.storage.ReplaceUserTiers(ctx, []model.UserTier{{UserID: aliceID, Tier: model.TierGold, Points: 500000, UpdatedAt: time.Now()}}))
+
+	now := time.Now()
+	request := model.CampaignRequest{Name: "invalid", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	_, err = s.CreateCampaign(ctx, aliceID, request)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCampaign)
+	request.BonusPoints = 100
+	request.Tiers = model.Tiers{"platinum"}
+	_, err = s.CreateCampaign(ctx, aliceID, request)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCampaign)
+	request.Tiers = nil
+	request.UserIDs = []uint{bobID + 100}
+	_, err = s.CreateCampaign(ctx, aliceID, request)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidCampaign)
+
+	gold, err := s.CreateCampaign(ctx, aliceID, model.CampaignRequest{
+		Name:         "gold",
+		StartsAt:     now.Add(-time.Hour),
+		EndsAt:       now.Add(time.Hour),
+		BonusPercent: model.AmountFromFloat(10),
+		BonusPoints:  model.AmountFromFloat(5),
+		Tiers:        model.Tiers{model.TierGold, model.TierGold},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.Tiers{model.TierGold}, gold.Tiers)
+	bob, err := s.CreateCampaign(ctx, aliceID, model.CampaignRequest{
+		Name:        "bob",
+		StartsAt:    now.Add(-time.Hour),
+		EndsAt:      now.Add(time.Hour),
+		BonusPoints: model.AmountFromFloat(100),
+		UserIDs:     []uint{bobID, bobID},
+		PerUserCap:  model.AmountFromFloat(150),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{bobID}, bob.UserIDs)
+
+	require.NoError(t, s.storage.UploadOrder(ctx, aliceID, "12345678903"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "12345678903"))
+	for _, number := range []string{"79927398713", "2377225624", "49927398716"} {
+		require.NoError(t, s.storage.UploadOrder(ctx, bobID, number))
+		require.NoError(t, s.UpdateOrderAccrual(ctx, number))
+	}
+	// a stale worker finishing the order again credits no bonus twice
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "79927398713"))
+
+	// alice: 100 points of accrual, 10% and 5 points of the gold campaign
+	// bob: 2 x 100 points of accrual and 150 of 2 x 100 points of his campaign, nothing for an order without accrual
+	for userID, balance := range map[uint]float64{aliceID: 115, bobID: 350} {
+		user, err := s.storage.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, model.AmountFromFloat(balance), user.Balance)
+		ledgerBalance, err := s.storage.GetBalanceAt(ctx, userID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, model.AmountFromFloat(balance), ledgerBalance)
+	}
+
+	ended, err := s.EndCampaign(ctx, aliceID, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AmountFromFloat(150), ended.Granted)
+	assert.False(t, ended.ActiveAt(time.Now()))
+	campaigns, err := s.GetCampaigns(ctx)
+	require.NoError(t, err)
+	assert.Len(t, campaigns, 2)
+	campaign, err := s.GetCampaign(ctx, gold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AmountFromFloat(15), campaign.Granted)
+}
+
+// flakyCampaignStorage fails the first campaign bonus it is asked to credit.
+type flakyCampaignStorage struct {
+	service.Storage
+	failed bool
+}
+
+func (s *flakyCampaignStorage) AddCampaignBonus(ctx context.Context, bonus model.CampaignBonus, perUserCap model.Amount) (model.Amount, error) {
+	if !s.failed {
+		s.failed = true
+		return 0, errors.New("connection reset")
+	}
+	return s.Storage.AddCampaignBonus(ctx, bonus, perUserCap)
+}
+
+func Test_basicService_campaigns_retry(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{CampaignsEnabled: true, AccrualBatchSize: 5})
+	s.storage = &flakyCampaignStorage{Storage: s.storage}
+	s.accrual = stubAccrual{"12345678903": {Order: "12345678903", Status: model.AccrualStateProcessed, Accrual: 10000}}
+	userID, err := s.storage.AddUser(ctx, "alice", "hash")
+	require.NoError(t, err)
+	now := time.Now()
+	_, err = s.CreateCampaign(ctx, userID, model.CampaignRequest{
+		Name:        "all",
+		StartsAt:    now.Add(-time.Hour),
+		EndsAt:      now.Add(time.Hour),
+		BonusPoints: model.AmountFromFloat(5),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "12345678903"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "12345678903"))
+	user, err := s.storage.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AmountFromFloat(100), user.Balance)
+	pending, err := s.storage.GetOrdersWithPendingBonuses(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12345678903"}, pending)
+
+	// the retry credits the bonus once, however many times it runs
+	require.NoError(t, s.settlePendingBonuses(ctx))
+	require.NoError(t, s.settlePendingBonuses(ctx))
+	user, err = s.storage.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AmountFromFloat(105), user.Balance)
+	pending, err = s.storage.GetOrdersWithPendingBonuses(ctx, 5)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,83 @@
+package loyalty
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const pointsExpiryBatchSize = 100
+
+// ExpirePoints expires points accrued more than cfg.PointsExpiryMonths months ago every
+// cfg.PointsExpiryInterval until ctx is cancelled. It returns at once if points never expire.
+func (s *basicService) ExpirePoints(ctx context.Context) {
+	if s.cfg.PointsExpiryMonths <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.PointsExpiryInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.expirePoints(ctx, time.Now().UTC()); err != nil {
+			s.Logger.Errorf("failed to expire points: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expirePoints expires all points that are due at now. A user whose points fail to expire is logged
+// and left for the next run, it does not hold up the others.
+func (s *basicService) expirePoints(ctx context.Context, now time.Time) error {
+	accruedBefore := s.expiryCutoff(now)
+	var afterUserID uint
+	for {
+		userIDs, err := s.storage.GetUsersWithExpiredPoints(ctx, accruedBefore, afterUserID, pointsExpiryBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return nil
+		}
+		for _, userID := range userIDs {
+			expired, err := s.storage.ExpirePoints(ctx, userID, accruedBefore)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				s.Logger.Errorf("failed to expire points of user %v: %v", userID, err)
+				continue
+			}
+			s.Logger.Infof("%v points of user %v expired", expired, userID)
+		}
+		afterUserID = userIDs[len(userIDs)-1]
+	}
+}
+
+// expiringPoints reports the points of the user that expire within cfg.PointsExpiryWarning.
+func (s *basicService) expiringPoints(ctx context.Context, userID uint, balance *model.GetBalanceResponse) error {
+	if s.cfg.PointsExpiryMonths <= 0 {
+		return nil
+	}
+	lots, err := s.storage.GetPointLots(ctx, userID, s.expiryCutoff(time.Now().UTC().Add(s.cfg.PointsExpiryWarning)))
+	if err != nil {
+		return err
+	}
+	if len(lots) == 0 {
+		return nil
+	}
+	for _, lot := range lots {
+		balance.Expiring += lot.Remaining
+	}
+	expiringAt := lots[0].AccruedAt.AddDate(0, s.cfg.PointsExpiryMonths, 0)
+	balance.ExpiringAt = &expiringAt
+	return nil
+}
+
+// expiryCutoff returns the accrual time of the points that expire at t.
+func (s *basicService) expiryCutoff(t time.Time) time.Time {
+	return t.AddDate(0, -s.cfg.PointsExpiryMonths, 0)
+}
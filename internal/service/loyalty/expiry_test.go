@@ -0,0 +1,87 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+func Test_basicService_expirePoints(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{PointsExpiryMonths: 12, PointsExpiryWarning: 30 * 24 * time.Hour}
+	s := newTestService(t, cfg)
+	userID, err := s.storage.AddUser(ctx, "user", "hash")
+	require.NoError(t, err)
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "12345678903"))
+	require.NoError(t, s.storage.FinalizeOrderAndUpdateBalance(ctx, "12345678903", 50000, 0))
+	require.NoError(t, s.Withdraw(ctx, model.Withdrawal{Amount: 20000, OrderNumber: "2377225624", UserID: userID}, ""))
+	accruedAt := time.Now().UTC()
+
+	balance, err := s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.GetBalanceResponse{Balance: 30000, Withdrawn: 20000}, balance)
+
+	cfg.PointsExpiryWarning = 366 * 24 * time.Hour
+	balance, err = s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(30000), balance.Expiring)
+	require.NotNil(t, balance.ExpiringAt)
+	assert.WithinDuration(t, accruedAt.AddDate(1, 0, 0), *balance.ExpiringAt, time.Minute)
+
+	require.NoError(t, s.expirePoints(ctx, time.Now().UTC()))
+	balance, err = s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(30000), balance.Balance)
+
+	require.NoError(t, s.expirePoints(ctx, time.Now().UTC().AddDate(1, 0, 1)))
+	balance, err = s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.GetBalanceResponse{Balance: 0, Withdrawn: 20000}, balance)
+	discrepancies, err := s.storage.GetBalanceDiscrepancies(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, discrepancies)
+}
+
+// brokenExpiryStorage fails to expire the points of one user.
+type brokenExpiryStorage struct {
+	service.Storage
+	userID uint
+}
+
+func (s *brokenExpiryStorage) ExpirePoints(ctx context.Context, userID uint, accruedBefore time.Time) (model.Amount, error) {
+	if userID == s.userID {
+		return 0, errors.New("deadlock detected")
+	}
+	return s.Storage.ExpirePoints(ctx, userID, accruedBefore)
+}
+
+func Test_basicService_expirePoints_failedUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{PointsExpiryMonths: 12})
+	var userIDs []uint
+	for i, order := range []string{"12345678903", "79927398713"} {
+		userID, err := s.storage.AddUser(ctx, fmt.Sprintf("user%d", i), "hash")
+		require.NoError(t, err)
+		require.NoError(t, s.storage.UploadOrder(ctx, userID, order))
+		require.NoError(t, s.storage.FinalizeOrderAndUpdateBalance(ctx, order, 10000, 0))
+		userIDs = append(userIDs, userID)
+	}
+	s.storage = &brokenExpiryStorage{Storage: s.storage, userID: userIDs[0]}
+
+	require.NoError(t, s.expirePoints(ctx, time.Now().UTC().AddDate(1, 0, 1)))
+	first, err := s.storage.GetUserByID(ctx, userIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(10000), first.Balance)
+	second, err := s.storage.GetUserByID(ctx, userIDs[1])
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), second.Balance)
+}
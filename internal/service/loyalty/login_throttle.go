@@ -0,0 +1,145 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+// throttle is the policy for one failed login counter: the first freeAttempts failures in a row
+// cost nothing, every next one blocks the counter for twice as long as the previous one, and
+// after lockoutThreshold failures it is locked out.
+type throttle struct {
+	key              string
+	freeAttempts     int
+	lockoutThreshold int
+}
+
+// loginThrottles are the counters charged for a login attempt: per login and per client IP.
+func (s *basicService) loginThrottles(login, ip string) []throttle {
+	throttles := []throttle{{
+		key:              model.LoginThrottleKey(login),
+		freeAttempts:     s.cfg.LoginFreeAttempts,
+		lockoutThreshold: s.cfg.LoginLockoutThreshold,
+	}}
+	if ip != "" {
+		throttles = append(throttles, throttle{
+			key:              model.IPThrottleKey(ip),
+			freeAttempts:     s.cfg.LoginIPFreeAttempts,
+			lockoutThreshold: s.cfg.LoginIPLockoutThreshold,
+		})
+	}
+	return throttles
+}
+
+// checkLoginBlocked fails with a *apperrors.RetryAfterError if any of the counters is blocked.
+func (s *basicService) checkLoginBlocked(ctx context.Context, throttles []throttle) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, t := range throttles {
+		until, err := s.storage.GetLoginBlockedUntil(ctx, t.key)
+		if err != nil {
+			return err
+		}
+		if wait := until.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &apperrors.RetryAfterError{Err: apperrors.ErrLoginBlocked, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// chargeLoginAttempt counts the attempt as a failure on every counter before the credentials are
+// checked, so that concurrent attempts can not all slip past checkLoginBlocked before the first of
+// them is recorded. It fails with a *apperrors.RetryAfterError if the failures counted before this
+// attempt still block it, and otherwise returns the failures in a row per counter.
+func (s *basicService) chargeLoginAttempt(ctx context.Context, throttles []throttle) ([]int, error) {
+	now := time.Now()
+	failures := make([]int, len(throttles))
+	var retryAfter time.Duration
+	for i, t := range throttles {
+		n, previous, err := s.storage.RecordLoginFailure(ctx, t.key, s.cfg.LoginFailureWindow)
+		if err != nil {
+			return nil, err
+		}
+		failures[i] = n
+		if block := s.loginBlockDuration(t, n-1); block > 0 {
+			if wait := previous.Add(block).Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return nil, &apperrors.RetryAfterError{Err: apperrors.ErrLoginBlocked, RetryAfter: retryAfter}
+	}
+	return failures, nil
+}
+
+// recordLoginFailure blocks the counters charged by chargeLoginAttempt once the credentials turned out wrong.
+func (s *basicService) recordLoginFailure(ctx context.Context, throttles []throttle, failures []int) error {
+	for i, t := range throttles {
+		if block := s.loginBlockDuration(t, failures[i]); block > 0 {
+			s.Logger.Infof("%v failed logins in a row by %v, blocked for %v", failures[i], t.key, block)
+			if err := s.storage.BlockLogin(ctx, t.key, time.Now().Add(block)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *basicService) loginBlockDuration(t throttle, failures int) time.Duration {
+	if failures >= t.lockoutThreshold {
+		return s.cfg.LoginLockoutDuration
+	}
+	if failures <= t.freeAttempts {
+		return 0
+	}
+	delay := s.cfg.LoginDelay
+	for i := t.freeAttempts + 1; i < failures && delay < s.cfg.LoginMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.LoginMaxDelay {
+		delay = s.cfg.LoginMaxDelay
+	}
+	return delay
+}
+
+// Unlock forgets failed logins of the account or client IP on behalf of actorID and lifts their block.
+func (s *basicService) Unlock(ctx context.Context, actorID uint, request model.UnlockRequest) error {
+	keys, err := ThrottleKeys(ctx, s.storage, request)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.storage.ResetLoginAttempts(ctx, key); err != nil {
+			return err
+		}
+		s.Logger.Infof("user %v unlocked %v", actorID, key)
+	}
+	return nil
+}
+
+// ThrottleKeys returns the counters to reset to unlock request. Unlocking a login also forgets
+// the wrong two-factor codes of the account, if it exists.
+func ThrottleKeys(ctx context.Context, storage service.Storage, request model.UnlockRequest) ([]string, error) {
+	if request.IP != "" {
+		return []string{model.IPThrottleKey(request.IP)}, nil
+	}
+	keys := []string{model.LoginThrottleKey(request.Login)}
+	user, err := storage.GetUserByLogin(ctx, request.Login)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil {
+		keys = append(keys, model.TOTPThrottleKey(user.ID))
+	}
+	return keys, nil
+}
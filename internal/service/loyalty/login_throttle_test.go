@@ -0,0 +1,139 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_loginBlockDuration(t *testing.T) {
+	s := &basicService{cfg: &config.Config{
+		LoginDelay:           time.Second,
+		LoginMaxDelay:        10 * time.Second,
+		LoginLockoutDuration: time.Hour,
+	}}
+	tr := throttle{freeAttempts: 3, lockoutThreshold: 10}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{9, 10 * time.Second},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, s.loginBlockDuration(tr, tt.failures), "failures = %d", tt.failures)
+	}
+}
+
+func Test_basicService_Login_throttling(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:                3,
+		AccessTokenTTL:          time.Minute,
+		LoginFreeAttempts:       2,
+		LoginLockoutThreshold:   4,
+		LoginIPFreeAttempts:     3,
+		LoginIPLockoutThreshold: 100,
+		LoginDelay:              time.Minute,
+		LoginMaxDelay:           time.Hour,
+		LoginLockoutDuration:    time.Hour,
+		LoginFailureWindow:      time.Hour,
+	}
+	s := newTestService(t, cfg)
+	_, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	_, err = s.Register(ctx, "other", "password", "")
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = s.Login(ctx, "user", "wrong", "10.0.0.1")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+	}
+	// a success resets the login counter
+	_, err = s.Login(ctx, "user", "password", "10.0.0.1")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = s.Login(ctx, "user", "wrong", "10.0.0.2")
+		assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+	}
+	_, err = s.Login(ctx, "user", "wrong", "10.0.0.2")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+
+	// the third failure in a row blocks the login, even with the right password
+	_, err = s.Login(ctx, "user", "password", "10.0.0.3")
+	var blocked *apperrors.RetryAfterError
+	require.ErrorAs(t, err, &blocked)
+	assert.ErrorIs(t, err, apperrors.ErrLoginBlocked)
+	assert.InDelta(t, time.Minute.Seconds(), blocked.RetryAfter.Seconds(), 1)
+
+	// 10.0.0.1 failed 2 times and 10.0.0.2 failed 3 times, so the next failure blocks 10.0.0.2
+	_, err = s.Login(ctx, "unknown", "wrong", "10.0.0.2")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.Login(ctx, "other", "password", "10.0.0.2")
+	assert.ErrorIs(t, err, apperrors.ErrLoginBlocked)
+	_, err = s.Login(ctx, "other", "password", "10.0.0.1")
+	require.NoError(t, err)
+
+	// staff can lift both blocks
+	require.NoError(t, s.Unlock(ctx, 1, model.UnlockRequest{Login: "user"}))
+	_, err = s.Login(ctx, "user", "password", "10.0.0.1")
+	require.NoError(t, err)
+	require.NoError(t, s.Unlock(ctx, 1, model.UnlockRequest{IP: "10.0.0.2"}))
+	_, err = s.Login(ctx, "other", "password", "10.0.0.2")
+	require.NoError(t, err)
+}
+
+func Test_basicService_Login_concurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:              3,
+		AccessTokenTTL:        time.Minute,
+		LoginFreeAttempts:     2,
+		LoginLockoutThreshold: 100,
+		LoginDelay:            time.Minute,
+		LoginMaxDelay:         time.Hour,
+		LoginFailureWindow:    time.Hour,
+	}
+	s := newTestService(t, cfg)
+	_, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+
+	// a burst of attempts can not get more guesses than a single client failing one after another
+	var wg sync.WaitGroup
+	var guesses, blocked atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Login(ctx, "user", "wrong", "")
+			switch {
+			case errors.Is(err, apperrors.ErrInvalidPassword):
+				guesses.Add(1)
+			case errors.Is(err, apperrors.ErrLoginBlocked):
+				blocked.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 3, guesses.Load())
+	assert.EqualValues(t, 17, blocked.Load())
+}
@@ -0,0 +1,11 @@
+package loyalty
+
+import (
+	"context"
+	"time"
+)
+
+// Notifier delivers messages to users out of band, e.g. by e-mail.
+type Notifier interface {
+	SendPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error
+}
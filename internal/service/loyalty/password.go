@@ -0,0 +1,72 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// ChangePassword sets a new password and revokes all sessions of the user except sessionID.
+func (s *basicService) ChangePassword(ctx context.Context, userID uint, sessionID, currentPassword, newPassword string) error {
+	user, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !checkPasswordHash(currentPassword, user.Password) {
+		return apperrors.ErrInvalidPassword
+	}
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.UpdateUserPassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+	return s.storage.RevokeUserSessions(ctx, userID, sessionID)
+}
+
+// RequestPasswordReset sends a reset token to the user. Unknown logins are silently ignored,
+// so the endpoint cannot be used to find out which logins exist.
+func (s *basicService) RequestPasswordReset(ctx context.Context, login string) error {
+	user, err := s.storage.GetUserByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Logger.Debugf("password reset requested for unknown login %v", login)
+			return nil
+		}
+		return err
+	}
+	token, hash, err := auth.NewOneTimeToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	resetToken := model.PasswordResetToken{
+		TokenHash: hash,
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.PasswordResetTTL),
+	}
+	if err := s.storage.CreatePasswordResetToken(ctx, resetToken); err != nil {
+		return err
+	}
+	return s.notifier.SendPasswordReset(ctx, user.Login, token, resetToken.ExpiresAt)
+}
+
+// ResetPassword sets a new password by a reset token and revokes all sessions of the user.
+func (s *basicService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	userID, err := s.storage.ResetPassword(ctx, auth.HashToken(token), hashedPassword)
+	if err != nil {
+		return err
+	}
+	return s.storage.RevokeUserSessions(ctx, userID, "")
+}
@@ -0,0 +1,69 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+)
+
+type stubNotifier map[string]string
+
+func (n stubNotifier) SendPasswordReset(_ context.Context, login, token string, _ time.Time) error {
+	n[login] = token
+	return nil
+}
+
+func Test_basicService_passwords(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:         3,
+		AccessTokenTTL:   time.Minute,
+		PasswordResetTTL: time.Hour,
+	}
+	notifier := stubNotifier{}
+	s := newTestService(t, cfg)
+	s.notifier = notifier
+	claimsOf := func(accessToken string) auth.Claims {
+		claims, err := s.auth.ValidateToken(accessToken)
+		require.NoError(t, err)
+		return claims
+	}
+
+	current, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	other, err := s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	claims := claimsOf(current.AccessToken)
+
+	err = s.ChangePassword(ctx, claims.UserID, claims.SessionID, "wrong", "changed")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+	require.NoError(t, s.ChangePassword(ctx, claims.UserID, claims.SessionID, "password", "changed"))
+	_, err = s.Login(ctx, "user", "password", "")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidPassword)
+	_, err = s.RefreshToken(ctx, other.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+	current, err = s.RefreshToken(ctx, current.RefreshToken)
+	require.NoError(t, err)
+
+	require.NoError(t, s.RequestPasswordReset(ctx, "nobody"))
+	assert.Empty(t, notifier)
+	require.NoError(t, s.RequestPasswordReset(ctx, "user"))
+	token := notifier["user"]
+	require.NotEmpty(t, token)
+
+	assert.ErrorIs(t, s.ResetPassword(ctx, "wrong", "reset"), apperrors.ErrInvalidResetToken)
+	require.NoError(t, s.ResetPassword(ctx, token, "reset"))
+	assert.ErrorIs(t, s.ResetPassword(ctx, token, "again"), apperrors.ErrInvalidResetToken)
+	_, err = s.Login(ctx, "user", "reset", "")
+	require.NoError(t, err)
+	// a reset logs out everywhere
+	_, err = s.RefreshToken(ctx, current.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+}
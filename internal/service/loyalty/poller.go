@@ -0,0 +1,146 @@
+package loyalty
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PollPendingOrders runs the accrual workers and the bonus retry loop until ctx is cancelled. Workers lease
+// due orders in storage instead of sharing an in-process queue, so several
+// instances can poll the same database without checking an order twice per interval.
+func (s *basicService) PollPendingOrders(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.retryPendingBonuses(ctx)
+	}()
+	for w := 1; w <= s.cfg.AccrualWorkers; w++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			s.pollWorker(ctx, workerID)
+		}(w)
+	}
+	wg.Wait()
+}
+
+func (s *basicService) pollWorker(ctx context.Context, workerID int) {
+	ticker := time.NewTicker(s.cfg.AccrualPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.processLeasedOrders(ctx, workerID); err != nil {
+			s.Logger.Errorf("worker #%v failed to process pending orders: %v", workerID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processLeasedOrders checks a batch of orders leased under a fresh token. The leases are renewed
+// while the batch runs, since the accrual limiter may hold a request for longer than the lease
+// time, and an order whose lease was taken over by another poller in the meantime is skipped.
+func (s *basicService) processLeasedOrders(ctx context.Context, workerID int) error {
+	token, err := newLeaseToken()
+	if err != nil {
+		return err
+	}
+	orders, err := s.storage.LeasePendingOrders(ctx, token, s.cfg.AccrualBatchSize, s.cfg.AccrualLeaseTime)
+	if err != nil || len(orders) == 0 {
+		return err
+	}
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	defer stopRenewing()
+	go s.renewLeases(renewCtx, workerID, token)
+	for _, orderNumber := range orders {
+		held, err := s.storage.RenewOrderLeases(ctx, token, s.cfg.AccrualLeaseTime)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(held, orderNumber) {
+			s.Logger.Warnf("worker #%v lost the lease of order #%v", workerID, orderNumber)
+			continue
+		}
+		if err := s.UpdateOrderAccrual(ctx, orderNumber); err != nil {
+			s.Logger.Errorf("failed to update order #%v by worker #%v: %v", orderNumber, workerID, err)
+		}
+		if err := s.storage.ReleaseOrder(ctx, orderNumber, token, s.cfg.AccrualInterval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renewLeases extends the leases held under token every third of the lease time until ctx is done.
+func (s *basicService) renewLeases(ctx context.Context, workerID int, token string) {
+	ticker := time.NewTicker(s.cfg.AccrualLeaseTime / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.storage.RenewOrderLeases(ctx, token, s.cfg.AccrualLeaseTime); err != nil && ctx.Err() == nil {
+			s.Logger.Errorf("worker #%v failed to renew its order leases: %v", workerID, err)
+		}
+	}
+}
+
+// newLeaseToken returns a random token that identifies one batch of leased orders.
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// retryPendingBonuses credits the referral and campaign bonuses that failed when their order was
+// finalized. Crediting is idempotent, so an order finalized by a worker in the meantime is safe to retry.
+func (s *basicService) retryPendingBonuses(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.AccrualInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.settlePendingBonuses(ctx); err != nil {
+			s.Logger.Errorf("failed to retry pending bonuses: %v", err)
+		}
+	}
+}
+
+func (s *basicService) settlePendingBonuses(ctx context.Context) error {
+	orders, err := s.storage.GetOrdersWithPendingBonuses(ctx, s.cfg.AccrualBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, orderNumber := range orders {
+		if err := s.settleOrderBonuses(ctx, orderNumber); err != nil {
+			s.Logger.Errorf("failed to credit the bonuses of order %v: %v", orderNumber, err)
+		}
+	}
+	return nil
+}
+
+// settleOrderBonuses credits the referral and campaign bonuses of a processed order and clears its
+// pending flag. On failure the flag stays set and the order is retried by retryPendingBonuses.
+func (s *basicService) settleOrderBonuses(ctx context.Context, orderNumber string) error {
+	if err := s.settleReferral(ctx, orderNumber); err != nil {
+		return err
+	}
+	if err := s.applyCampaigns(ctx, orderNumber); err != nil {
+		return err
+	}
+	return s.storage.ClearOrderBonusesPending(ctx, orderNumber)
+}
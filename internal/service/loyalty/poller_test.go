@@ -0,0 +1,62 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	mock_service "github.com/mrkovshik/yandex_diploma/mocks"
+)
+
+type stubAccrual map[string]model.AccrualResponse
+
+func (a stubAccrual) GetOrderAccrual(_ context.Context, orderNumber string) (model.AccrualResponse, error) {
+	return a[orderNumber], nil
+}
+
+func Test_basicService_processLeasedOrders(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cfg := &config.Config{
+		AccrualInterval:  10 * time.Second,
+		AccrualLeaseTime: time.Minute,
+		AccrualBatchSize: 5,
+	}
+	accrual := stubAccrual{
+		"12345678903": {Order: "12345678903", Status: model.AccrualStateProcessing},
+		"79927398713": {Order: "79927398713", Status: model.AccrualStateProcessed, Accrual: 50000},
+	}
+	storage := mock_service.NewMockStorage(ctrl)
+	var token string
+	storage.EXPECT().LeasePendingOrders(ctx, gomock.Any(), cfg.AccrualBatchSize, cfg.AccrualLeaseTime).
+		DoAndReturn(func(_ context.Context, leaseToken string, _ int, _ time.Duration) ([]string, error) {
+			token = leaseToken
+			return []string{"12345678903", "79927398713", "4561261212345467"}, nil
+		})
+	// the lease of the last order was taken over by another poller, so it is neither checked nor released
+	storage.EXPECT().RenewOrderLeases(ctx, gomock.Any(), cfg.AccrualLeaseTime).
+		DoAndReturn(func(_ context.Context, leaseToken string, _ time.Duration) ([]string, error) {
+			assert.Equal(t, token, leaseToken)
+			return []string{"12345678903", "79927398713"}, nil
+		}).Times(3)
+	storage.EXPECT().SetOrderStatus(ctx, "12345678903", model.OrderStateProcessing).Return(nil)
+	storage.EXPECT().FinalizeOrderAndUpdateBalance(ctx, "79927398713", model.Amount(50000), model.Amount(0)).Return(nil)
+	storage.EXPECT().ClearOrderBonusesPending(ctx, "79927398713").Return(nil)
+	storage.EXPECT().ReleaseOrder(ctx, "12345678903", gomock.Any(), cfg.AccrualInterval).Return(nil)
+	storage.EXPECT().ReleaseOrder(ctx, "79927398713", gomock.Any(), cfg.AccrualInterval).Return(nil)
+
+	s := &basicService{
+		storage: storage,
+		accrual: accrual,
+		cfg:     cfg,
+		Logger:  zap.NewNop().Sugar(),
+	}
+	assert.NoError(t, s.processLeasedOrders(ctx, 1))
+}
@@ -0,0 +1,157 @@
+package loyalty
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// referralLimitRule is the reject reason of a referral whose referrer has reached the limit.
+const referralLimitRule = "referrer_limit"
+
+type referralVerdict int
+
+const (
+	referralPass referralVerdict = iota
+	// referralReject settles the referral without bonuses.
+	referralReject
+)
+
+// referralRule judges a pending referral by the first processed order of the referred user. The name of
+// the rule that rejects a referral is stored as the reject reason.
+type referralRule struct {
+	name  string
+	check func(ctx context.Context, s *basicService, referral model.Referral, order model.Order) (referralVerdict, error)
+}
+
+// referralRules are checked in order, a referral passing all of them earns the bonuses unless the referrer
+// has REFERRAL_MAX_PER_REFERRER credited referrals already. Storage checks that limit under a lock of the
+// referrer when crediting; a referral over the limit is rejected with referralLimitRule as the reason.
+var referralRules = []referralRule{
+	{
+		name: "min_accrual",
+		check: func(_ context.Context, s *basicService, _ model.Referral, order model.Order) (referralVerdict, error) {
+			if order.Accrual < model.AmountFromFloat(s.cfg.ReferralMinAccrual) {
+				return referralReject, nil
+			}
+			return referralPass, nil
+		},
+	},
+	{
+		name: "window",
+		check: func(_ context.Context, s *basicService, referral model.Referral, order model.Order) (referralVerdict, error) {
+			if s.cfg.ReferralWindow > 0 && order.UploadedAt.After(referral.CreatedAt.Add(s.cfg.ReferralWindow)) {
+				return referralReject, nil
+			}
+			return referralPass, nil
+		},
+	},
+}
+
+// registerReferral links the new user to the referrer. Registration does not fail because of it:
+// the referral is only lost.
+func (s *basicService) registerReferral(ctx context.Context, userID, referrerID uint) {
+	if err := s.storage.AddReferral(ctx, model.Referral{ReferredID: userID, ReferrerID: referrerID}); err != nil {
+		s.Logger.Errorf("failed to register user %v as referred by user %v: %v", userID, referrerID, err)
+	}
+}
+
+// referrerByCode returns the owner of the referral code or apperrors.ErrInvalidReferralCode.
+func (s *basicService) referrerByCode(ctx context.Context, code string) (uint, error) {
+	referrerID, err := s.storage.GetUserIDByReferralCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, apperrors.ErrInvalidReferralCode
+	}
+	return referrerID, err
+}
+
+// settleReferral checks the referral of the owner of a processed order against referralRules
+// and credits the bonuses to both parties if it passes. Only the first processed order of the
+// referred user counts: it settles the referral either way, so later orders find it settled.
+func (s *basicService) settleReferral(ctx context.Context, orderNumber string) error {
+	if s.cfg.ReferralReferrerBonus <= 0 && s.cfg.ReferralRefereeBonus <= 0 {
+		return nil
+	}
+	order, err := s.storage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		return err
+	}
+	if order.Status != model.OrderStateProcessed {
+		return nil
+	}
+	referral, err := s.storage.GetReferral(ctx, order.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if referral.Status != model.ReferralStatusPending {
+		return nil
+	}
+	for _, rule := range referralRules {
+		verdict, err := rule.check(ctx, s, referral, order)
+		if err != nil {
+			return err
+		}
+		if verdict == referralReject {
+			s.Logger.Infof("referral of user %v by user %v is rejected by rule %v", referral.ReferredID, referral.ReferrerID, rule.name)
+			return s.storage.RejectReferral(ctx, referral.ReferredID, rule.name)
+		}
+	}
+	referral.OrderNumber = orderNumber
+	referral.ReferrerBonus = model.AmountFromFloat(s.cfg.ReferralReferrerBonus)
+	referral.RefereeBonus = model.AmountFromFloat(s.cfg.ReferralRefereeBonus)
+	credited, err := s.storage.CreditReferral(ctx, referral, s.cfg.ReferralMaxPerReferrer)
+	if errors.Is(err, apperrors.ErrReferralLimit) {
+		s.Logger.Infof("referral of user %v by user %v is rejected by rule %v", referral.ReferredID, referral.ReferrerID, referralLimitRule)
+		return s.storage.RejectReferral(ctx, referral.ReferredID, referralLimitRule)
+	}
+	if err != nil {
+		return err
+	}
+	if credited {
+		s.Logger.Infof("referral of user %v by user %v is credited with order %v", referral.ReferredID, referral.ReferrerID, orderNumber)
+	}
+	return nil
+}
+
+// GetReferrals returns the referral code of the user, creating it on first use, and the users
+// registered with it.
+func (s *basicService) GetReferrals(ctx context.Context, userID uint) (model.ReferralsResponse, error) {
+	code, err := newReferralCode()
+	if err != nil {
+		return model.ReferralsResponse{}, err
+	}
+	code, err = s.storage.EnsureReferralCode(ctx, userID, code)
+	if err != nil {
+		return model.ReferralsResponse{}, err
+	}
+	referrals, err := s.storage.GetReferralsByReferrer(ctx, userID)
+	if err != nil {
+		return model.ReferralsResponse{}, err
+	}
+	response := model.ReferralsResponse{Code: code, Referrals: []model.Referral{}}
+	for _, referral := range referrals {
+		if referral.Status == model.ReferralStatusCredited {
+			response.Earned += referral.ReferrerBonus
+		}
+		response.Referrals = append(response.Referrals, referral)
+	}
+	return response, nil
+}
+
+// newReferralCode returns 8 random characters that are easy to dictate.
+func newReferralCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,91 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_referrals(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:               1,
+		AccessTokenTTL:         time.Minute,
+		ReferralReferrerBonus:  100,
+		ReferralRefereeBonus:   50,
+		ReferralMinAccrual:     10,
+		ReferralWindow:         time.Hour,
+		ReferralMaxPerReferrer: 1,
+	}
+	s := newTestService(t, cfg)
+	s.accrual = stubAccrual{
+		"12345678903":      {Order: "12345678903", Status: model.AccrualStateProcessed, Accrual: 500},
+		"79927398713":      {Order: "79927398713", Status: model.AccrualStateProcessed, Accrual: 2000},
+		"2377225624":       {Order: "2377225624", Status: model.AccrualStateProcessed, Accrual: 2000},
+		"4561261212345467": {Order: "4561261212345467", Status: model.AccrualStateProcessed, Accrual: 2000},
+	}
+	_, err := s.Register(ctx, "referrer", "password", "")
+	require.NoError(t, err)
+	referrer, err := s.storage.GetUserByLogin(ctx, "referrer")
+	require.NoError(t, err)
+	referrals, err := s.GetReferrals(ctx, referrer.ID)
+	require.NoError(t, err)
+	assert.Len(t, referrals.Code, 8)
+	assert.Empty(t, referrals.Referrals)
+	again, err := s.GetReferrals(ctx, referrer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, referrals.Code, again.Code)
+
+	_, err = s.Register(ctx, "stranger", "password", "NOSUCHCODE")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidReferralCode)
+	_, err = s.Register(ctx, "friend", "password", " "+referrals.Code+" ")
+	require.NoError(t, err)
+	friend, err := s.storage.GetUserByLogin(ctx, "friend")
+	require.NoError(t, err)
+	_, err = s.Register(ctx, "second", "password", referrals.Code)
+	require.NoError(t, err)
+	second, err := s.storage.GetUserByLogin(ctx, "second")
+	require.NoError(t, err)
+
+	_, err = s.Register(ctx, "third", "password", referrals.Code)
+	require.NoError(t, err)
+	third, err := s.storage.GetUserByLogin(ctx, "third")
+	require.NoError(t, err)
+
+	require.NoError(t, s.storage.UploadOrder(ctx, friend.ID, "79927398713"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "79927398713"))
+
+	// the first processed order is below REFERRAL_MIN_ACCRUAL, so the next one does not count either
+	require.NoError(t, s.storage.UploadOrder(ctx, second.ID, "12345678903"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "12345678903"))
+	require.NoError(t, s.storage.UploadOrder(ctx, second.ID, "2377225624"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "2377225624"))
+
+	// the referrer has reached REFERRAL_MAX_PER_REFERRER
+	require.NoError(t, s.storage.UploadOrder(ctx, third.ID, "4561261212345467"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "4561261212345467"))
+
+	referrals, err = s.GetReferrals(ctx, referrer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(10000), referrals.Earned)
+	require.Len(t, referrals.Referrals, 3)
+	assert.Equal(t, "friend", referrals.Referrals[0].ReferredLogin)
+	assert.Equal(t, model.ReferralStatusCredited, referrals.Referrals[0].Status)
+	assert.Equal(t, model.ReferralStatusRejected, referrals.Referrals[1].Status)
+	assert.Equal(t, "min_accrual", referrals.Referrals[1].RejectReason)
+	assert.Equal(t, model.ReferralStatusRejected, referrals.Referrals[2].Status)
+	assert.Equal(t, "referrer_limit", referrals.Referrals[2].RejectReason)
+
+	for userID, balance := range map[uint]model.Amount{referrer.ID: 10000, friend.ID: 2000 + 5000, second.ID: 500 + 2000, third.ID: 2000} {
+		got, err := s.GetBalance(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, balance, got.Balance)
+	}
+}
@@ -0,0 +1,104 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// RefreshToken exchanges a refresh token for a new token pair. Refresh tokens are
+// single-use: presenting one that has already been rotated means it has leaked,
+// so the whole session is revoked.
+func (s *basicService) RefreshToken(ctx context.Context, refreshToken string) (model.AuthTokens, error) {
+	sessionID, hash, err := auth.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return model.AuthTokens{}, apperrors.ErrInvalidRefreshToken
+	}
+	session, err := s.storage.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.AuthTokens{}, apperrors.ErrInvalidRefreshToken
+		}
+		return model.AuthTokens{}, err
+	}
+	if !session.Active(time.Now()) {
+		return model.AuthTokens{}, apperrors.ErrInvalidRefreshToken
+	}
+	if session.RefreshTokenHash != hash {
+		s.Logger.Warnf("reuse of a rotated refresh token, revoking session %v of user %v", session.ID, session.UserID)
+		if err := s.storage.RevokeSession(ctx, session.ID); err != nil {
+			return model.AuthTokens{}, err
+		}
+		return model.AuthTokens{}, apperrors.ErrInvalidRefreshToken
+	}
+	newToken, newHash, err := auth.NewRefreshToken(session.ID)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	rotated, err := s.storage.RotateSession(ctx, session.ID, hash, newHash, time.Now().Add(s.refreshTokenTTL()))
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	if !rotated {
+		// refreshed or revoked concurrently
+		return model.AuthTokens{}, apperrors.ErrInvalidRefreshToken
+	}
+	// the role may have changed since the last refresh
+	user, err := s.storage.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	return s.issueTokens(session.UserID, session.ID, user.Role, newToken)
+}
+
+func (s *basicService) Logout(ctx context.Context, sessionID string) error {
+	return s.storage.RevokeSession(ctx, sessionID)
+}
+
+func (s *basicService) LogoutAll(ctx context.Context, userID uint) error {
+	return s.storage.RevokeUserSessions(ctx, userID, "")
+}
+
+// startSession creates a new session of the user and issues its first token pair.
+func (s *basicService) startSession(ctx context.Context, userID uint, role model.Role) (model.AuthTokens, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	refreshToken, hash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	now := time.Now().UTC()
+	if err := s.storage.CreateSession(ctx, model.Session{
+		ID:               sessionID,
+		UserID:           userID,
+		RefreshTokenHash: hash,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(s.refreshTokenTTL()),
+	}); err != nil {
+		return model.AuthTokens{}, err
+	}
+	return s.issueTokens(userID, sessionID, role, refreshToken)
+}
+
+func (s *basicService) issueTokens(userID uint, sessionID string, role model.Role, refreshToken string) (model.AuthTokens, error) {
+	accessToken, err := s.auth.GenerateToken(userID, sessionID, role)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	return model.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(s.auth.TokenTTL().Seconds()),
+	}, nil
+}
+
+func (s *basicService) refreshTokenTTL() time.Duration {
+	return time.Duration(s.cfg.TokenExp) * 24 * time.Hour
+}
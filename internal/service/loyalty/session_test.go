@@ -0,0 +1,63 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+)
+
+func Test_basicService_sessions(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:       3,
+		AccessTokenTTL: time.Minute,
+	}
+	s := newTestService(t, cfg)
+	sessionOf := func(accessToken string) string {
+		claims, err := s.auth.ValidateToken(accessToken)
+		require.NoError(t, err)
+		return claims.SessionID
+	}
+
+	first, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	assert.Equal(t, 60, first.ExpiresIn)
+
+	refreshed, err := s.RefreshToken(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, sessionOf(first.AccessToken), sessionOf(refreshed.AccessToken))
+
+	// reusing a rotated refresh token revokes the session
+	_, err = s.RefreshToken(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+	_, err = s.RefreshToken(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+
+	second, err := s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	require.NoError(t, s.Logout(ctx, sessionOf(second.AccessToken)))
+	_, err = s.RefreshToken(ctx, second.RefreshToken)
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+
+	third, err := s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	fourth, err := s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	session, err := s.storage.GetSession(ctx, sessionOf(third.AccessToken))
+	require.NoError(t, err)
+	require.NoError(t, s.LogoutAll(ctx, session.UserID))
+	for _, tokens := range []string{third.RefreshToken, fourth.RefreshToken} {
+		_, err = s.RefreshToken(ctx, tokens)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+	}
+
+	_, err = s.RefreshToken(ctx, "malformed")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidRefreshToken)
+}
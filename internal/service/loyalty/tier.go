@@ -0,0 +1,136 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// RecalculateTiers recalculates the loyalty tiers of all users every cfg.TierRecalcInterval
+// until ctx is cancelled.
+func (s *basicService) RecalculateTiers(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.TierRecalcInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.recalculateTiers(ctx, time.Now().UTC()); err != nil {
+			s.Logger.Errorf("failed to recalculate tiers: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recalculateTiers counts tier points over cfg.TierWindow before now: the net points accrued by
+// orders or, with the spent basis, the net points withdrawn.
+func (s *basicService) recalculateTiers(ctx context.Context, now time.Time) error {
+	account, sign := model.SystemAccountAccruals, model.Amount(1)
+	switch s.cfg.TierBasis {
+	case model.TierBasisAccrued:
+	case model.TierBasisSpent:
+		account, sign = model.SystemAccountWithdrawals, -1
+	default:
+		return fmt.Errorf("unknown tier basis %q", s.cfg.TierBasis)
+	}
+	turnover, err := s.storage.GetUserTurnover(ctx, account, now.Add(-s.cfg.TierWindow))
+	if err != nil {
+		return err
+	}
+	tiers := make([]model.UserTier, 0, len(turnover))
+	for _, t := range turnover {
+		points := sign * t.Amount
+		tiers = append(tiers, model.UserTier{UserID: t.UserID, Tier: s.levelFor(points).Tier, Points: points, UpdatedAt: now})
+	}
+	if err := s.storage.ReplaceUserTiers(ctx, tiers); err != nil {
+		return err
+	}
+	s.Logger.Debugf("recalculated tiers of %v users", len(tiers))
+	return nil
+}
+
+// tierLevels lists the loyalty tiers from the lowest up.
+func (s *basicService) tierLevels() []model.TierLevel {
+	return []model.TierLevel{
+		{Tier: model.TierBronze, Multiplier: 1},
+		{Tier: model.TierSilver, MinPoints: model.AmountFromFloat(s.cfg.TierSilverPoints), Multiplier: s.cfg.TierSilverMultiplier},
+		{Tier: model.TierGold, MinPoints: model.AmountFromFloat(s.cfg.TierGoldPoints), Multiplier: s.cfg.TierGoldMultiplier},
+	}
+}
+
+// levelFor returns the highest tier reached with points.
+func (s *basicService) levelFor(points model.Amount) model.TierLevel {
+	levels := s.tierLevels()
+	level := levels[0]
+	for _, l := range levels[1:] {
+		if points >= l.MinPoints {
+			level = l
+		}
+	}
+	return level
+}
+
+// userLevel returns the tier of the user as of the last recalculation and its tier points.
+func (s *basicService) userLevel(ctx context.Context, userID uint) (model.TierLevel, model.Amount, error) {
+	tier, err := s.storage.GetUserTier(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.tierLevels()[0], 0, nil
+	}
+	if err != nil {
+		return model.TierLevel{}, 0, err
+	}
+	for _, l := range s.tierLevels() {
+		if l.Tier == tier.Tier {
+			return l, tier.Points, nil
+		}
+	}
+	return s.tierLevels()[0], tier.Points, nil
+}
+
+// tierBonus is what the multiplier of the order owner's tier adds to the accrual for the order.
+func (s *basicService) tierBonus(ctx context.Context, orderNumber string, accrual model.Amount) (model.Amount, error) {
+	if s.cfg.TierSilverMultiplier <= 1 && s.cfg.TierGoldMultiplier <= 1 {
+		return 0, nil
+	}
+	order, err := s.storage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		return 0, err
+	}
+	level, _, err := s.userLevel(ctx, order.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return max(level.Apply(accrual)-accrual, 0), nil
+}
+
+func (s *basicService) GetProfile(ctx context.Context, userID uint) (model.Profile, error) {
+	user, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.Profile{}, err
+	}
+	level, points, err := s.userLevel(ctx, userID)
+	if err != nil {
+		return model.Profile{}, err
+	}
+	profile := model.Profile{
+		Login:             user.Login,
+		Role:              user.Role,
+		Tier:              level.Tier,
+		TierPoints:        points,
+		AccrualMultiplier: level.Multiplier,
+		CreatedAt:         user.CreatedAt,
+	}
+	for _, l := range s.tierLevels() {
+		if l.MinPoints > points && l.MinPoints > level.MinPoints {
+			profile.NextTier = l.Tier
+			profile.NextTierPoints = l.MinPoints - points
+			break
+		}
+	}
+	return profile, nil
+}
@@ -0,0 +1,75 @@
+package loyalty
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_tiers(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TierBasis:            model.TierBasisAccrued,
+		TierWindow:           24 * time.Hour,
+		TierSilverPoints:     100,
+		TierSilverMultiplier: 1.05,
+		TierGoldPoints:       500,
+		TierGoldMultiplier:   1.1,
+	}
+	s := newTestService(t, cfg)
+	s.accrual = stubAccrual{
+		"12345678903": {Order: "12345678903", Status: model.AccrualStateProcessed, Accrual: 20000},
+		"79927398713": {Order: "79927398713", Status: model.AccrualStateProcessed, Accrual: 10000},
+	}
+	userID, err := s.storage.AddUser(ctx, "user", "hash")
+	require.NoError(t, err)
+
+	profile, err := s.GetProfile(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TierBronze, profile.Tier)
+	assert.Equal(t, 1.0, profile.AccrualMultiplier)
+	assert.Equal(t, model.TierSilver, profile.NextTier)
+	assert.Equal(t, model.Amount(10000), profile.NextTierPoints)
+
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "12345678903"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "12345678903"))
+	require.NoError(t, s.recalculateTiers(ctx, time.Now().UTC()))
+	profile, err = s.GetProfile(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TierSilver, profile.Tier)
+	assert.Equal(t, model.Amount(20000), profile.TierPoints)
+	assert.Equal(t, 1.05, profile.AccrualMultiplier)
+	assert.Equal(t, model.TierGold, profile.NextTier)
+	assert.Equal(t, model.Amount(30000), profile.NextTierPoints)
+
+	// silver users get 5% on top of the accrual, credited apart from it
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "79927398713"))
+	require.NoError(t, s.UpdateOrderAccrual(ctx, "79927398713"))
+	order, err := s.storage.GetOrderByNumber(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(10000), order.Accrual)
+	assert.Equal(t, model.Amount(500), order.TierBonus)
+	balance, err := s.GetBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(30500), balance.Balance)
+
+	// points accrued before the window do not count
+	require.NoError(t, s.recalculateTiers(ctx, time.Now().UTC().Add(48*time.Hour)))
+	profile, err = s.GetProfile(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TierBronze, profile.Tier)
+
+	cfg.TierBasis = model.TierBasisSpent
+	require.NoError(t, s.Withdraw(ctx, model.Withdrawal{Amount: 30000, OrderNumber: "2377225624", UserID: userID}, ""))
+	require.NoError(t, s.recalculateTiers(ctx, time.Now().UTC()))
+	profile, err = s.GetProfile(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TierSilver, profile.Tier)
+	assert.Equal(t, model.Amount(30000), profile.TierPoints)
+}
@@ -0,0 +1,174 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const recoveryCodeCount = 10
+
+// SetupTOTP provisions a new authenticator secret. Two-factor authentication stays off
+// until the secret is confirmed with ConfirmTOTP.
+func (s *basicService) SetupTOTP(ctx context.Context, userID uint) (model.TOTPSetupResponse, error) {
+	user, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return model.TOTPSetupResponse{}, err
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return model.TOTPSetupResponse{}, err
+	}
+	if err := s.storage.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		return model.TOTPSetupResponse{}, err
+	}
+	return model.TOTPSetupResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(s.cfg.TOTPIssuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves the authenticator
+// is set up. It returns the recovery codes, which are never shown again.
+func (s *basicService) ConfirmTOTP(ctx context.Context, userID uint, code string) ([]string, error) {
+	totp, err := s.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.ErrTOTPNotSetUp
+		}
+		return nil, err
+	}
+	if totp.Enabled() {
+		return nil, apperrors.ErrTOTPAlreadyEnabled
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, apperrors.ErrInvalidTOTPCode
+	}
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = auth.NewRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = auth.HashRecoveryCode(codes[i])
+	}
+	if err := s.storage.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off. It takes both the password and a code,
+// so neither a stolen access token nor a lost phone alone is enough.
+func (s *basicService) DisableTOTP(ctx context.Context, userID uint, password, code string) error {
+	user, err := s.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !checkPasswordHash(password, user.Password) {
+		return apperrors.ErrInvalidPassword
+	}
+	totp, err := s.enabledTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyTOTP(ctx, totp, code, true); err != nil {
+		return err
+	}
+	return s.storage.DeleteTOTP(ctx, userID)
+}
+
+// LoginTwoFactor is the second login step: it exchanges the token issued by Login
+// and a TOTP or recovery code for a new session.
+func (s *basicService) LoginTwoFactor(ctx context.Context, twoFactorToken, code string) (model.AuthTokens, error) {
+	claims, err := s.auth.ValidateTwoFactorToken(twoFactorToken)
+	if err != nil {
+		return model.AuthTokens{}, apperrors.ErrInvalidTwoFactorToken
+	}
+	totp, err := s.enabledTOTP(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTOTPNotEnabled) {
+			// turned off after the password check, start over
+			return model.AuthTokens{}, apperrors.ErrInvalidTwoFactorToken
+		}
+		return model.AuthTokens{}, err
+	}
+	if err := s.verifyTOTP(ctx, totp, code, true); err != nil {
+		return model.AuthTokens{}, err
+	}
+	user, err := s.storage.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	return s.startSession(ctx, user.ID, user.Role)
+}
+
+// checkWithdrawalTOTP requires a fresh TOTP code from users with two-factor authentication
+// enabled. Recovery codes are only good for logging in.
+func (s *basicService) checkWithdrawalTOTP(ctx context.Context, userID uint, code string) error {
+	totp, err := s.enabledTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, apperrors.ErrTOTPNotEnabled) {
+			return nil
+		}
+		return err
+	}
+	if code == "" {
+		return apperrors.ErrTOTPRequired
+	}
+	return s.verifyTOTP(ctx, totp, code, false)
+}
+
+// enabledTOTP fails with apperrors.ErrTOTPNotEnabled unless the user has confirmed a secret.
+func (s *basicService) enabledTOTP(ctx context.Context, userID uint) (model.TOTP, error) {
+	totp, err := s.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TOTP{}, apperrors.ErrTOTPNotEnabled
+		}
+		return model.TOTP{}, err
+	}
+	if !totp.Enabled() {
+		return model.TOTP{}, apperrors.ErrTOTPNotEnabled
+	}
+	return totp, nil
+}
+
+// verifyTOTP accepts each TOTP code once and, if allowRecovery, an unused recovery code.
+// Wrong codes are throttled like failed logins, per user.
+func (s *basicService) verifyTOTP(ctx context.Context, totp model.TOTP, code string, allowRecovery bool) error {
+	throttles := []throttle{{
+		key:              model.TOTPThrottleKey(totp.UserID),
+		freeAttempts:     s.cfg.LoginFreeAttempts,
+		lockoutThreshold: s.cfg.LoginLockoutThreshold,
+	}}
+	if err := s.checkLoginBlocked(ctx, throttles); err != nil {
+		return err
+	}
+	failures, err := s.chargeLoginAttempt(ctx, throttles)
+	if err != nil {
+		return err
+	}
+	var accepted bool
+	if step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now()); ok {
+		accepted, err = s.storage.UseTOTPStep(ctx, totp.UserID, step)
+	} else if allowRecovery {
+		accepted, err = s.storage.UseRecoveryCode(ctx, totp.UserID, auth.HashRecoveryCode(code))
+	}
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		if err := s.recordLoginFailure(ctx, throttles, failures); err != nil {
+			return err
+		}
+		return apperrors.ErrInvalidTOTPCode
+	}
+	return s.storage.ResetLoginAttempts(ctx, model.TOTPThrottleKey(totp.UserID))
+}
@@ -0,0 +1,106 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/auth"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_totp(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		TokenExp:              3,
+		AccessTokenTTL:        time.Minute,
+		TOTPIssuer:            "Gophermart",
+		TwoFactorTokenTTL:     time.Minute,
+		WithdrawRequireTOTP:   true,
+		LoginFreeAttempts:     3,
+		LoginLockoutThreshold: 10,
+		LoginDelay:            time.Minute,
+		LoginMaxDelay:         time.Minute,
+		LoginLockoutDuration:  time.Hour,
+		LoginFailureWindow:    time.Hour,
+	}
+	s := newTestService(t, cfg)
+	// codes of the previous, current and next step are valid, make sure the test stays within them
+	if time.Now().Unix()%30 > 25 {
+		time.Sleep(5 * time.Second)
+	}
+	step := auth.TOTPStep(time.Now())
+
+	tokens, err := s.Register(ctx, "user", "password", "")
+	require.NoError(t, err)
+	claims, err := s.auth.ValidateToken(tokens.AccessToken)
+	require.NoError(t, err)
+	userID := claims.UserID
+	withdraw := func(code string) error {
+		return s.Withdraw(ctx, model.Withdrawal{Amount: 100, OrderNumber: "2377225624", UserID: userID}, code)
+	}
+	// passing the TOTP check leads to the balance check
+	assert.ErrorIs(t, withdraw(""), apperrors.ErrNotEnoughFunds)
+
+	_, err = s.ConfirmTOTP(ctx, userID, "123456")
+	assert.ErrorIs(t, err, apperrors.ErrTOTPNotSetUp)
+	setup, err := s.SetupTOTP(ctx, userID)
+	require.NoError(t, err)
+	assert.Contains(t, setup.URI, "otpauth://totp/Gophermart:user?")
+	code := func(step int64) string {
+		code, err := auth.TOTPCode(setup.Secret, step)
+		require.NoError(t, err)
+		return code
+	}
+	_, err = s.ConfirmTOTP(ctx, userID, "12345")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTOTPCode)
+	recoveryCodes, err := s.ConfirmTOTP(ctx, userID, code(step-1))
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+	_, err = s.SetupTOTP(ctx, userID)
+	assert.ErrorIs(t, err, apperrors.ErrTOTPAlreadyEnabled)
+
+	tokens, err = s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	assert.Empty(t, tokens.AccessToken)
+	twoFactorToken := tokens.TwoFactorToken
+	require.NotEmpty(t, twoFactorToken)
+	_, err = s.LoginTwoFactor(ctx, tokens.AccessToken, code(step))
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTwoFactorToken)
+	// the code used for confirmation can not be replayed
+	_, err = s.LoginTwoFactor(ctx, twoFactorToken, code(step-1))
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTOTPCode)
+	tokens, err = s.LoginTwoFactor(ctx, twoFactorToken, code(step))
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	_, err = s.LoginTwoFactor(ctx, twoFactorToken, recoveryCodes[0])
+	require.NoError(t, err)
+	_, err = s.LoginTwoFactor(ctx, twoFactorToken, recoveryCodes[0])
+	assert.ErrorIs(t, err, apperrors.ErrInvalidTOTPCode)
+
+	assert.ErrorIs(t, withdraw(""), apperrors.ErrTOTPRequired)
+	assert.ErrorIs(t, withdraw(recoveryCodes[1]), apperrors.ErrInvalidTOTPCode)
+	assert.ErrorIs(t, withdraw(code(step+1)), apperrors.ErrNotEnoughFunds)
+
+	// the fourth wrong code in a row blocks all code checks of the user
+	for i := 0; i < 4; i++ {
+		assert.ErrorIs(t, withdraw(code(step+1)), apperrors.ErrInvalidTOTPCode)
+	}
+	var blocked *apperrors.RetryAfterError
+	assert.True(t, errors.As(s.DisableTOTP(ctx, userID, "password", recoveryCodes[1]), &blocked))
+	require.NoError(t, s.storage.ResetLoginAttempts(ctx, model.TOTPThrottleKey(userID)))
+
+	assert.ErrorIs(t, s.DisableTOTP(ctx, userID, "wrong", recoveryCodes[1]), apperrors.ErrInvalidPassword)
+	require.NoError(t, s.DisableTOTP(ctx, userID, "password", recoveryCodes[1]))
+	assert.ErrorIs(t, s.DisableTOTP(ctx, userID, "password", recoveryCodes[2]), apperrors.ErrTOTPNotEnabled)
+	tokens, err = s.Login(ctx, "user", "password", "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.ErrorIs(t, withdraw(""), apperrors.ErrNotEnoughFunds)
+}
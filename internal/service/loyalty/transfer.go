@@ -0,0 +1,151 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// transferLimitPeriod is the period the daily transfer limits are counted over.
+const transferLimitPeriod = 24 * time.Hour
+
+// Transfer moves points from the sender to the user with the login. Depending on cfg.TransferConfirmation
+// the recipient gets the points at once or after accepting the transfer; until then they are held.
+// Transfers ask for a TOTP code like withdrawals do.
+func (s *basicService) Transfer(ctx context.Context, senderID uint, request model.TransferRequest, totpCode string) (model.Transfer, error) {
+	if request.Amount <= 0 {
+		return model.Transfer{}, apperrors.ErrInvalidAmount
+	}
+	if s.cfg.WithdrawRequireTOTP {
+		if err := s.checkWithdrawalTOTP(ctx, senderID, totpCode); err != nil {
+			return model.Transfer{}, err
+		}
+	}
+	recipient, err := s.storage.GetUserByLogin(ctx, request.To)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if recipient.ID == senderID {
+		return model.Transfer{}, apperrors.ErrTransferToSelf
+	}
+	status := model.TransferStatusCompleted
+	if s.transferNeedsConfirmation(request.Amount) {
+		status = model.TransferStatusPending
+	}
+	transfer, err := s.storage.CreateTransfer(ctx, model.Transfer{
+		SenderID:    senderID,
+		RecipientID: recipient.ID,
+		Amount:      request.Amount,
+		Comment:     request.Comment,
+		Status:      status,
+	}, model.TransferLimits{
+		Since:  time.Now().Add(-transferLimitPeriod),
+		Amount: model.AmountFromFloat(s.cfg.TransferDailyLimit),
+		Count:  s.cfg.TransferDailyCount,
+	})
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	s.Logger.Infof("user %v transferred %v to user %v, transfer %v is %v", senderID, transfer.Amount, recipient.ID, transfer.ID, transfer.Status)
+	return transfer, nil
+}
+
+// transferNeedsConfirmation applies the confirmation policy; an unknown policy requires confirmation.
+func (s *basicService) transferNeedsConfirmation(amount model.Amount) bool {
+	switch s.cfg.TransferConfirmation {
+	case model.TransferConfirmationNever:
+		return false
+	case model.TransferConfirmationAbove:
+		return amount > model.AmountFromFloat(s.cfg.TransferConfirmationThreshold)
+	default:
+		return true
+	}
+}
+
+func (s *basicService) GetTransfers(ctx context.Context, userID uint) ([]model.Transfer, error) {
+	return s.storage.GetTransfersByUserID(ctx, userID)
+}
+
+// SettleTransfer lets the recipient accept (model.TransferStatusCompleted) or decline a pending transfer
+// and the sender cancel it. Transfers of other users are reported as sql.ErrNoRows.
+func (s *basicService) SettleTransfer(ctx context.Context, userID, transferID uint, status model.TransferStatus) (model.Transfer, error) {
+	transfer, err := s.storage.GetTransfer(ctx, transferID)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	switch status {
+	case model.TransferStatusCompleted, model.TransferStatusDeclined:
+		if transfer.RecipientID != userID {
+			return model.Transfer{}, sql.ErrNoRows
+		}
+	case model.TransferStatusCancelled:
+		if transfer.SenderID != userID {
+			return model.Transfer{}, sql.ErrNoRows
+		}
+	default:
+		return model.Transfer{}, fmt.Errorf("unexpected transfer status %v", status)
+	}
+	transfer, err = s.storage.SettleTransfer(ctx, transferID, status)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	s.Logger.Infof("user %v settled transfer %v as %v", userID, transferID, status)
+	return transfer, nil
+}
+
+// Transaction history pages hold defaultTransactionsLimit transactions unless the user asks for
+// up to maxTransactionsLimit.
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 200
+)
+
+// GetTransactions returns a page of the balance movements of the user, the latest first. The page
+// after it is requested with its NextCursor; a malformed query fails with apperrors.ErrInvalidTransactionsQuery.
+func (s *basicService) GetTransactions(ctx context.Context, userID uint, query model.TransactionsQuery) (model.TransactionsPage, error) {
+	filter := model.TransactionFilter{
+		UserID: userID,
+		Types:  query.Types,
+		From:   query.From,
+		To:     query.To,
+		Limit:  query.Limit,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxTransactionsLimit {
+		return model.TransactionsPage{}, apperrors.ErrInvalidTransactionsQuery
+	}
+	for _, t := range filter.Types {
+		if !t.Valid() {
+			return model.TransactionsPage{}, apperrors.ErrInvalidTransactionsQuery
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return model.TransactionsPage{}, apperrors.ErrInvalidTransactionsQuery
+	}
+	if query.Cursor != "" {
+		cursor, err := model.ParseTransactionCursor(query.Cursor)
+		if err != nil {
+			return model.TransactionsPage{}, fmt.Errorf("%w: %v", apperrors.ErrInvalidTransactionsQuery, err)
+		}
+		filter.After = &cursor
+	}
+	limit := filter.Limit
+	// one more transaction tells whether there is a next page
+	filter.Limit++
+	transactions, err := s.storage.GetTransactions(ctx, filter)
+	if err != nil {
+		return model.TransactionsPage{}, err
+	}
+	page := model.TransactionsPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = page.Transactions[limit-1].Cursor().String()
+	}
+	return page, nil
+}
@@ -0,0 +1,127 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/config"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func Test_basicService_Transfer(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{
+		TransferConfirmation:          model.TransferConfirmationAbove,
+		TransferConfirmationThreshold: 50,
+		TransferDailyLimit:            1000,
+		TransferDailyCount:            10,
+	})
+	aliceID, err := s.storage.AddUser(ctx, "alice", "hash")
+	require.NoError(t, err)
+	require.NoError(t, s.storage.UploadOrder(ctx, aliceID, "12345678903"))
+	require.NoError(t, s.storage.FinalizeOrderAndUpdateBalance(ctx, "12345678903", model.AmountFromFloat(500), 0))
+	bobID, err := s.storage.AddUser(ctx, "bob", "hash")
+	require.NoError(t, err)
+
+	_, err = s.Transfer(ctx, aliceID, model.TransferRequest{To: "alice", Amount: 100}, "")
+	assert.ErrorIs(t, err, apperrors.ErrTransferToSelf)
+	_, err = s.Transfer(ctx, aliceID, model.TransferRequest{To: "carol", Amount: 100}, "")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.Transfer(ctx, aliceID, model.TransferRequest{To: "bob"}, "")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidAmount)
+
+	// up to TRANSFER_CONFIRMATION_THRESHOLD the points arrive at once
+	small, err := s.Transfer(ctx, aliceID, model.TransferRequest{To: "bob", Amount: model.AmountFromFloat(30)}, "")
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusCompleted, small.Status)
+	large, err := s.Transfer(ctx, aliceID, model.TransferRequest{To: "bob", Amount: model.AmountFromFloat(100)}, "")
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusPending, large.Status)
+
+	// only the recipient accepts or declines, only the sender cancels
+	_, err = s.SettleTransfer(ctx, aliceID, large.ID, model.TransferStatusCompleted)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.SettleTransfer(ctx, bobID, large.ID, model.TransferStatusCancelled)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	accepted, err := s.SettleTransfer(ctx, bobID, large.ID, model.TransferStatusCompleted)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusCompleted, accepted.Status)
+	_, err = s.SettleTransfer(ctx, aliceID, large.ID, model.TransferStatusCancelled)
+	assert.ErrorIs(t, err, apperrors.ErrTransferNotPending)
+
+	for userID, balance := range map[uint]float64{aliceID: 370, bobID: 130} {
+		user, err := s.storage.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, model.AmountFromFloat(balance), user.Balance)
+	}
+	transfers, err := s.GetTransfers(ctx, bobID)
+	require.NoError(t, err)
+	assert.Len(t, transfers, 2)
+	page, err := s.GetTransactions(ctx, bobID, model.TransactionsQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 2)
+	assert.Equal(t, "alice", page.Transactions[0].Counterparty)
+	assert.Empty(t, page.NextCursor)
+}
+
+func Test_basicService_GetTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, &config.Config{})
+	userID, err := s.storage.AddUser(ctx, "alice", "hash")
+	require.NoError(t, err)
+	require.NoError(t, s.storage.UploadOrder(ctx, userID, "12345678903"))
+	require.NoError(t, s.storage.FinalizeOrderAndUpdateBalance(ctx, "12345678903", model.AmountFromFloat(500), 0))
+	for _, number := range []string{"79927398713", "2377225624"} {
+		require.NoError(t, s.storage.ProcessWithdrawal(ctx, model.Withdrawal{Amount: model.AmountFromFloat(10), OrderNumber: number, UserID: userID}))
+	}
+
+	for _, query := range []model.TransactionsQuery{
+		{Limit: -1},
+		{Limit: maxTransactionsLimit + 1},
+		{Types: []model.LedgerEntryType{"BONUS"}},
+		{From: time.Now(), To: time.Now().Add(-time.Hour)},
+		{Cursor: "not a cursor"},
+	} {
+		_, err := s.GetTransactions(ctx, userID, query)
+		assert.ErrorIs(t, err, apperrors.ErrInvalidTransactionsQuery, "%+v", query)
+	}
+
+	first, err := s.GetTransactions(ctx, userID, model.TransactionsQuery{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, first.Transactions, 2)
+	assert.Equal(t, model.LedgerEntryWithdrawal, first.Transactions[0].Type)
+	require.NotEmpty(t, first.NextCursor)
+	last, err := s.GetTransactions(ctx, userID, model.TransactionsQuery{Limit: 2, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, last.Transactions, 1)
+	assert.Equal(t, model.LedgerEntryAccrual, last.Transactions[0].Type)
+	assert.Empty(t, last.NextCursor)
+
+	accruals, err := s.GetTransactions(ctx, userID, model.TransactionsQuery{Types: []model.LedgerEntryType{model.LedgerEntryAccrual}})
+	require.NoError(t, err)
+	assert.Len(t, accruals.Transactions, 1)
+}
+
+func Test_basicService_transferNeedsConfirmation(t *testing.T) {
+	tests := []struct {
+		policy string
+		amount float64
+		want   bool
+	}{
+		{model.TransferConfirmationNever, 1000, false},
+		{model.TransferConfirmationAlways, 1, true},
+		{model.TransferConfirmationAbove, 50, false},
+		{model.TransferConfirmationAbove, 50.01, true},
+		{"unknown", 1, true},
+	}
+	for _, tt := range tests {
+		s := &basicService{cfg: &config.Config{TransferConfirmation: tt.policy, TransferConfirmationThreshold: 50}}
+		assert.Equal(t, tt.want, s.transferNeedsConfirmation(model.AmountFromFloat(tt.amount)), "%v %v", tt.policy, tt.amount)
+	}
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileNotifier appends messages to a file as JSON lines.
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+type message struct {
+	Type      string    `json:"type"`
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) SendPasswordReset(_ context.Context, login, token string, expiresAt time.Time) error {
+	return n.write(message{
+		Type:      "password_reset",
+		Login:     login,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		SentAt:    time.Now(),
+	})
+}
+
+func (n *FileNotifier) write(m message) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
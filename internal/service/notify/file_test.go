@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileNotifier_SendPasswordReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	n := NewFileNotifier(path)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, n.SendPasswordReset(context.Background(), "first", "token1", expiresAt))
+	require.NoError(t, n.SendPasswordReset(context.Background(), "second", "token2", expiresAt))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var messages []message
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		messages = append(messages, m)
+	}
+	require.Len(t, messages, 2)
+	assert.Equal(t, "password_reset", messages[0].Type)
+	assert.Equal(t, "first", messages[0].Login)
+	assert.Equal(t, "token1", messages[0].Token)
+	assert.True(t, expiresAt.Equal(messages[0].ExpiresAt))
+	assert.Equal(t, "second", messages[1].Login)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/mrkovshik/yandex_diploma/internal/model"
 )
@@ -10,13 +11,71 @@ type Storage interface {
 	AddUser(ctx context.Context, login, password string) (uint, error)
 	GetUserByLogin(ctx context.Context, login string) (user model.User, err error)
 	GetUserByID(ctx context.Context, id uint) (user model.User, err error)
+	SetUserRole(ctx context.Context, userID uint, role model.Role) error
+	UpdateUserPassword(ctx context.Context, userID uint, password string) error
+	CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken) error
+	ResetPassword(ctx context.Context, tokenHash, password string) (userID uint, err error)
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (failures int, previous time.Time, err error)
+	ForgetLoginFailure(ctx context.Context, key string) error
+	BlockLogin(ctx context.Context, key string, until time.Time) error
+	GetLoginBlockedUntil(ctx context.Context, key string) (until time.Time, err error)
+	ResetLoginAttempts(ctx context.Context, key string) error
+	SaveTOTPSecret(ctx context.Context, userID uint, secret string) error
+	GetTOTP(ctx context.Context, userID uint) (totp model.TOTP, err error)
+	EnableTOTP(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (used bool, err error)
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (used bool, err error)
+	DeleteTOTP(ctx context.Context, userID uint) error
+	CreateSession(ctx context.Context, session model.Session) error
+	GetSession(ctx context.Context, id string) (session model.Session, err error)
+	RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (rotated bool, err error)
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userID uint, keepSessionID string) error
 	UploadOrder(ctx context.Context, userID uint, orderNumber string) error
 	GetOrderByNumber(ctx context.Context, orderNumber string) (order model.Order, err error)
-	FinalizeOrderAndUpdateBalance(ctx context.Context, orderNumber string, amount float64) error
+	FinalizeOrderAndUpdateBalance(ctx context.Context, orderNumber string, accrual, tierBonus model.Amount) error
 	SetOrderStatus(ctx context.Context, orderNumber string, status model.OrderState) error
+	ClawbackOrder(ctx context.Context, orderNumber string, allowDebt bool) (order model.Order, err error)
 	GetOrdersByUserID(ctx context.Context, userID uint) ([]model.Order, error)
-	GetPendingOrders(ctx context.Context) (orders []string, err error)
+	LeasePendingOrders(ctx context.Context, token string, limit int, leaseTime time.Duration) (orders []string, err error)
+	RenewOrderLeases(ctx context.Context, token string, leaseTime time.Duration) (orders []string, err error)
+	ReleaseOrder(ctx context.Context, orderNumber, token string, nextCheckIn time.Duration) error
+	GetOrdersWithPendingBonuses(ctx context.Context, limit int) (orders []string, err error)
+	ClearOrderBonusesPending(ctx context.Context, orderNumber string) error
 	ProcessWithdrawal(ctx context.Context, withdrawal model.Withdrawal) error
-	GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (sum float64, err error)
+	ReverseWithdrawal(ctx context.Context, orderNumber string) (withdrawal model.Withdrawal, err error)
+	GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (sum model.Amount, err error)
 	GetWithdrawalsByUserID(ctx context.Context, userID uint) (withdrawals []model.Withdrawal, err error)
+	GetPointLots(ctx context.Context, userID uint, accruedBefore time.Time) (lots []model.PointLot, err error)
+	GetUsersWithExpiredPoints(ctx context.Context, accruedBefore time.Time, afterUserID uint, limit int) (userIDs []uint, err error)
+	ExpirePoints(ctx context.Context, userID uint, accruedBefore time.Time) (expired model.Amount, err error)
+	GetUserTurnover(ctx context.Context, account string, since time.Time) (turnover []model.Turnover, err error)
+	ReplaceUserTiers(ctx context.Context, tiers []model.UserTier) error
+	GetUserTier(ctx context.Context, userID uint) (tier model.UserTier, err error)
+	EnsureReferralCode(ctx context.Context, userID uint, code string) (string, error)
+	GetUserIDByReferralCode(ctx context.Context, code string) (userID uint, err error)
+	AddReferral(ctx context.Context, referral model.Referral) error
+	GetReferral(ctx context.Context, referredID uint) (referral model.Referral, err error)
+	GetReferralsByReferrer(ctx context.Context, referrerID uint) (referrals []model.Referral, err error)
+	CreditReferral(ctx context.Context, referral model.Referral, maxPerReferrer int) (credited bool, err error)
+	RejectReferral(ctx context.Context, referredID uint, reason string) error
+	AddCampaign(ctx context.Context, campaign model.Campaign) (model.Campaign, error)
+	GetCampaign(ctx context.Context, id uint) (campaign model.Campaign, err error)
+	GetCampaigns(ctx context.Context) (campaigns []model.Campaign, err error)
+	GetActiveCampaigns(ctx context.Context, at time.Time) (campaigns []model.Campaign, err error)
+	EndCampaign(ctx context.Context, id uint, at time.Time) (campaign model.Campaign, err error)
+	AddCampaignBonus(ctx context.Context, bonus model.CampaignBonus, perUserCap model.Amount) (credited model.Amount, err error)
+	CreateTransfer(ctx context.Context, transfer model.Transfer, limits model.TransferLimits) (model.Transfer, error)
+	GetTransfer(ctx context.Context, id uint) (transfer model.Transfer, err error)
+	GetTransfersByUserID(ctx context.Context, userID uint) (transfers []model.Transfer, err error)
+	SettleTransfer(ctx context.Context, id uint, status model.TransferStatus) (model.Transfer, error)
+	GetTransactions(ctx context.Context, filter model.TransactionFilter) (transactions []model.Transaction, err error)
+	AdjustBalance(ctx context.Context, adjustment model.BalanceAdjustment) (model.BalanceAdjustment, error)
+	GetBalanceAdjustments(ctx context.Context, userID uint) (adjustments []model.BalanceAdjustment, err error)
+	GetBalanceAt(ctx context.Context, userID uint, at time.Time) (balance model.Amount, err error)
+	GetBalanceDiscrepancies(ctx context.Context) (discrepancies []model.BalanceDiscrepancy, err error)
+	ReserveIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) (stored model.IdempotencyRecord, created bool, err error)
+	SaveIdempotentResponse(ctx context.Context, record model.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, userID uint, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) error
 }
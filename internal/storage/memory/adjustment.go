@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) AdjustBalance(_ context.Context, adjustment model.BalanceAdjustment) (model.BalanceAdjustment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.updateUserBalance(adjustment.UserID, adjustment.Amount); err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	s.lastAdjustID++
+	adjustment.ID = s.lastAdjustID
+	adjustment.CreatedAt = time.Now().UTC()
+	s.adjustments = append(s.adjustments, adjustment)
+	s.addLedgerEntry(adjustment.LedgerEntry())
+	return adjustment, nil
+}
+
+func (s *Storage) GetBalanceAdjustments(_ context.Context, userID uint) ([]model.BalanceAdjustment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var adjustments []model.BalanceAdjustment
+	for _, a := range s.adjustments {
+		if a.UserID == userID {
+			adjustments = append(adjustments, a)
+		}
+	}
+	return adjustments, nil
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) AddCampaign(_ context.Context, campaign model.Campaign) (model.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCampaign++
+	campaign.ID = s.lastCampaign
+	campaign.Tiers = append(model.Tiers{}, campaign.Tiers...)
+	campaign.UserIDs = append([]uint(nil), campaign.UserIDs...)
+	campaign.Granted = 0
+	campaign.CreatedAt = time.Now().UTC()
+	s.campaigns = append(s.campaigns, campaign)
+	return s.withGranted(campaign), nil
+}
+
+func (s *Storage) GetCampaign(_ context.Context, id uint) (model.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.campaigns {
+		if c.ID == id {
+			return s.withGranted(c), nil
+		}
+	}
+	return model.Campaign{}, sql.ErrNoRows
+}
+
+func (s *Storage) GetCampaigns(_ context.Context) ([]model.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var campaigns []model.Campaign
+	for _, c := range s.campaigns {
+		campaigns = append(campaigns, s.withGranted(c))
+	}
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		if !campaigns[i].StartsAt.Equal(campaigns[j].StartsAt) {
+			return campaigns[i].StartsAt.After(campaigns[j].StartsAt)
+		}
+		return campaigns[i].ID > campaigns[j].ID
+	})
+	return campaigns, nil
+}
+
+func (s *Storage) GetActiveCampaigns(_ context.Context, at time.Time) ([]model.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var campaigns []model.Campaign
+	for _, c := range s.campaigns {
+		if c.ActiveAt(at) {
+			campaigns = append(campaigns, s.withGranted(c))
+		}
+	}
+	return campaigns, nil
+}
+
+func (s *Storage) EndCampaign(_ context.Context, id uint, at time.Time) (model.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.campaigns {
+		c := &s.campaigns[i]
+		if c.ID != id {
+			continue
+		}
+		if c.EndsAt.After(at) {
+			c.EndsAt = at
+			if at.Before(c.StartsAt) {
+				c.EndsAt = c.StartsAt
+			}
+		}
+		return s.withGranted(*c), nil
+	}
+	return model.Campaign{}, sql.ErrNoRows
+}
+
+func (s *Storage) AddCampaignBonus(_ context.Context, bonus model.CampaignBonus, perUserCap model.Amount) (model.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[bonus.OrderNumber]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	if o.Status != model.OrderStateProcessed {
+		return 0, nil
+	}
+	var granted model.Amount
+	for _, b := range s.bonuses {
+		if b.CampaignID != bonus.CampaignID {
+			continue
+		}
+		if b.OrderNumber == bonus.OrderNumber {
+			return 0, nil
+		}
+		if b.UserID == bonus.UserID {
+			granted += b.Amount
+		}
+	}
+	if perUserCap > 0 {
+		bonus.Amount = min(bonus.Amount, perUserCap-granted)
+	}
+	if bonus.Amount <= 0 {
+		return 0, nil
+	}
+	if err := s.updateUserBalance(bonus.UserID, bonus.Amount); err != nil {
+		return 0, err
+	}
+	s.lastBonusID++
+	bonus.ID = s.lastBonusID
+	bonus.CreatedAt = time.Now().UTC()
+	s.bonuses = append(s.bonuses, bonus)
+	s.addLedgerEntry(bonus.LedgerEntry())
+	return bonus.Amount, nil
+}
+
+// withGranted returns a copy of the campaign with the sum of its bonuses. It must be called with s.mu held.
+func (s *Storage) withGranted(campaign model.Campaign) model.Campaign {
+	campaign.Tiers = append(model.Tiers{}, campaign.Tiers...)
+	campaign.UserIDs = append([]uint(nil), campaign.UserIDs...)
+	for _, b := range s.bonuses {
+		if b.CampaignID == campaign.ID {
+			campaign.Granted += b.Amount
+		}
+	}
+	return campaign
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type loginAttempts struct {
+	failures          int
+	lastFailureAt     time.Time
+	previousFailureAt time.Time
+	blockedUntil      time.Time
+}
+
+func (s *Storage) RecordLoginFailure(_ context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	attempts, ok := s.logins[key]
+	if !ok {
+		attempts = &loginAttempts{}
+		s.logins[key] = attempts
+	}
+	if attempts.lastFailureAt.Before(now.Add(-window)) {
+		attempts.failures = 0
+	}
+	attempts.failures++
+	attempts.previousFailureAt, attempts.lastFailureAt = attempts.lastFailureAt, now
+	return attempts.failures, attempts.previousFailureAt, nil
+}
+
+func (s *Storage) ForgetLoginFailure(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempts, ok := s.logins[key]; ok && attempts.failures > 0 {
+		attempts.failures--
+	}
+	return nil
+}
+
+func (s *Storage) BlockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempts, ok := s.logins[key]; ok && attempts.blockedUntil.Before(until) {
+		attempts.blockedUntil = until.UTC()
+	}
+	return nil
+}
+
+func (s *Storage) GetLoginBlockedUntil(_ context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempts, ok := s.logins[key]; ok {
+		return attempts.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *Storage) ResetLoginAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logins, key)
+	return nil
+}
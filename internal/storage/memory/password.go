@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) UpdateUserPassword(_ context.Context, userID uint, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Password = password
+	return nil
+}
+
+func (s *Storage) CreatePasswordResetToken(_ context.Context, token model.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	s.resetTokens[token.TokenHash] = token
+	return nil
+}
+
+func (s *Storage) ResetPassword(_ context.Context, tokenHash, password string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	token, ok := s.resetTokens[tokenHash]
+	if !ok || token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+		return 0, apperrors.ErrInvalidResetToken
+	}
+	user, ok := s.users[token.UserID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	user.Password = password
+	for hash, t := range s.resetTokens {
+		if t.UserID == token.UserID && t.UsedAt == nil {
+			t.UsedAt = &now
+			s.resetTokens[hash] = t
+		}
+	}
+	return token.UserID, nil
+}
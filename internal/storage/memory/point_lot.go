@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) GetPointLots(_ context.Context, userID uint, accruedBefore time.Time) ([]model.PointLot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lots []model.PointLot
+	for _, lot := range s.lots {
+		if lot.UserID == userID && lot.Remaining > 0 && !lot.AccruedAt.After(accruedBefore) {
+			lots = append(lots, lot)
+		}
+	}
+	return lots, nil
+}
+
+func (s *Storage) GetUsersWithExpiredPoints(_ context.Context, accruedBefore time.Time, afterUserID uint, limit int) ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[uint]bool)
+	var userIDs []uint
+	for _, lot := range s.lots {
+		if lot.Remaining > 0 && !lot.AccruedAt.After(accruedBefore) && lot.UserID > afterUserID && !seen[lot.UserID] {
+			seen[lot.UserID] = true
+			userIDs = append(userIDs, lot.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	if len(userIDs) > limit {
+		userIDs = userIDs[:limit]
+	}
+	return userIDs, nil
+}
+
+func (s *Storage) ExpirePoints(_ context.Context, userID uint, accruedBefore time.Time) (model.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired model.Amount
+	for _, lot := range s.lots {
+		if lot.UserID == userID && !lot.AccruedAt.After(accruedBefore) {
+			expired += lot.Remaining
+		}
+	}
+	if expired == 0 {
+		return 0, nil
+	}
+	// the expired lots are the oldest ones, so the debit consumes exactly them
+	if err := s.updateUserBalance(userID, -expired); err != nil {
+		return 0, err
+	}
+	s.addLedgerEntry(model.LedgerEntry{
+		Type:          model.LedgerEntryExpiration,
+		DebitAccount:  model.UserAccount(userID),
+		CreditAccount: model.SystemAccountExpirations,
+		Amount:        expired,
+	})
+	return expired, nil
+}
+
+// updatePointLots follows a change of the user's balance by amount that left it at balance,
+// see the postgres storage. Lots are kept in the order of accrual. It must be called with s.mu held.
+func (s *Storage) updatePointLots(userID uint, amount, balance model.Amount, from []model.PointLot) []model.PointLot {
+	if amount > 0 {
+		for _, lot := range model.CarryPointLots(from, amount, min(amount, balance), time.Now().UTC()) {
+			s.lastLotID++
+			lot.ID = s.lastLotID
+			lot.UserID = userID
+			i := sort.Search(len(s.lots), func(i int) bool { return s.lots[i].AccruedAt.After(lot.AccruedAt) })
+			s.lots = slices.Insert(s.lots, i, lot)
+		}
+		return nil
+	}
+	debit := -amount
+	var taken []model.PointLot
+	for i := range s.lots {
+		lot := &s.lots[i]
+		if debit == 0 {
+			break
+		}
+		if lot.UserID != userID || lot.Remaining == 0 {
+			continue
+		}
+		used := min(lot.Remaining, debit)
+		lot.Remaining -= used
+		taken = append(taken, model.PointLot{Amount: used, AccruedAt: lot.AccruedAt})
+		debit -= used
+	}
+	return taken
+}
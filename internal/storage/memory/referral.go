@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) EnsureReferralCode(_ context.Context, userID uint, code string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, id := range s.referralCodes {
+		if id == userID {
+			return c, nil
+		}
+	}
+	if _, ok := s.referralCodes[code]; ok {
+		return "", errors.New("referral code is taken")
+	}
+	s.referralCodes[code] = userID
+	return code, nil
+}
+
+func (s *Storage) GetUserIDByReferralCode(_ context.Context, code string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID, ok := s.referralCodes[code]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+func (s *Storage) AddReferral(_ context.Context, referral model.Referral) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	referral.Status = model.ReferralStatusPending
+	referral.CreatedAt = time.Now().UTC()
+	s.referrals[referral.ReferredID] = &referral
+	return nil
+}
+
+func (s *Storage) GetReferral(_ context.Context, referredID uint) (model.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	referral, ok := s.referrals[referredID]
+	if !ok {
+		return model.Referral{}, sql.ErrNoRows
+	}
+	return s.withReferredLogin(*referral), nil
+}
+
+func (s *Storage) GetReferralsByReferrer(_ context.Context, referrerID uint) ([]model.Referral, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var referrals []model.Referral
+	for _, referral := range s.referrals {
+		if referral.ReferrerID == referrerID {
+			referrals = append(referrals, s.withReferredLogin(*referral))
+		}
+	}
+	sort.Slice(referrals, func(i, j int) bool { return referrals[i].ReferredID < referrals[j].ReferredID })
+	return referrals, nil
+}
+
+func (s *Storage) CreditReferral(_ context.Context, referral model.Referral, maxPerReferrer int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[referral.OrderNumber]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	stored, ok := s.referrals[referral.ReferredID]
+	if !ok || stored.Status != model.ReferralStatusPending || o.Status != model.OrderStateProcessed {
+		return false, nil
+	}
+	if maxPerReferrer > 0 {
+		credited := 0
+		for _, r := range s.referrals {
+			if r.ReferrerID == referral.ReferrerID && r.Status == model.ReferralStatusCredited {
+				credited++
+			}
+		}
+		if credited >= maxPerReferrer {
+			return false, apperrors.ErrReferralLimit
+		}
+	}
+	for _, bonus := range referral.Bonuses() {
+		if _, ok := s.users[bonus.UserID]; !ok {
+			return false, sql.ErrNoRows
+		}
+	}
+	for _, bonus := range referral.Bonuses() {
+		if err := s.updateUserBalance(bonus.UserID, bonus.Amount); err != nil {
+			return false, err
+		}
+		s.addLedgerEntry(bonus.LedgerEntry(referral.OrderNumber))
+	}
+	now := time.Now().UTC()
+	stored.Status = model.ReferralStatusCredited
+	stored.OrderNumber = referral.OrderNumber
+	stored.ReferrerBonus = referral.ReferrerBonus
+	stored.RefereeBonus = referral.RefereeBonus
+	stored.SettledAt = &now
+	return true, nil
+}
+
+func (s *Storage) RejectReferral(_ context.Context, referredID uint, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if referral, ok := s.referrals[referredID]; ok && referral.Status == model.ReferralStatusPending {
+		now := time.Now().UTC()
+		referral.Status = model.ReferralStatusRejected
+		referral.RejectReason = reason
+		referral.SettledAt = &now
+	}
+	return nil
+}
+
+// withReferredLogin must be called with s.mu held.
+func (s *Storage) withReferredLogin(referral model.Referral) model.Referral {
+	if user, ok := s.users[referral.ReferredID]; ok {
+		referral.ReferredLogin = user.Login
+	}
+	return referral
+}
@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) CreateSession(_ context.Context, session model.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.CreatedAt = session.CreatedAt.UTC()
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *Storage) GetSession(_ context.Context, id string) (model.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return model.Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (s *Storage) RotateSession(_ context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || session.RefreshTokenHash != oldHash || !session.Active(time.Now()) {
+		return false, nil
+	}
+	session.RefreshTokenHash = newHash
+	session.ExpiresAt = expiresAt.UTC()
+	s.sessions[id] = session
+	return true, nil
+}
+
+func (s *Storage) RevokeSession(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now().UTC()
+		session.RevokedAt = &now
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *Storage) RevokeUserSessions(_ context.Context, userID uint, keepSessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != keepSessionID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,545 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	server "github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+// Storage keeps all data in process memory. Every method holds a single lock,
+// so multi-step operations are as atomic as postgres transactions.
+type Storage struct {
+	mu            sync.Mutex
+	users         map[uint]*model.User
+	usersByLogin  map[string]uint
+	orders        map[string]*order
+	withdrawals   []model.Withdrawal
+	adjustments   []model.BalanceAdjustment
+	lots          []model.PointLot
+	holds         map[pointLotHold][]model.PointLot
+	ledger        []model.LedgerEntry
+	idempotency   map[idempotencyKey]model.IdempotencyRecord
+	sessions      map[string]model.Session
+	resetTokens   map[string]model.PasswordResetToken
+	logins        map[string]*loginAttempts
+	totp          map[uint]model.TOTP
+	recoveryCodes map[uint]recoveryCodes
+	tiers         map[uint]model.UserTier
+	referralCodes map[string]uint
+	referrals     map[uint]*model.Referral
+	campaigns     []model.Campaign
+	bonuses       []model.CampaignBonus
+	transfers     []model.Transfer
+	lastUserID    uint
+	lastOrderID   uint
+	lastWithdraw  uint
+	lastEntryID   uint
+	lastAdjustID  uint
+	lastLotID     uint
+	lastCampaign  uint
+	lastBonusID   uint
+	lastTransfer  uint
+}
+
+type order struct {
+	model.Order
+	nextCheckAt    time.Time
+	leasedUntil    time.Time
+	leaseToken     string
+	bonusesPending bool
+}
+
+// pointLotHold identifies the withdrawal or the pending transfer holding points taken from lots.
+type pointLotHold struct {
+	orderNumber string
+	transferID  uint
+}
+
+type idempotencyKey struct {
+	userID uint
+	key    string
+}
+
+func NewStorage() server.Storage {
+	return &Storage{
+		users:         make(map[uint]*model.User),
+		usersByLogin:  make(map[string]uint),
+		orders:        make(map[string]*order),
+		holds:         make(map[pointLotHold][]model.PointLot),
+		idempotency:   make(map[idempotencyKey]model.IdempotencyRecord),
+		sessions:      make(map[string]model.Session),
+		resetTokens:   make(map[string]model.PasswordResetToken),
+		logins:        make(map[string]*loginAttempts),
+		totp:          make(map[uint]model.TOTP),
+		recoveryCodes: make(map[uint]recoveryCodes),
+		tiers:         make(map[uint]model.UserTier),
+		referralCodes: make(map[string]uint),
+		referrals:     make(map[uint]*model.Referral),
+	}
+}
+
+func (s *Storage) AddUser(_ context.Context, login, password string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.usersByLogin[login]; ok {
+		return 0, apperrors.ErrUserAlreadyExists
+	}
+	s.lastUserID++
+	s.users[s.lastUserID] = &model.User{
+		ID:        s.lastUserID,
+		Login:     login,
+		Password:  password,
+		Role:      model.RoleUser,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.usersByLogin[login] = s.lastUserID
+	return s.lastUserID, nil
+}
+
+func (s *Storage) GetUserByLogin(_ context.Context, login string) (model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.usersByLogin[login]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	return *s.users[id], nil
+}
+
+func (s *Storage) GetUserByID(_ context.Context, id uint) (model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	return *user, nil
+}
+
+func (s *Storage) SetUserRole(_ context.Context, userID uint, role model.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Role = role
+	return nil
+}
+
+func (s *Storage) UploadOrder(_ context.Context, userID uint, orderNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orders[orderNumber]; ok {
+		return apperrors.ErrOrderAlreadyUploaded
+	}
+	now := time.Now().UTC()
+	s.lastOrderID++
+	s.orders[orderNumber] = &order{
+		Order: model.Order{
+			ID:          s.lastOrderID,
+			OrderNumber: orderNumber,
+			UserID:      userID,
+			Status:      model.OrderStateNew,
+			UploadedAt:  now,
+		},
+		nextCheckAt: now,
+	}
+	return nil
+}
+
+func (s *Storage) GetOrderByNumber(_ context.Context, orderNumber string) (model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[orderNumber]
+	if !ok {
+		return model.Order{}, sql.ErrNoRows
+	}
+	return o.Order, nil
+}
+
+func (s *Storage) FinalizeOrderAndUpdateBalance(_ context.Context, orderNumber string, accrual, tierBonus model.Amount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[orderNumber]
+	if !ok || o.Status == model.OrderStateProcessed || o.Status == model.OrderStateReversed {
+		return nil
+	}
+	if err := s.updateUserBalance(o.UserID, accrual+tierBonus); err != nil {
+		return err
+	}
+	o.Status = model.OrderStateProcessed
+	o.Accrual = accrual
+	o.TierBonus = tierBonus
+	o.bonusesPending = true
+	for _, entry := range o.AccrualEntries() {
+		s.addLedgerEntry(entry)
+	}
+	return nil
+}
+
+func (s *Storage) SetOrderStatus(_ context.Context, orderNumber string, status model.OrderState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.orders[orderNumber]; ok && o.Status != model.OrderStateProcessed && o.Status != model.OrderStateReversed {
+		o.Status = status
+	}
+	return nil
+}
+
+func (s *Storage) ClawbackOrder(_ context.Context, orderNumber string, allowDebt bool) (model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[orderNumber]
+	if !ok {
+		return model.Order{}, sql.ErrNoRows
+	}
+	switch o.Status {
+	case model.OrderStateProcessed:
+	case model.OrderStateReversed:
+		return model.Order{}, apperrors.ErrOrderAlreadyReversed
+	default:
+		return model.Order{}, apperrors.ErrOrderNotProcessed
+	}
+	var campaignBonuses model.Amount
+	for _, b := range s.bonuses {
+		if b.OrderNumber == orderNumber {
+			campaignBonuses += b.Amount
+		}
+	}
+	entries := o.ClawbackEntries(campaignBonuses)
+	debits := make(map[uint]model.Amount)
+	for _, entry := range entries {
+		debits[o.UserID] += entry.Amount
+	}
+	// the referral bonuses paid for the order go back as well
+	var referrals []*model.Referral
+	for _, referral := range s.referrals {
+		if referral.OrderNumber == orderNumber && referral.Status == model.ReferralStatusCredited {
+			referrals = append(referrals, referral)
+			for _, bonus := range referral.Bonuses() {
+				debits[bonus.UserID] += bonus.Amount
+				entries = append(entries, bonus.ReversalEntry(orderNumber))
+			}
+		}
+	}
+	for userID, total := range debits {
+		user, ok := s.users[userID]
+		if !ok {
+			return model.Order{}, sql.ErrNoRows
+		}
+		if !allowDebt && user.Balance < total {
+			return model.Order{}, apperrors.ErrNotEnoughFunds
+		}
+	}
+	for userID, total := range debits {
+		user := s.users[userID]
+		user.Debt += max(total-user.Balance, 0)
+		user.Balance = max(user.Balance-total, 0)
+		s.updatePointLots(userID, -total, user.Balance, nil)
+	}
+	for _, referral := range referrals {
+		referral.Status = model.ReferralStatusReversed
+	}
+	for _, entry := range entries {
+		s.addLedgerEntry(entry)
+	}
+	o.Status = model.OrderStateReversed
+	return o.Order, nil
+}
+
+func (s *Storage) GetOrdersByUserID(_ context.Context, userID uint) ([]model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []model.Order
+	for _, o := range s.orders {
+		if o.UserID == userID {
+			orders = append(orders, o.Order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders, nil
+}
+
+func (s *Storage) LeasePendingOrders(_ context.Context, token string, limit int, leaseTime time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	var due []*order
+	for _, o := range s.orders {
+		if (o.Status == model.OrderStateNew || o.Status == model.OrderStateProcessing) &&
+			!o.nextCheckAt.After(now) && o.leasedUntil.Before(now) {
+			due = append(due, o)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].nextCheckAt.Before(due[j].nextCheckAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	orders := make([]string, 0, len(due))
+	for _, o := range due {
+		o.leasedUntil = now.Add(leaseTime)
+		o.leaseToken = token
+		orders = append(orders, o.OrderNumber)
+	}
+	return orders, nil
+}
+
+func (s *Storage) RenewOrderLeases(_ context.Context, token string, leaseTime time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var orders []string
+	for _, o := range s.orders {
+		if o.leaseToken == token && !o.leasedUntil.IsZero() {
+			o.leasedUntil = time.Now().UTC().Add(leaseTime)
+			orders = append(orders, o.OrderNumber)
+		}
+	}
+	return orders, nil
+}
+
+func (s *Storage) ReleaseOrder(_ context.Context, orderNumber, token string, nextCheckIn time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.orders[orderNumber]; ok && o.leaseToken == token {
+		o.leasedUntil = time.Time{}
+		o.leaseToken = ""
+		o.nextCheckAt = time.Now().UTC().Add(nextCheckIn)
+	}
+	return nil
+}
+
+func (s *Storage) GetOrdersWithPendingBonuses(_ context.Context, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []*order
+	for _, o := range s.orders {
+		if o.bonusesPending {
+			pending = append(pending, o)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	orders := make([]string, 0, len(pending))
+	for _, o := range pending {
+		orders = append(orders, o.OrderNumber)
+	}
+	return orders, nil
+}
+
+func (s *Storage) ClearOrderBonusesPending(_ context.Context, orderNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.orders[orderNumber]; ok {
+		o.bonusesPending = false
+	}
+	return nil
+}
+
+func (s *Storage) ProcessWithdrawal(_ context.Context, withdrawal model.Withdrawal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.withdrawals {
+		if w.OrderNumber == withdrawal.OrderNumber {
+			return apperrors.ErrWithdrawalAlreadyExists
+		}
+	}
+	lots, err := s.moveUserBalance(withdrawal.UserID, -withdrawal.Amount, nil)
+	if err != nil {
+		return err
+	}
+	s.holds[pointLotHold{orderNumber: withdrawal.OrderNumber}] = lots
+	s.lastWithdraw++
+	withdrawal.ID = s.lastWithdraw
+	withdrawal.ProcessedAt = time.Now().UTC()
+	withdrawal.Status = model.WithdrawalStateProcessed
+	s.withdrawals = append(s.withdrawals, withdrawal)
+	s.addLedgerEntry(model.LedgerEntry{
+		Type:          model.LedgerEntryWithdrawal,
+		DebitAccount:  model.UserAccount(withdrawal.UserID),
+		CreditAccount: model.SystemAccountWithdrawals,
+		Amount:        withdrawal.Amount,
+		OrderNumber:   withdrawal.OrderNumber,
+	})
+	return nil
+}
+
+func (s *Storage) ReverseWithdrawal(_ context.Context, orderNumber string) (model.Withdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.withdrawals {
+		w := &s.withdrawals[i]
+		if w.OrderNumber != orderNumber {
+			continue
+		}
+		if w.Status == model.WithdrawalStateReversed {
+			return model.Withdrawal{}, apperrors.ErrWithdrawalAlreadyReversed
+		}
+		hold := pointLotHold{orderNumber: w.OrderNumber}
+		if _, err := s.moveUserBalance(w.UserID, w.Amount, s.holds[hold]); err != nil {
+			return model.Withdrawal{}, err
+		}
+		delete(s.holds, hold)
+		now := time.Now().UTC()
+		w.Status = model.WithdrawalStateReversed
+		w.ReversedAt = &now
+		s.addLedgerEntry(model.LedgerEntry{
+			Type:          model.LedgerEntryReversal,
+			DebitAccount:  model.SystemAccountWithdrawals,
+			CreditAccount: model.UserAccount(w.UserID),
+			Amount:        w.Amount,
+			OrderNumber:   w.OrderNumber,
+		})
+		return *w, nil
+	}
+	return model.Withdrawal{}, sql.ErrNoRows
+}
+
+func (s *Storage) GetWithdrawalsSumByUserID(_ context.Context, userID uint) (model.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum model.Amount
+	for _, w := range s.withdrawals {
+		if w.UserID == userID && w.Status == model.WithdrawalStateProcessed {
+			sum += w.Amount
+		}
+	}
+	return sum, nil
+}
+
+func (s *Storage) GetWithdrawalsByUserID(_ context.Context, userID uint) ([]model.Withdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var withdrawals []model.Withdrawal
+	for _, w := range s.withdrawals {
+		if w.UserID == userID {
+			withdrawals = append(withdrawals, w)
+		}
+	}
+	return withdrawals, nil
+}
+
+func (s *Storage) GetBalanceAt(_ context.Context, userID uint, at time.Time) (model.Amount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ledgerBalance(model.UserAccount(userID), at), nil
+}
+
+func (s *Storage) GetBalanceDiscrepancies(_ context.Context) ([]model.BalanceDiscrepancy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var discrepancies []model.BalanceDiscrepancy
+	for id := uint(1); id <= s.lastUserID; id++ {
+		user := s.users[id]
+		if ledger := s.ledgerBalance(model.UserAccount(id), time.Now().UTC()); ledger != user.Balance-user.Debt {
+			discrepancies = append(discrepancies, model.BalanceDiscrepancy{
+				UserID:        id,
+				Balance:       user.Balance - user.Debt,
+				LedgerBalance: ledger,
+			})
+		}
+	}
+	return discrepancies, nil
+}
+
+func (s *Storage) ReserveIdempotencyKey(_ context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	now := time.Now().UTC()
+	if stored, ok := s.idempotency[k]; ok && !stored.ExpiresAt.Before(now) && (stored.StatusCode != 0 || !stored.LockedUntil.Before(now)) {
+		return stored, false, nil
+	}
+	record.StatusCode, record.ContentType, record.Body = 0, "", nil
+	s.idempotency[k] = record
+	return record, true, nil
+}
+
+func (s *Storage) SaveIdempotentResponse(_ context.Context, record model.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey{userID: record.UserID, key: record.Key}
+	if stored, ok := s.idempotency[k]; ok {
+		stored.StatusCode = record.StatusCode
+		stored.ContentType = record.ContentType
+		stored.Body = append([]byte(nil), record.Body...)
+		s.idempotency[k] = stored
+	}
+	return nil
+}
+
+func (s *Storage) DeleteIdempotencyKey(_ context.Context, userID uint, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotency, idempotencyKey{userID: userID, key: key})
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for k, record := range s.idempotency {
+		if record.ExpiresAt.Before(now) {
+			delete(s.idempotency, k)
+		}
+	}
+	return nil
+}
+
+// updateUserBalance must be called with s.mu held.
+func (s *Storage) updateUserBalance(userID uint, amount model.Amount) error {
+	_, err := s.moveUserBalance(userID, amount, nil)
+	return err
+}
+
+// moveUserBalance adds amount to the user's balance like updateUserBalance, keeping the accrual time
+// of the lots in from for a credit and returning the lots consumed by a debit, see the postgres storage.
+// It must be called with s.mu held.
+func (s *Storage) moveUserBalance(userID uint, amount model.Amount, from []model.PointLot) ([]model.PointLot, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if amount < 0 && user.Balance+amount < 0 {
+		return nil, apperrors.ErrNotEnoughFunds
+	}
+	// a credit pays off the debt first
+	paid := min(user.Debt, max(amount, 0))
+	user.Debt -= paid
+	user.Balance += amount - paid
+	return s.updatePointLots(userID, amount, user.Balance, from), nil
+}
+
+// addLedgerEntry must be called with s.mu held.
+func (s *Storage) addLedgerEntry(entry model.LedgerEntry) {
+	s.lastEntryID++
+	entry.ID = s.lastEntryID
+	entry.CreatedAt = time.Now().UTC()
+	s.ledger = append(s.ledger, entry)
+}
+
+// ledgerBalance must be called with s.mu held.
+func (s *Storage) ledgerBalance(account string, at time.Time) model.Amount {
+	var balance model.Amount
+	for _, entry := range s.ledger {
+		if entry.CreatedAt.After(at) {
+			continue
+		}
+		if entry.CreditAccount == account {
+			balance += entry.Amount
+		}
+		if entry.DebitAccount == account {
+			balance -= entry.Amount
+		}
+	}
+	return balance
+}
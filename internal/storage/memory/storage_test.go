@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return NewStorage()
+	})
+}
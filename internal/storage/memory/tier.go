@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) GetUserTurnover(_ context.Context, account string, since time.Time) ([]model.Turnover, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make(map[string]uint, len(s.users))
+	for id := range s.users {
+		users[model.UserAccount(id)] = id
+	}
+	sums := make(map[uint]model.Amount)
+	for _, entry := range s.ledger {
+		if entry.CreatedAt.Before(since) {
+			continue
+		}
+		if userID, ok := users[entry.CreditAccount]; ok && entry.DebitAccount == account {
+			sums[userID] += entry.Amount
+		}
+		if userID, ok := users[entry.DebitAccount]; ok && entry.CreditAccount == account {
+			sums[userID] -= entry.Amount
+		}
+	}
+	turnover := make([]model.Turnover, 0, len(sums))
+	for userID, amount := range sums {
+		turnover = append(turnover, model.Turnover{UserID: userID, Amount: amount})
+	}
+	sort.Slice(turnover, func(i, j int) bool { return turnover[i].UserID < turnover[j].UserID })
+	return turnover, nil
+}
+
+func (s *Storage) ReplaceUserTiers(_ context.Context, tiers []model.UserTier) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tiers = make(map[uint]model.UserTier, len(tiers))
+	for _, tier := range tiers {
+		s.tiers[tier.UserID] = tier
+	}
+	return nil
+}
+
+func (s *Storage) GetUserTier(_ context.Context, userID uint) (model.UserTier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tier, ok := s.tiers[userID]
+	if !ok {
+		return model.UserTier{}, sql.ErrNoRows
+	}
+	return tier, nil
+}
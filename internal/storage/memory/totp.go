@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// recoveryCodes maps code hashes of a user to whether the code is used.
+type recoveryCodes map[string]bool
+
+func (s *Storage) SaveTOTPSecret(_ context.Context, userID uint, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if totp, ok := s.totp[userID]; ok && totp.Enabled() {
+		return apperrors.ErrTOTPAlreadyEnabled
+	}
+	s.totp[userID] = model.TOTP{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	return nil
+}
+
+func (s *Storage) GetTOTP(_ context.Context, userID uint) (model.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totp, ok := s.totp[userID]
+	if !ok {
+		return model.TOTP{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+func (s *Storage) EnableTOTP(_ context.Context, userID uint, step int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totp, ok := s.totp[userID]
+	if !ok || totp.Enabled() {
+		return apperrors.ErrTOTPAlreadyEnabled
+	}
+	now := time.Now().UTC()
+	totp.ConfirmedAt = &now
+	totp.LastUsedStep = step
+	s.totp[userID] = totp
+	codes := make(recoveryCodes, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (s *Storage) UseTOTPStep(_ context.Context, userID uint, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totp, ok := s.totp[userID]
+	if !ok || totp.LastUsedStep >= step {
+		return false, nil
+	}
+	totp.LastUsedStep = step
+	s.totp[userID] = totp
+	return true, nil
+}
+
+func (s *Storage) UseRecoveryCode(_ context.Context, userID uint, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used, ok := s.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	s.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+func (s *Storage) DeleteTOTP(_ context.Context, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.totp, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
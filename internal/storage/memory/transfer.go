@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) CreateTransfer(_ context.Context, transfer model.Transfer, limits model.TransferLimits) (model.Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[transfer.RecipientID]; !ok {
+		return model.Transfer{}, sql.ErrNoRows
+	}
+	var sent model.Amount
+	var count int
+	for _, t := range s.transfers {
+		if t.SenderID == transfer.SenderID && t.CreatedAt.After(limits.Since) &&
+			(t.Status == model.TransferStatusPending || t.Status == model.TransferStatusCompleted) {
+			sent += t.Amount
+			count++
+		}
+	}
+	if limits.Exceeded(sent, count, transfer.Amount) {
+		return model.Transfer{}, apperrors.ErrTransferLimitExceeded
+	}
+	lots, err := s.moveUserBalance(transfer.SenderID, -transfer.Amount, nil)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	s.lastTransfer++
+	transfer.ID = s.lastTransfer
+	if transfer.Status == model.TransferStatusCompleted {
+		if _, err := s.moveUserBalance(transfer.RecipientID, transfer.Amount, lots); err != nil {
+			return model.Transfer{}, err
+		}
+	} else {
+		s.holds[pointLotHold{transferID: transfer.ID}] = lots
+	}
+	transfer.CreatedAt = time.Now().UTC()
+	transfer.SettledAt = nil
+	if transfer.Status != model.TransferStatusPending {
+		settledAt := transfer.CreatedAt
+		transfer.SettledAt = &settledAt
+	}
+	s.transfers = append(s.transfers, transfer)
+	s.addLedgerEntry(transfer.LedgerEntry(""))
+	return s.withLogins(transfer), nil
+}
+
+func (s *Storage) GetTransfer(_ context.Context, id uint) (model.Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.transfers {
+		if t.ID == id {
+			return s.withLogins(t), nil
+		}
+	}
+	return model.Transfer{}, sql.ErrNoRows
+}
+
+func (s *Storage) GetTransfersByUserID(_ context.Context, userID uint) ([]model.Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var transfers []model.Transfer
+	for i := len(s.transfers) - 1; i >= 0; i-- {
+		if t := s.transfers[i]; t.SenderID == userID || t.RecipientID == userID {
+			transfers = append(transfers, s.withLogins(t))
+		}
+	}
+	return transfers, nil
+}
+
+func (s *Storage) SettleTransfer(_ context.Context, id uint, status model.TransferStatus) (model.Transfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.transfers {
+		t := &s.transfers[i]
+		if t.ID != id {
+			continue
+		}
+		if t.Status != model.TransferStatusPending {
+			return model.Transfer{}, apperrors.ErrTransferNotPending
+		}
+		userID := t.SenderID
+		if status == model.TransferStatusCompleted {
+			userID = t.RecipientID
+		}
+		hold := pointLotHold{transferID: t.ID}
+		if _, err := s.moveUserBalance(userID, t.Amount, s.holds[hold]); err != nil {
+			return model.Transfer{}, err
+		}
+		delete(s.holds, hold)
+		settledAt := time.Now().UTC()
+		t.Status = status
+		t.SettledAt = &settledAt
+		s.addLedgerEntry(t.LedgerEntry(model.TransferStatusPending))
+		return s.withLogins(*t), nil
+	}
+	return model.Transfer{}, sql.ErrNoRows
+}
+
+func (s *Storage) GetTransactions(_ context.Context, filter model.TransactionFilter) ([]model.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID := filter.UserID
+	account := model.UserAccount(userID)
+	var transactions []model.Transaction
+	for _, entry := range s.ledger {
+		if entry.CreditAccount != account && entry.DebitAccount != account {
+			continue
+		}
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, entry.Type) {
+			continue
+		}
+		if !filter.From.IsZero() && entry.CreatedAt.Before(filter.From) || !filter.To.IsZero() && !entry.CreatedAt.Before(filter.To) {
+			continue
+		}
+		transaction := model.Transaction{
+			ID:          entry.ID,
+			Type:        entry.Type,
+			Amount:      entry.Amount,
+			OrderNumber: entry.OrderNumber,
+			TransferID:  entry.TransferID,
+			CreatedAt:   entry.CreatedAt,
+		}
+		if entry.DebitAccount == account {
+			transaction.Amount = -entry.Amount
+		}
+		for _, t := range s.transfers {
+			if entry.TransferID != 0 && t.ID == entry.TransferID {
+				t = s.withLogins(t)
+				transaction.Counterparty = t.SenderLogin
+				if t.SenderID == userID {
+					transaction.Counterparty = t.RecipientLogin
+				}
+			}
+		}
+		transactions = append(transactions, transaction)
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Equal(transactions[j].CreatedAt) {
+			return transactions[i].CreatedAt.After(transactions[j].CreatedAt)
+		}
+		return transactions[i].ID > transactions[j].ID
+	})
+	if filter.After != nil {
+		i := 0
+		for i < len(transactions) && !filter.After.Before(transactions[i]) {
+			i++
+		}
+		transactions = transactions[i:]
+	}
+	if filter.Limit > 0 && len(transactions) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+	}
+	return transactions, nil
+}
+
+// withLogins must be called with s.mu held.
+func (s *Storage) withLogins(transfer model.Transfer) model.Transfer {
+	if sender, ok := s.users[transfer.SenderID]; ok {
+		transfer.SenderLogin = sender.Login
+	}
+	if recipient, ok := s.users[transfer.RecipientID]; ok {
+		transfer.RecipientLogin = recipient.Login
+	}
+	return transfer
+}
@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// AdjustBalance changes the user's balance by adjustment.Amount and records the adjustment and its
+// ledger entry in the same transaction. A debit below zero fails with apperrors.ErrNotEnoughFunds.
+func (s *Storage) AdjustBalance(ctx context.Context, adjustment model.BalanceAdjustment) (model.BalanceAdjustment, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	if err := s.updateUserBalanceByUserIDTx(ctx, adjustment.UserID, adjustment.Amount, tx); err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	adjustment.CreatedAt = time.Now().UTC()
+	if err := tx.GetContext(ctx, &adjustment.ID, `INSERT INTO balance_adjustments (user_id, operator_id, amount, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		adjustment.UserID, adjustment.OperatorID, adjustment.Amount, adjustment.Reason, adjustment.CreatedAt); err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	if err := s.addLedgerEntryTx(ctx, adjustment.LedgerEntry(), tx); err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.BalanceAdjustment{}, err
+	}
+	return adjustment, nil
+}
+
+func (s *Storage) GetBalanceAdjustments(ctx context.Context, userID uint) (adjustments []model.BalanceAdjustment, err error) {
+	err = s.db.SelectContext(ctx, &adjustments, "SELECT id, user_id, operator_id, amount, reason, created_at FROM balance_adjustments WHERE user_id = $1 ORDER BY id", userID)
+	return
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service/calculator"
+)
+
+type CalculatorStorage struct {
+	db *sqlx.DB
+}
+
+func NewCalculatorStorage(db *sqlx.DB) calculator.Storage {
+	return &CalculatorStorage{db: db}
+}
+
+func (s *CalculatorStorage) AddRewardRule(ctx context.Context, rule model.RewardRule) error {
+	res, err := s.db.ExecContext(ctx, "INSERT INTO accrual_rewards (match, reward, reward_type) VALUES ($1, $2, $3) ON CONFLICT (match) DO NOTHING",
+		rule.Match, rule.Reward, rule.RewardType)
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return apperrors.ErrRewardRuleAlreadyExists
+	}
+	return nil
+}
+
+func (s *CalculatorStorage) GetRewardRules(ctx context.Context) (rules []model.RewardRule, err error) {
+	err = s.db.SelectContext(ctx, &rules, "SELECT id, match, reward, reward_type FROM accrual_rewards ORDER BY id")
+	return
+}
+
+func (s *CalculatorStorage) AddOrder(ctx context.Context, order model.AccrualOrder) error {
+	tx, err := s.db.Beginx()
+	defer tx.Rollback() //nolint:all
+	if err != nil {
+		return err
+	}
+	var orderIDs []uint
+	if err := tx.SelectContext(ctx, &orderIDs, "INSERT INTO accrual_orders (order_number, status, created_at) VALUES ($1, $2, $3) ON CONFLICT (order_number) DO NOTHING RETURNING id",
+		order.OrderNumber, order.Status, time.Now().UTC()); err != nil {
+		return err
+	}
+	if len(orderIDs) == 0 {
+		return apperrors.ErrOrderAlreadyRegistered
+	}
+	for _, item := range order.Goods {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO accrual_order_goods (order_id, description, price) VALUES ($1, $2, $3)",
+			orderIDs[0], item.Description, item.Price); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CalculatorStorage) GetOrderByNumber(ctx context.Context, orderNumber string) (order model.AccrualOrder, err error) {
+	err = s.db.GetContext(ctx, &order, "SELECT id, order_number, status, accrual, created_at FROM accrual_orders WHERE order_number=$1", orderNumber)
+	return
+}
+
+func (s *CalculatorStorage) GetRegisteredOrders(ctx context.Context) ([]model.AccrualOrder, error) {
+	var orders []model.AccrualOrder
+	if err := s.db.SelectContext(ctx, &orders, "SELECT id, order_number, status, accrual, created_at FROM accrual_orders WHERE status = $1 ORDER BY id", model.AccrualStateRegistered); err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		if err := s.db.SelectContext(ctx, &orders[i].Goods, "SELECT description, price FROM accrual_order_goods WHERE order_id = $1 ORDER BY id", orders[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+func (s *CalculatorStorage) SetOrderResult(ctx context.Context, orderNumber string, status model.AccrualState, accrual model.Amount) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE accrual_orders SET status = $1, accrual = $2 WHERE order_number = $3", status, accrual, orderNumber); err != nil {
+		return err
+	}
+	return nil
+}
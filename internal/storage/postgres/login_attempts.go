@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RecordLoginFailure counts a failed login and returns the number of failures in a row together with
+// the time of the failure before this one, zero if there was none. The counter starts over if the
+// previous failure is older than window.
+func (s *Storage) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (failures int, previous time.Time, err error) {
+	now := time.Now().UTC()
+	var row struct {
+		Failures          int          `db:"failures"`
+		PreviousFailureAt sql.NullTime `db:"previous_failure_at"`
+	}
+	err = s.db.GetContext(ctx, &row, `INSERT INTO login_attempts ("key", failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT ("key") DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			previous_failure_at = login_attempts.last_failure_at,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures, previous_failure_at`, key, now, now.Add(-window))
+	return row.Failures, row.PreviousFailureAt.Time, err
+}
+
+// ForgetLoginFailure takes back one failure counted by key, without touching its block.
+func (s *Storage) ForgetLoginFailure(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE login_attempts SET failures = failures - 1 WHERE "key" = $1 AND failures > 0`, key); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BlockLogin rejects logins by key until the given time, unless they are already blocked for longer.
+func (s *Storage) BlockLogin(ctx context.Context, key string, until time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE login_attempts SET blocked_until = $1 WHERE "key" = $2 AND (blocked_until IS NULL OR blocked_until < $1)`,
+		until.UTC(), key); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetLoginBlockedUntil returns the zero time if logins by key are not blocked.
+func (s *Storage) GetLoginBlockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until sql.NullTime
+	if err := s.db.GetContext(ctx, &until, `SELECT blocked_until FROM login_attempts WHERE "key" = $1`, key); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+func (s *Storage) ResetLoginAttempts(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE "key" = $1`, key); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// Migrations returns the gophermart schema migrations.
+func Migrations() fs.FS {
+	sub, _ := fs.Sub(migrations, "migrations/gophermart")
+	return sub
+}
+
+// CalculatorMigrations returns the accrual system schema migrations.
+func CalculatorMigrations() fs.FS {
+	sub, _ := fs.Sub(migrations, "migrations/accrual")
+	return sub
+}
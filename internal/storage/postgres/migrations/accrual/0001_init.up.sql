@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS accrual_rewards (
+	id serial4 NOT NULL,
+	match varchar NOT NULL,
+	reward float8 NOT NULL,
+	reward_type varchar NOT NULL,
+	CONSTRAINT accrual_rewards_pk PRIMARY KEY (id),
+	CONSTRAINT accrual_rewards_unique UNIQUE (match)
+);
+CREATE TABLE IF NOT EXISTS accrual_orders (
+	id serial4 NOT NULL,
+	order_number varchar NOT NULL,
+	status varchar DEFAULT 'REGISTERED'::character varying NOT NULL,
+	accrual float8 DEFAULT 0 NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT accrual_orders_pk PRIMARY KEY (id),
+	CONSTRAINT accrual_orders_unique UNIQUE (order_number)
+);
+CREATE TABLE IF NOT EXISTS accrual_order_goods (
+	id serial4 NOT NULL,
+	order_id int4 NOT NULL,
+	description varchar NOT NULL,
+	price float8 NOT NULL,
+	CONSTRAINT accrual_order_goods_pk PRIMARY KEY (id),
+	CONSTRAINT accrual_order_goods_order_fk FOREIGN KEY (order_id) REFERENCES accrual_orders (id)
+);
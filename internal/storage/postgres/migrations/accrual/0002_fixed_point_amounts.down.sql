@@ -0,0 +1,5 @@
+ALTER TABLE accrual_rewards ALTER COLUMN reward TYPE float8 USING reward / 100.0;
+ALTER TABLE accrual_orders ALTER COLUMN accrual DROP DEFAULT;
+ALTER TABLE accrual_orders ALTER COLUMN accrual TYPE float8 USING accrual / 100.0;
+ALTER TABLE accrual_orders ALTER COLUMN accrual SET DEFAULT 0;
+ALTER TABLE accrual_order_goods ALTER COLUMN price TYPE float8 USING price / 100.0;
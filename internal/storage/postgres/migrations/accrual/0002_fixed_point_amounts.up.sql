@@ -0,0 +1,12 @@
+-- Amounts are stored as int8 hundredths of a point, see model.Amount.
+-- Databases created by the former inline schema may already be converted.
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'accrual_rewards' AND column_name = 'reward') = 'double precision' THEN
+		ALTER TABLE accrual_rewards ALTER COLUMN reward TYPE int8 USING round(reward::numeric * 100)::int8;
+		ALTER TABLE accrual_orders ALTER COLUMN accrual DROP DEFAULT;
+		ALTER TABLE accrual_orders ALTER COLUMN accrual TYPE int8 USING round(accrual::numeric * 100)::int8;
+		ALTER TABLE accrual_orders ALTER COLUMN accrual SET DEFAULT 0;
+		ALTER TABLE accrual_order_goods ALTER COLUMN price TYPE int8 USING round(price::numeric * 100)::int8;
+	END IF;
+END $$;
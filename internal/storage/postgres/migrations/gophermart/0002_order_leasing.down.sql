@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS orders_pending_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS leased_until;
+ALTER TABLE orders DROP COLUMN IF EXISTS next_check_at;
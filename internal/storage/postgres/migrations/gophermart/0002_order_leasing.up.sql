@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_check_at timestamptz DEFAULT now() NOT NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS leased_until timestamptz;
+CREATE INDEX IF NOT EXISTS orders_pending_idx ON orders (next_check_at) WHERE status IN ('NEW', 'PROCESSING');
@@ -0,0 +1,7 @@
+ALTER TABLE users ALTER COLUMN balance DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN balance TYPE float4 USING balance / 100.0;
+ALTER TABLE users ALTER COLUMN balance SET DEFAULT 0;
+ALTER TABLE orders ALTER COLUMN accrual DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN accrual TYPE float4 USING accrual / 100.0;
+ALTER TABLE orders ALTER COLUMN accrual SET DEFAULT 0;
+ALTER TABLE withdrawals ALTER COLUMN amount TYPE float4 USING amount / 100.0;
@@ -0,0 +1,18 @@
+-- Amounts are stored as int8 hundredths of a point, see model.Amount.
+-- Databases created by the former inline schema may already be converted.
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'balance') = 'real' THEN
+		ALTER TABLE users ALTER COLUMN balance DROP DEFAULT;
+		ALTER TABLE users ALTER COLUMN balance TYPE int8 USING round(balance::numeric * 100)::int8;
+		ALTER TABLE users ALTER COLUMN balance SET DEFAULT 0;
+	END IF;
+	IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'orders' AND column_name = 'accrual') = 'real' THEN
+		ALTER TABLE orders ALTER COLUMN accrual DROP DEFAULT;
+		ALTER TABLE orders ALTER COLUMN accrual TYPE int8 USING round(accrual::numeric * 100)::int8;
+		ALTER TABLE orders ALTER COLUMN accrual SET DEFAULT 0;
+	END IF;
+	IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'withdrawals' AND column_name = 'amount') = 'real' THEN
+		ALTER TABLE withdrawals ALTER COLUMN amount TYPE int8 USING round(amount::numeric * 100)::int8;
+	END IF;
+END $$;
@@ -0,0 +1,38 @@
+-- Every balance movement is a double entry: amount leaves debit_account and
+-- enters credit_account. Accounts are "user:<id>" or "system:<name>".
+CREATE TABLE ledger_entries (
+	id bigserial NOT NULL,
+	entry_type varchar NOT NULL,
+	debit_account varchar NOT NULL,
+	credit_account varchar NOT NULL,
+	amount int8 NOT NULL,
+	order_number varchar DEFAULT '' NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT ledger_entries_pk PRIMARY KEY (id),
+	CONSTRAINT ledger_entries_amount_check CHECK (amount > 0),
+	CONSTRAINT ledger_entries_accounts_check CHECK (debit_account <> credit_account)
+);
+CREATE INDEX ledger_entries_debit_idx ON ledger_entries (debit_account, created_at);
+CREATE INDEX ledger_entries_credit_idx ON ledger_entries (credit_account, created_at);
+
+INSERT INTO ledger_entries (entry_type, debit_account, credit_account, amount, order_number, created_at)
+SELECT 'ACCRUAL', 'system:accruals', 'user:' || user_id, accrual, order_number, uploaded_at
+FROM orders WHERE status = 'PROCESSED' AND accrual > 0;
+
+INSERT INTO ledger_entries (entry_type, debit_account, credit_account, amount, order_number, created_at)
+SELECT 'WITHDRAWAL', 'user:' || user_id, 'system:withdrawals', amount, order_number, processed_at
+FROM withdrawals WHERE amount > 0;
+
+-- Balances that cannot be explained by orders and withdrawals get an opening adjustment.
+INSERT INTO ledger_entries (entry_type, debit_account, credit_account, amount, created_at)
+SELECT 'ADJUSTMENT',
+	CASE WHEN diff > 0 THEN 'system:adjustments' ELSE 'user:' || id END,
+	CASE WHEN diff > 0 THEN 'user:' || id ELSE 'system:adjustments' END,
+	abs(diff), now()
+FROM (
+	SELECT u.id, u.balance
+		- COALESCE((SELECT SUM(o.accrual) FROM orders o WHERE o.user_id = u.id AND o.status = 'PROCESSED'), 0)
+		+ COALESCE((SELECT SUM(w.amount) FROM withdrawals w WHERE w.user_id = u.id), 0) AS diff
+	FROM users u
+) d
+WHERE diff <> 0;
@@ -0,0 +1,2 @@
+-- Fails if some balance is already negative: fix it with an adjustment first.
+ALTER TABLE users ADD CONSTRAINT users_balance_check CHECK (balance >= 0);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS withdrawals_order_number_unique;
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,15 @@
+CREATE TABLE idempotency_keys (
+	user_id int4 NOT NULL,
+	"key" varchar NOT NULL,
+	request_hash varchar NOT NULL,
+	status_code int4 DEFAULT 0 NOT NULL,
+	content_type varchar DEFAULT '' NOT NULL,
+	response_body bytea DEFAULT '' NOT NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	CONSTRAINT idempotency_keys_pk PRIMARY KEY (user_id, "key")
+);
+CREATE INDEX idempotency_keys_expires_idx ON idempotency_keys (expires_at);
+
+-- Fails if some order has already been paid twice: such withdrawals have to be reversed first.
+CREATE UNIQUE INDEX withdrawals_order_number_unique ON withdrawals (order_number);
@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+	id varchar NOT NULL,
+	user_id int4 NOT NULL,
+	refresh_token_hash varchar NOT NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	revoked_at timestamptz,
+	CONSTRAINT sessions_pk PRIMARY KEY (id)
+);
+CREATE INDEX sessions_user_idx ON sessions (user_id);
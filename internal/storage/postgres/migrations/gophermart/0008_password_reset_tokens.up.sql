@@ -0,0 +1,9 @@
+CREATE TABLE password_reset_tokens (
+	token_hash varchar NOT NULL,
+	user_id int4 NOT NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	used_at timestamptz,
+	CONSTRAINT password_reset_tokens_pk PRIMARY KEY (token_hash)
+);
+CREATE INDEX password_reset_tokens_user_idx ON password_reset_tokens (user_id);
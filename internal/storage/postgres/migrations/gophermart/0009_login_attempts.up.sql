@@ -0,0 +1,8 @@
+-- Failed logins per login or client IP, see model.LoginThrottleKey.
+CREATE TABLE login_attempts (
+	"key" varchar NOT NULL,
+	failures int4 NOT NULL,
+	last_failure_at timestamptz NOT NULL,
+	blocked_until timestamptz,
+	CONSTRAINT login_attempts_pk PRIMARY KEY ("key")
+);
@@ -0,0 +1,15 @@
+CREATE TABLE totp_credentials (
+	user_id int4 NOT NULL,
+	secret varchar NOT NULL,
+	created_at timestamptz NOT NULL,
+	confirmed_at timestamptz,
+	-- the last accepted TOTP time step, codes up to it can not be replayed
+	last_used_step int8 NOT NULL DEFAULT 0,
+	CONSTRAINT totp_credentials_pk PRIMARY KEY (user_id)
+);
+CREATE TABLE recovery_codes (
+	user_id int4 NOT NULL,
+	code_hash varchar NOT NULL,
+	used_at timestamptz,
+	CONSTRAINT recovery_codes_pk PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN "role" varchar DEFAULT 'user' NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE balance_adjustments;
+DROP FUNCTION balance_adjustments_immutable();
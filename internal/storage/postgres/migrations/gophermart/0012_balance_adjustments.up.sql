@@ -0,0 +1,20 @@
+CREATE TABLE balance_adjustments (
+	id bigserial NOT NULL,
+	user_id int4 NOT NULL,
+	operator_id int4 NOT NULL,
+	amount int8 NOT NULL,
+	reason varchar NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT balance_adjustments_pk PRIMARY KEY (id),
+	CONSTRAINT balance_adjustments_amount_check CHECK (amount <> 0)
+);
+CREATE INDEX balance_adjustments_user_idx ON balance_adjustments (user_id, created_at);
+
+-- The audit log is append-only.
+CREATE FUNCTION balance_adjustments_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'balance_adjustments is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER balance_adjustments_immutable BEFORE UPDATE OR DELETE ON balance_adjustments
+	FOR EACH ROW EXECUTE FUNCTION balance_adjustments_immutable();
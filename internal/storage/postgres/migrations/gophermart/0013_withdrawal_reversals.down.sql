@@ -0,0 +1,2 @@
+ALTER TABLE withdrawals DROP COLUMN reversed_at;
+ALTER TABLE withdrawals DROP COLUMN status;
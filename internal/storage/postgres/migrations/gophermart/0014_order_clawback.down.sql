@@ -0,0 +1,3 @@
+-- Outstanding debts are dropped: settle them with an adjustment first.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_debt_check;
+ALTER TABLE users DROP COLUMN IF EXISTS debt;
@@ -0,0 +1,4 @@
+-- A clawback with CLAWBACK_ALLOW_DEBT keeps the balance at zero and records what it did not cover
+-- as a debt that later credits pay off first, so neither column is ever negative.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS debt int8 DEFAULT 0 NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_debt_check CHECK (debt >= 0);
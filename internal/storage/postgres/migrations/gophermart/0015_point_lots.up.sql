@@ -0,0 +1,16 @@
+-- Every credit opens a lot, debits consume the oldest lots first and the rest of a lot expires with it.
+CREATE TABLE point_lots (
+	id bigserial NOT NULL,
+	user_id int4 NOT NULL,
+	amount int8 NOT NULL,
+	remaining int8 NOT NULL,
+	accrued_at timestamptz NOT NULL,
+	CONSTRAINT point_lots_pk PRIMARY KEY (id),
+	CONSTRAINT point_lots_remaining_check CHECK (remaining >= 0 AND remaining <= amount)
+);
+CREATE INDEX point_lots_open_idx ON point_lots (user_id, accrued_at, id) WHERE remaining > 0;
+CREATE INDEX point_lots_expiry_idx ON point_lots (accrued_at) WHERE remaining > 0;
+
+-- Points accrued before lots were tracked count as accrued now.
+INSERT INTO point_lots (user_id, amount, remaining, accrued_at)
+	SELECT id, balance, balance, now() FROM users WHERE balance > 0;
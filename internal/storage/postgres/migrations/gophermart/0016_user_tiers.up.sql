@@ -0,0 +1,8 @@
+-- Users without a row are bronze with no tier points.
+CREATE TABLE user_tiers (
+	user_id int4 NOT NULL,
+	tier varchar NOT NULL,
+	points int8 NOT NULL,
+	updated_at timestamptz NOT NULL,
+	CONSTRAINT user_tiers_pk PRIMARY KEY (user_id)
+);
@@ -0,0 +1,21 @@
+CREATE TABLE referral_codes (
+	user_id int4 NOT NULL,
+	code varchar NOT NULL,
+	CONSTRAINT referral_codes_pk PRIMARY KEY (user_id),
+	CONSTRAINT referral_codes_code_unique UNIQUE (code)
+);
+
+-- A user is referred at most once, at registration.
+CREATE TABLE referrals (
+	referred_id int4 NOT NULL,
+	referrer_id int4 NOT NULL,
+	status varchar DEFAULT 'PENDING' NOT NULL,
+	reject_reason varchar DEFAULT '' NOT NULL,
+	order_number varchar DEFAULT '' NOT NULL,
+	referrer_bonus int8 DEFAULT 0 NOT NULL,
+	referee_bonus int8 DEFAULT 0 NOT NULL,
+	created_at timestamptz NOT NULL,
+	settled_at timestamptz,
+	CONSTRAINT referrals_pk PRIMARY KEY (referred_id)
+);
+CREATE INDEX referrals_referrer_idx ON referrals (referrer_id, created_at);
@@ -0,0 +1,35 @@
+-- tiers is a comma-separated list, empty for every tier.
+CREATE TABLE campaigns (
+	id bigserial NOT NULL,
+	name varchar NOT NULL,
+	starts_at timestamptz NOT NULL,
+	ends_at timestamptz NOT NULL,
+	bonus_percent int8 DEFAULT 0 NOT NULL,
+	bonus_points int8 DEFAULT 0 NOT NULL,
+	tiers varchar DEFAULT '' NOT NULL,
+	per_user_cap int8 DEFAULT 0 NOT NULL,
+	created_by int4 NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT campaigns_pk PRIMARY KEY (id)
+);
+CREATE INDEX campaigns_period_idx ON campaigns (starts_at, ends_at);
+
+-- A campaign without rows is open to every user.
+CREATE TABLE campaign_users (
+	campaign_id int8 NOT NULL,
+	user_id int4 NOT NULL,
+	CONSTRAINT campaign_users_pk PRIMARY KEY (campaign_id, user_id)
+);
+
+CREATE TABLE campaign_bonuses (
+	id bigserial NOT NULL,
+	campaign_id int8 NOT NULL,
+	user_id int4 NOT NULL,
+	order_number varchar NOT NULL,
+	amount int8 NOT NULL,
+	created_at timestamptz NOT NULL,
+	CONSTRAINT campaign_bonuses_pk PRIMARY KEY (id),
+	CONSTRAINT campaign_bonuses_order_unique UNIQUE (campaign_id, order_number)
+);
+CREATE INDEX campaign_bonuses_user_idx ON campaign_bonuses (campaign_id, user_id);
+CREATE INDEX campaign_bonuses_order_idx ON campaign_bonuses (order_number);
@@ -0,0 +1,18 @@
+CREATE TABLE transfers (
+	id bigserial NOT NULL,
+	sender_id int4 NOT NULL,
+	recipient_id int4 NOT NULL,
+	amount int8 NOT NULL,
+	comment varchar DEFAULT '' NOT NULL,
+	status varchar NOT NULL,
+	created_at timestamptz NOT NULL,
+	settled_at timestamptz,
+	CONSTRAINT transfers_pk PRIMARY KEY (id),
+	CONSTRAINT transfers_amount_check CHECK (amount > 0),
+	CONSTRAINT transfers_users_check CHECK (sender_id <> recipient_id)
+);
+CREATE INDEX transfers_sender_idx ON transfers (sender_id, created_at);
+CREATE INDEX transfers_recipient_idx ON transfers (recipient_id, created_at);
+
+-- Entries of a transfer refer to it, 0 for other entries.
+ALTER TABLE ledger_entries ADD COLUMN transfer_id int8 DEFAULT 0 NOT NULL;
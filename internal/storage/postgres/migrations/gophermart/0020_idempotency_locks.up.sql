@@ -0,0 +1,2 @@
+-- A request in progress holds its key until locked_until, then another request may take it over.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until timestamptz DEFAULT now() NOT NULL;
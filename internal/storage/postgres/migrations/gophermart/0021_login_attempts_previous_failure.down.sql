@@ -0,0 +1 @@
+ALTER TABLE login_attempts DROP COLUMN previous_failure_at;
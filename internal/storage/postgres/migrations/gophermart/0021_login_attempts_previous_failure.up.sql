@@ -0,0 +1,2 @@
+-- The failure before last_failure_at, so that an attempt counted up front can be checked against the block it left.
+ALTER TABLE login_attempts ADD COLUMN previous_failure_at timestamptz;
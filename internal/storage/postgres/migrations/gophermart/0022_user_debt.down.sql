@@ -0,0 +1,2 @@
+-- Nothing to revert: the debt column belongs to 0014_order_clawback.
+SELECT 1;
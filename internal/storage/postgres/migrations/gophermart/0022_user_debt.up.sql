@@ -0,0 +1,8 @@
+-- The debt column now comes with 0014_order_clawback. Databases that applied an earlier 0014, which
+-- dropped users_balance_check instead, get the column here and their negative balances become debts.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS debt int8 DEFAULT 0 NOT NULL;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_debt_check;
+ALTER TABLE users ADD CONSTRAINT users_debt_check CHECK (debt >= 0);
+UPDATE users SET debt = debt - balance, balance = 0 WHERE balance < 0;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_balance_check;
+ALTER TABLE users ADD CONSTRAINT users_balance_check CHECK (balance >= 0);
@@ -0,0 +1,3 @@
+-- The tier bonus is credited by its own TIER ledger entry and kept apart from the accrual. Orders
+-- finalized before this migration keep the bonus in accrual.
+ALTER TABLE orders ADD COLUMN tier_bonus int8 DEFAULT 0 NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_bonuses_pending_idx;
+ALTER TABLE orders DROP COLUMN bonuses_pending;
@@ -0,0 +1,4 @@
+-- Referral and campaign bonuses are credited after the order is finalized. The flag is set in the
+-- finalize transaction and cleared once they are credited, so a failure is retried instead of lost.
+ALTER TABLE orders ADD COLUMN bonuses_pending bool DEFAULT false NOT NULL;
+CREATE INDEX orders_bonuses_pending_idx ON orders (id) WHERE bonuses_pending;
@@ -0,0 +1,12 @@
+-- Points spent on a withdrawal or held by a pending transfer remember the lots they were taken from, so
+-- that a reversal or a settled transfer returns them with their accrual time. Withdrawals and transfers
+-- made before this migration return points as accrued now.
+CREATE TABLE point_lot_holds (
+	id bigserial NOT NULL,
+	order_number varchar DEFAULT '' NOT NULL,
+	transfer_id int8 DEFAULT 0 NOT NULL,
+	amount int8 NOT NULL,
+	accrued_at timestamptz NOT NULL,
+	CONSTRAINT point_lot_holds_pk PRIMARY KEY (id)
+);
+CREATE INDEX point_lot_holds_source_idx ON point_lot_holds (order_number, transfer_id);
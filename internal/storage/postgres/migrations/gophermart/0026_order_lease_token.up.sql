@@ -0,0 +1,3 @@
+-- The poller that leased an order stamps it with a token, so that it renews and releases only
+-- the leases it still holds and never the lease another instance took after an expiry.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS lease_token varchar;
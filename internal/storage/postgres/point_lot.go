@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// GetPointLots lists the user's lots accrued up to and including accruedBefore that still hold points,
+// oldest first.
+func (s *Storage) GetPointLots(ctx context.Context, userID uint, accruedBefore time.Time) (lots []model.PointLot, err error) {
+	err = s.db.SelectContext(ctx, &lots, `SELECT id, user_id, amount, remaining, accrued_at FROM point_lots
+		WHERE user_id = $1 AND remaining > 0 AND accrued_at <= $2 ORDER BY accrued_at, id`, userID, accruedBefore)
+	return
+}
+
+// GetUsersWithExpiredPoints lists, in ascending order, up to limit users after afterUserID holding points accrued
+// up to and including accruedBefore.
+func (s *Storage) GetUsersWithExpiredPoints(ctx context.Context, accruedBefore time.Time, afterUserID uint, limit int) (userIDs []uint, err error) {
+	err = s.db.SelectContext(ctx, &userIDs, `SELECT DISTINCT user_id FROM point_lots
+		WHERE remaining > 0 AND accrued_at <= $1 AND user_id > $2 ORDER BY user_id LIMIT $3`, accruedBefore, afterUserID, limit)
+	return
+}
+
+// ExpirePoints takes what is left of the user's lots accrued up to and including accruedBefore off the
+// balance and records an EXPIRATION ledger entry. It returns the number of expired points.
+func (s *Storage) ExpirePoints(ctx context.Context, userID uint, accruedBefore time.Time) (model.Amount, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:all
+	// lock the user first, so that no debit consumes the lots between the sum and the update
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return 0, err
+	}
+	var expired model.Amount
+	if err := tx.GetContext(ctx, &expired, "SELECT COALESCE(SUM(remaining), 0)::bigint FROM point_lots WHERE user_id = $1 AND remaining > 0 AND accrued_at <= $2",
+		userID, accruedBefore); err != nil {
+		return 0, err
+	}
+	if expired == 0 {
+		return 0, nil
+	}
+	// the expired lots are the oldest ones, so the debit consumes exactly them
+	if err := s.updateUserBalanceByUserIDTx(ctx, userID, -expired, tx); err != nil {
+		return 0, err
+	}
+	if err := s.addLedgerEntryTx(ctx, model.LedgerEntry{
+		Type:          model.LedgerEntryExpiration,
+		DebitAccount:  model.UserAccount(userID),
+		CreditAccount: model.SystemAccountExpirations,
+		Amount:        expired,
+	}, tx); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+// updatePointLotsTx follows a change of the user's balance by amount that left it at balance.
+// A credit opens lots with the part of amount not spent on paying off a debt, dated as the lots in from
+// that the points were debited from, see model.CarryPointLots. A debit consumes the oldest lots first
+// and returns the portions it took.
+func (s *Storage) updatePointLotsTx(ctx context.Context, userID uint, amount, balance model.Amount, from []model.PointLot, tx *sqlx.Tx) ([]model.PointLot, error) {
+	if amount > 0 {
+		for _, lot := range model.CarryPointLots(from, amount, min(amount, balance), time.Now().UTC()) {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO point_lots (user_id, amount, remaining, accrued_at) VALUES ($1, $2, $2, $3)",
+				userID, lot.Amount, lot.AccruedAt); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+	var lots []model.PointLot
+	if err := tx.SelectContext(ctx, &lots, "SELECT id, remaining, accrued_at FROM point_lots WHERE user_id = $1 AND remaining > 0 ORDER BY accrued_at, id FOR UPDATE",
+		userID); err != nil {
+		return nil, err
+	}
+	debit := -amount
+	var taken []model.PointLot
+	for _, lot := range lots {
+		if debit == 0 {
+			break
+		}
+		used := min(lot.Remaining, debit)
+		if _, err := tx.ExecContext(ctx, "UPDATE point_lots SET remaining = remaining - $1 WHERE id = $2", used, lot.ID); err != nil {
+			return nil, err
+		}
+		taken = append(taken, model.PointLot{Amount: used, AccruedAt: lot.AccruedAt})
+		debit -= used
+	}
+	return taken, nil
+}
+
+// holdPointLotsTx remembers the lots that the points spent on a withdrawal or held by a pending transfer
+// were taken from, so that returning them keeps their accrual time.
+func (s *Storage) holdPointLotsTx(ctx context.Context, orderNumber string, transferID uint, lots []model.PointLot, tx *sqlx.Tx) error {
+	for _, lot := range lots {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO point_lot_holds (order_number, transfer_id, amount, accrued_at) VALUES ($1, $2, $3, $4)",
+			orderNumber, transferID, lot.Amount, lot.AccruedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releasePointLotsTx forgets and returns the lots remembered by holdPointLotsTx.
+func (s *Storage) releasePointLotsTx(ctx context.Context, orderNumber string, transferID uint, tx *sqlx.Tx) (lots []model.PointLot, err error) {
+	err = tx.SelectContext(ctx, &lots, "DELETE FROM point_lot_holds WHERE order_number = $1 AND transfer_id = $2 RETURNING amount, accrued_at",
+		orderNumber, transferID)
+	return
+}
@@ -22,46 +22,143 @@ func NewStorage(db *sqlx.DB) server.Storage {
 }
 
 func (s *Storage) UploadOrder(ctx context.Context, userID uint, number string) error {
-	if _, err := s.db.ExecContext(ctx, "INSERT INTO orders (order_number, user_id, status, uploaded_at) VALUES ($1, $2, $3, $4)",
-		number, userID, model.OrderStateNew, time.Now().UTC()); err != nil {
+	res, err := s.db.ExecContext(ctx, "INSERT INTO orders (order_number, user_id, status, uploaded_at) VALUES ($1, $2, $3, $4) ON CONFLICT (order_number) DO NOTHING",
+		number, userID, model.OrderStateNew, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
+	if inserted == 0 {
+		return apperrors.ErrOrderAlreadyUploaded
+	}
 	return nil
 }
 
+// SetOrderStatus leaves processed and reversed orders alone, so a worker holding a stale lease
+// can not reopen them.
 func (s *Storage) SetOrderStatus(ctx context.Context, orderNumber string, status model.OrderState) error {
-	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE order_number = $2;", status, orderNumber); err != nil {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE order_number = $2 AND status NOT IN ($3, $4);",
+		status, orderNumber, model.OrderStateProcessed, model.OrderStateReversed); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (s *Storage) GetOrderByNumber(ctx context.Context, number string) (order model.Order, err error) {
-	err = s.db.GetContext(ctx, &order, "SELECT * FROM orders WHERE order_number=$1", number)
+	err = s.db.GetContext(ctx, &order, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE order_number=$1", number)
 	return
 }
 
-func (s *Storage) FinalizeOrderAndUpdateBalance(ctx context.Context, orderNumber string, amount float64) error {
+func (s *Storage) FinalizeOrderAndUpdateBalance(ctx context.Context, orderNumber string, accrual, tierBonus model.Amount) error {
 	tx, err := s.db.Beginx()
 	defer tx.Rollback() //nolint:all
 	if err != nil {
 		return err
 	}
-	if err := s.setOrderStatusTx(ctx, orderNumber, model.OrderStateProcessed, tx); err != nil {
+	finalized, err := s.setOrderAccrualTx(ctx, orderNumber, accrual, tierBonus, tx)
+	if err != nil {
 		return err
 	}
-	if err := s.setOrderAccrualTx(ctx, orderNumber, amount, tx); err != nil {
-		return err
+	if !finalized {
+		// another worker has already credited this order
+		return nil
 	}
-	if err := s.updateUserBalanceByOrderNumberTx(ctx, orderNumber, amount, tx); err != nil {
+	userID, err := s.updateUserBalanceByOrderNumberTx(ctx, orderNumber, accrual+tierBonus, tx)
+	if err != nil {
 		return err
 	}
+	order := model.Order{OrderNumber: orderNumber, UserID: userID, Accrual: accrual, TierBonus: tierBonus}
+	for _, entry := range order.AccrualEntries() {
+		if err := s.addLedgerEntryTx(ctx, entry, tx); err != nil {
+			return err
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// ClawbackOrder takes the accrual, the tier bonus and the campaign bonuses of a processed order back from its owner and
+// the referral bonuses paid for the order back from both parties, and marks the order reversed. Unless
+// allowDebt is set, it fails with apperrors.ErrNotEnoughFunds if a balance does not cover them; otherwise
+// what the balance does not cover is recorded as the user's debt.
+func (s *Storage) ClawbackOrder(ctx context.Context, orderNumber string, allowDebt bool) (model.Order, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Order{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var order model.Order
+	if err := tx.GetContext(ctx, &order, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE order_number = $1 FOR UPDATE",
+		orderNumber); err != nil {
+		return model.Order{}, err
+	}
+	switch order.Status {
+	case model.OrderStateProcessed:
+	case model.OrderStateReversed:
+		return model.Order{}, apperrors.ErrOrderAlreadyReversed
+	default:
+		return model.Order{}, apperrors.ErrOrderNotProcessed
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2", model.OrderStateReversed, order.ID); err != nil {
+		return model.Order{}, err
+	}
+	order.Status = model.OrderStateReversed
+	var campaignBonuses model.Amount
+	if err := tx.GetContext(ctx, &campaignBonuses, "SELECT COALESCE(SUM(amount), 0)::bigint FROM campaign_bonuses WHERE order_number = $1",
+		orderNumber); err != nil {
+		return model.Order{}, err
+	}
+	for _, entry := range order.ClawbackEntries(campaignBonuses) {
+		if err := s.clawbackTx(ctx, order.UserID, entry.Amount, allowDebt, tx); err != nil {
+			return model.Order{}, err
+		}
+		if err := s.addLedgerEntryTx(ctx, entry, tx); err != nil {
+			return model.Order{}, err
+		}
+	}
+	// the referral bonuses paid for the order go back as well
+	var referrals []model.Referral
+	if err := tx.SelectContext(ctx, &referrals, `UPDATE referrals SET status = $1 WHERE order_number = $2 AND status = $3
+		RETURNING referred_id, referrer_id, referrer_bonus, referee_bonus`,
+		model.ReferralStatusReversed, orderNumber, model.ReferralStatusCredited); err != nil {
+		return model.Order{}, err
+	}
+	for _, referral := range referrals {
+		for _, bonus := range referral.Bonuses() {
+			if err := s.clawbackTx(ctx, bonus.UserID, bonus.Amount, allowDebt, tx); err != nil {
+				return model.Order{}, err
+			}
+			if err := s.addLedgerEntryTx(ctx, bonus.ReversalEntry(orderNumber), tx); err != nil {
+				return model.Order{}, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, err
+	}
+	return order, nil
+}
+
+// clawbackTx takes amount back from the user. Unless allowDebt is set, it fails with apperrors.ErrNotEnoughFunds
+// if the balance does not cover it; otherwise what the balance does not cover is recorded as the user's debt.
+func (s *Storage) clawbackTx(ctx context.Context, userID uint, amount model.Amount, allowDebt bool, tx *sqlx.Tx) error {
+	if !allowDebt {
+		return s.updateUserBalanceByUserIDTx(ctx, userID, -amount, tx)
+	}
+	var balance model.Amount
+	if err := tx.GetContext(ctx, &balance, `UPDATE users SET balance = GREATEST(balance - $1, 0), debt = debt + GREATEST($1 - balance, 0)
+		WHERE id = $2 RETURNING balance`, amount, userID); err != nil {
+		return err
+	}
+	_, err := s.updatePointLotsTx(ctx, userID, -amount, balance, nil, tx)
+	return err
+}
+
 func (s *Storage) AddUser(ctx context.Context, login, password string) (uint, error) {
 	_, err := s.GetUserByLogin(ctx, login)
 	if err == nil {
@@ -81,25 +178,84 @@ func (s *Storage) AddUser(ctx context.Context, login, password string) (uint, er
 }
 
 func (s *Storage) GetUserByLogin(ctx context.Context, login string) (user model.User, err error) {
-	err = s.db.GetContext(ctx, &user, "SELECT * FROM users WHERE login=$1", login)
+	err = s.db.GetContext(ctx, &user, "SELECT id, login, password, role, created_at, balance FROM users WHERE login = $1", login)
 	return
 }
 
 func (s *Storage) GetUserByID(ctx context.Context, id uint) (user model.User, err error) {
-	err = s.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id=$1", id)
+	err = s.db.GetContext(ctx, &user, "SELECT id, login, password, role, created_at, balance, debt FROM users WHERE id = $1", id)
 	return
 }
 
+func (s *Storage) SetUserRole(ctx context.Context, userID uint, role model.Role) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (s *Storage) GetOrdersByUserID(ctx context.Context, userID uint) (orders []model.Order, err error) {
-	err = s.db.SelectContext(ctx, &orders, "SELECT * FROM orders WHERE user_id=$1", userID)
+	err = s.db.SelectContext(ctx, &orders, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE user_id=$1 ORDER BY uploaded_at, id", userID)
 	return
 }
 
-func (s *Storage) GetPendingOrders(ctx context.Context) (orders []string, err error) {
-	err = s.db.SelectContext(ctx, &orders, "SELECT order_number FROM orders WHERE status IN ($1, $2)", model.OrderStateNew, model.OrderStateProcessing)
+// LeasePendingOrders marks up to limit due orders as taken for leaseTime under token, so
+// concurrent pollers (including other instances) skip them until released or expired.
+func (s *Storage) LeasePendingOrders(ctx context.Context, token string, limit int, leaseTime time.Duration) (orders []string, err error) {
+	err = s.db.SelectContext(ctx, &orders, `UPDATE orders SET leased_until = now() + make_interval(secs => $1), lease_token = $2
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status IN ($3, $4) AND next_check_at <= now() AND (leased_until IS NULL OR leased_until < now())
+			ORDER BY next_check_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED)
+		RETURNING order_number`,
+		leaseTime.Seconds(), token, model.OrderStateNew, model.OrderStateProcessing, limit)
 	return
 }
 
+// RenewOrderLeases extends the leases still held under token by leaseTime and returns their orders.
+// An order leased by another poller after its lease expired is no longer held.
+func (s *Storage) RenewOrderLeases(ctx context.Context, token string, leaseTime time.Duration) (orders []string, err error) {
+	err = s.db.SelectContext(ctx, &orders, `UPDATE orders SET leased_until = now() + make_interval(secs => $1)
+		WHERE lease_token = $2 AND leased_until IS NOT NULL
+		RETURNING order_number`,
+		leaseTime.Seconds(), token)
+	return
+}
+
+// ReleaseOrder ends the lease held under token and schedules the next check. It does nothing if
+// the order is no longer leased under token.
+func (s *Storage) ReleaseOrder(ctx context.Context, orderNumber, token string, nextCheckIn time.Duration) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET leased_until = NULL, lease_token = NULL, next_check_at = now() + make_interval(secs => $1) WHERE order_number = $2 AND lease_token = $3;",
+		nextCheckIn.Seconds(), orderNumber, token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetOrdersWithPendingBonuses returns up to limit finalized orders whose referral and campaign bonuses
+// have not been credited yet.
+func (s *Storage) GetOrdersWithPendingBonuses(ctx context.Context, limit int) (orders []string, err error) {
+	err = s.db.SelectContext(ctx, &orders, "SELECT order_number FROM orders WHERE bonuses_pending ORDER BY id LIMIT $1", limit)
+	return
+}
+
+func (s *Storage) ClearOrderBonusesPending(ctx context.Context, orderNumber string) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET bonuses_pending = false WHERE order_number = $1;", orderNumber); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s *Storage) ProcessWithdrawal(ctx context.Context, withdrawal model.Withdrawal) error {
 	tx, err := s.db.Beginx()
 	defer tx.Rollback() //nolint:all
@@ -109,7 +265,20 @@ func (s *Storage) ProcessWithdrawal(ctx context.Context, withdrawal model.Withdr
 	if err := s.addWithdrawalTx(ctx, withdrawal, tx); err != nil {
 		return err
 	}
-	if err := s.updateUserBalanceByUserIDTx(ctx, withdrawal.UserID, -withdrawal.Amount, tx); err != nil {
+	lots, err := s.moveUserBalanceTx(ctx, withdrawal.UserID, -withdrawal.Amount, nil, tx)
+	if err != nil {
+		return err
+	}
+	if err := s.holdPointLotsTx(ctx, withdrawal.OrderNumber, 0, lots, tx); err != nil {
+		return err
+	}
+	if err := s.addLedgerEntryTx(ctx, model.LedgerEntry{
+		Type:          model.LedgerEntryWithdrawal,
+		DebitAccount:  model.UserAccount(withdrawal.UserID),
+		CreditAccount: model.SystemAccountWithdrawals,
+		Amount:        withdrawal.Amount,
+		OrderNumber:   withdrawal.OrderNumber,
+	}, tx); err != nil {
 		return err
 	}
 	if err := tx.Commit(); err != nil {
@@ -118,9 +287,57 @@ func (s *Storage) ProcessWithdrawal(ctx context.Context, withdrawal model.Withdr
 	return nil
 }
 
-func (s *Storage) GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (float64, error) {
-	var sums []float64
-	err := s.db.SelectContext(ctx, &sums, "SELECT SUM(amount) FROM withdrawals WHERE withdrawals.user_id = $1 group by user_id", userID)
+// ReverseWithdrawal returns the points of the withdrawal to the user and marks it reversed.
+// It fails with apperrors.ErrWithdrawalAlreadyReversed if the withdrawal is reversed already.
+func (s *Storage) ReverseWithdrawal(ctx context.Context, orderNumber string) (model.Withdrawal, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Withdrawal{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var withdrawals []model.Withdrawal
+	if err := tx.SelectContext(ctx, &withdrawals, `UPDATE withdrawals SET status = $1, reversed_at = $2
+		WHERE order_number = $3 AND status = $4
+		RETURNING id, amount, processed_at, order_number, user_id, status, reversed_at`,
+		model.WithdrawalStateReversed, time.Now().UTC(), orderNumber, model.WithdrawalStateProcessed); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if len(withdrawals) == 0 {
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM withdrawals WHERE order_number = $1)", orderNumber); err != nil {
+			return model.Withdrawal{}, err
+		}
+		if !exists {
+			return model.Withdrawal{}, sql.ErrNoRows
+		}
+		return model.Withdrawal{}, apperrors.ErrWithdrawalAlreadyReversed
+	}
+	withdrawal := withdrawals[0]
+	lots, err := s.releasePointLotsTx(ctx, withdrawal.OrderNumber, 0, tx)
+	if err != nil {
+		return model.Withdrawal{}, err
+	}
+	if _, err := s.moveUserBalanceTx(ctx, withdrawal.UserID, withdrawal.Amount, lots, tx); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if err := s.addLedgerEntryTx(ctx, model.LedgerEntry{
+		Type:          model.LedgerEntryReversal,
+		DebitAccount:  model.SystemAccountWithdrawals,
+		CreditAccount: model.UserAccount(withdrawal.UserID),
+		Amount:        withdrawal.Amount,
+		OrderNumber:   withdrawal.OrderNumber,
+	}, tx); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Withdrawal{}, err
+	}
+	return withdrawal, nil
+}
+
+func (s *Storage) GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (model.Amount, error) {
+	var sums []model.Amount
+	err := s.db.SelectContext(ctx, &sums, "SELECT SUM(amount)::bigint FROM withdrawals WHERE withdrawals.user_id = $1 AND status = $2 group by user_id", userID, model.WithdrawalStateProcessed)
 	if err != nil {
 		return 0, err
 	}
@@ -132,71 +349,123 @@ func (s *Storage) GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (f
 }
 
 func (s *Storage) GetWithdrawalsByUserID(ctx context.Context, userID uint) (withdrawals []model.Withdrawal, err error) {
-	err = s.db.SelectContext(ctx, &withdrawals, "SELECT * FROM withdrawals WHERE user_id = $1", userID)
+	err = s.db.SelectContext(ctx, &withdrawals, "SELECT id, amount, processed_at, order_number, user_id, status, reversed_at FROM withdrawals WHERE user_id = $1 ORDER BY processed_at, id", userID)
 	return
 }
 
-func (s *Storage) updateUserBalanceByOrderNumberTx(ctx context.Context, orderNumber string, amount float64, tx *sqlx.Tx) error {
+// GetBalanceAt reconstructs the user's balance from ledger entries created up to and including at.
+func (s *Storage) GetBalanceAt(ctx context.Context, userID uint, at time.Time) (balance model.Amount, err error) {
+	account := model.UserAccount(userID)
+	err = s.db.GetContext(ctx, &balance, `SELECT COALESCE(SUM(CASE WHEN credit_account = $1 THEN amount ELSE -amount END), 0)::bigint
+		FROM ledger_entries WHERE (credit_account = $1 OR debit_account = $1) AND created_at <= $2`, account, at)
+	return
+}
 
-	user, err := s.getUserByOrderNumberTx(ctx, orderNumber, tx)
-	if err != nil {
-		return err
-	}
-	newBalance := user.Balance + float64(amount)
-	if newBalance < 0 {
-		return apperrors.ErrNotEnoughFunds
-	}
+// GetBalanceDiscrepancies lists users whose stored balance, less the debt, does not match the sum of their ledger entries.
+func (s *Storage) GetBalanceDiscrepancies(ctx context.Context) (discrepancies []model.BalanceDiscrepancy, err error) {
+	err = s.db.SelectContext(ctx, &discrepancies, `SELECT u.id AS user_id, u.balance - u.debt AS balance, COALESCE(l.balance, 0)::bigint AS ledger_balance
+		FROM users u
+		LEFT JOIN (
+			SELECT account, SUM(amount) AS balance FROM (
+				SELECT credit_account AS account, amount FROM ledger_entries
+				UNION ALL
+				SELECT debit_account AS account, -amount FROM ledger_entries
+			) e GROUP BY account
+		) l ON l.account = 'user:' || u.id
+		WHERE u.balance - u.debt <> COALESCE(l.balance, 0)
+		ORDER BY u.id`)
+	return
+}
 
-	if _, err := tx.ExecContext(ctx, "UPDATE users SET balance = $1 WHERE id = $2;", newBalance, user.ID); err != nil {
-		return err
+// updateUserBalanceByOrderNumberTx adds amount to the balance of the order's owner in a single
+// statement, so concurrent updates cannot overwrite each other or drive the balance below zero.
+// A credit pays off the debt left by a clawback first.
+func (s *Storage) updateUserBalanceByOrderNumberTx(ctx context.Context, orderNumber string, amount model.Amount, tx *sqlx.Tx) (uint, error) {
+	var users []model.User
+	if err := tx.SelectContext(ctx, &users, `UPDATE users SET balance = users.balance + $1 - LEAST(users.debt, GREATEST($1, 0)),
+			debt = users.debt - LEAST(users.debt, GREATEST($1, 0))
+		FROM orders o WHERE o.user_id = users.id AND o.order_number = $2 AND ($1 >= 0 OR users.balance + $1 >= 0)
+		RETURNING users.id, users.balance`, amount, orderNumber); err != nil {
+		return 0, err
 	}
-	return nil
+	if len(users) == 0 {
+		if _, err := s.getUserByOrderNumberTx(ctx, orderNumber, tx); err != nil {
+			return 0, err
+		}
+		return 0, apperrors.ErrNotEnoughFunds
+	}
+	_, err := s.updatePointLotsTx(ctx, users[0].ID, amount, users[0].Balance, nil, tx)
+	return users[0].ID, err
 }
 
-func (s *Storage) updateUserBalanceByUserIDTx(ctx context.Context, userID uint, amount float64, tx *sqlx.Tx) error {
-	user, err := s.getUserByUserIDTx(ctx, userID, tx)
-	if err != nil {
-		return err
-	}
+// updateUserBalanceByUserIDTx adds amount to the user's balance, see updateUserBalanceByOrderNumberTx.
+func (s *Storage) updateUserBalanceByUserIDTx(ctx context.Context, userID uint, amount model.Amount, tx *sqlx.Tx) error {
+	_, err := s.moveUserBalanceTx(ctx, userID, amount, nil, tx)
+	return err
+}
 
-	newBalance := user.Balance + amount
-	if newBalance < 0 {
-		return apperrors.ErrNotEnoughFunds
+// moveUserBalanceTx adds amount to the user's balance like updateUserBalanceByUserIDTx. Points credited
+// keep the accrual time of the lots in from, and the lots consumed by a debit are returned, so that points
+// moved between balances or held and returned do not extend their expiry.
+func (s *Storage) moveUserBalanceTx(ctx context.Context, userID uint, amount model.Amount, from []model.PointLot, tx *sqlx.Tx) ([]model.PointLot, error) {
+	var balances []model.Amount
+	if err := tx.SelectContext(ctx, &balances, `UPDATE users SET balance = balance + $1 - LEAST(debt, GREATEST($1, 0)), debt = debt - LEAST(debt, GREATEST($1, 0))
+		WHERE id = $2 AND ($1 >= 0 OR balance + $1 >= 0) RETURNING balance`, amount, userID); err != nil {
+		return nil, err
 	}
-
-	if _, err := tx.ExecContext(ctx, "UPDATE users SET balance = $1 WHERE id = $2;", newBalance, user.ID); err != nil {
-		return err
+	if len(balances) == 0 {
+		if _, err := s.getUserByUserIDTx(ctx, userID, tx); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrNotEnoughFunds
 	}
-	return nil
+	return s.updatePointLotsTx(ctx, userID, amount, balances[0], from, tx)
 }
 
-func (s *Storage) setOrderStatusTx(ctx context.Context, orderNumber string, status model.OrderState, tx *sqlx.Tx) error {
-	_, err := tx.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE order_number = $2;", status, orderNumber)
+// setOrderAccrualTx finalizes the order and reports false if it has already been finalized or reversed.
+func (s *Storage) setOrderAccrualTx(ctx context.Context, orderNumber string, accrual, tierBonus model.Amount, tx *sqlx.Tx) (bool, error) {
+	res, err := tx.ExecContext(ctx, "UPDATE orders SET accrual = $1, tier_bonus = $5, status = $2, bonuses_pending = true WHERE order_number = $3 AND status NOT IN ($2, $4);",
+		accrual, model.OrderStateProcessed, orderNumber, model.OrderStateReversed, tierBonus)
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	return nil
-}
-
-func (s *Storage) setOrderAccrualTx(ctx context.Context, orderNumber string, amount float64, tx *sqlx.Tx) error {
-	if _, err := tx.ExecContext(ctx, "UPDATE orders SET accrual = $1,  status = $2 WHERE order_number = $3;", amount, model.OrderStateProcessed, orderNumber); err != nil {
-		return err
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
-	return nil
+	return updated > 0, nil
 }
+
 func (s *Storage) getUserByOrderNumberTx(ctx context.Context, id string, tx *sqlx.Tx) (user model.User, err error) {
 	err = tx.GetContext(ctx, &user, "SELECT u.id, login, password, created_at, balance FROM users u join orders o on u.id = o.user_id WHERE o.order_number=$1", id)
 	return
 }
 
 func (s *Storage) getUserByUserIDTx(ctx context.Context, userID uint, tx *sqlx.Tx) (user model.User, err error) {
-	err = tx.GetContext(ctx, &user, "SELECT * FROM users  WHERE id =$1", userID)
+	err = tx.GetContext(ctx, &user, "SELECT id, login, password, role, created_at, balance FROM users WHERE id = $1", userID)
 	return
 }
 
 func (s *Storage) addWithdrawalTx(ctx context.Context, withdrawal model.Withdrawal, tx *sqlx.Tx) error {
-	if _, err := tx.ExecContext(ctx, "INSERT INTO withdrawals (amount, processed_at, order_number, user_id) VALUES ($1, $2, $3, $4)", withdrawal.Amount, time.Now().UTC(), withdrawal.OrderNumber, withdrawal.UserID); err != nil {
+	res, err := tx.ExecContext(ctx, "INSERT INTO withdrawals (amount, processed_at, order_number, user_id) VALUES ($1, $2, $3, $4) ON CONFLICT (order_number) DO NOTHING",
+		withdrawal.Amount, time.Now().UTC(), withdrawal.OrderNumber, withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return apperrors.ErrWithdrawalAlreadyExists
+	}
+	return nil
+}
+
+func (s *Storage) addLedgerEntryTx(ctx context.Context, entry model.LedgerEntry, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (entry_type, debit_account, credit_account, amount, order_number, transfer_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entry.Type, entry.DebitAccount, entry.CreditAccount, entry.Amount, entry.OrderNumber, entry.TransferID, time.Now().UTC()); err != nil {
 		return err
 	}
 	return nil
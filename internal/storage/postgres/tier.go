@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// GetUserTurnover sums, by user, the points users received from account since the given time minus
+// the points they returned to it. Users without such ledger entries are left out. Both directions are
+// summed separately, so that each uses its own (account, created_at) index.
+func (s *Storage) GetUserTurnover(ctx context.Context, account string, since time.Time) (turnover []model.Turnover, err error) {
+	err = s.db.SelectContext(ctx, &turnover, `SELECT split_part(e.account, ':', 2)::int8 AS user_id, SUM(e.amount)::bigint AS amount
+		FROM (
+			SELECT credit_account AS account, amount FROM ledger_entries
+			WHERE debit_account = $1 AND created_at >= $2 AND credit_account LIKE 'user:%'
+			UNION ALL
+			SELECT debit_account, -amount FROM ledger_entries
+			WHERE credit_account = $1 AND created_at >= $2 AND debit_account LIKE 'user:%'
+		) e
+		GROUP BY 1
+		ORDER BY 1`, account, since)
+	return
+}
+
+// ReplaceUserTiers replaces the tiers of all users with tiers.
+func (s *Storage) ReplaceUserTiers(ctx context.Context, tiers []model.UserTier) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_tiers"); err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_tiers (user_id, tier, points, updated_at) VALUES ($1, $2, $3, $4)",
+			tier.UserID, tier.Tier, tier.Points, tier.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Storage) GetUserTier(ctx context.Context, userID uint) (tier model.UserTier, err error) {
+	err = s.db.GetContext(ctx, &tier, "SELECT user_id, tier, points, updated_at FROM user_tiers WHERE user_id = $1", userID)
+	return
+}
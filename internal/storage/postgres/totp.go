@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// SaveTOTPSecret replaces the unconfirmed secret of the user.
+// It fails with apperrors.ErrTOTPAlreadyEnabled once the secret is confirmed.
+func (s *Storage) SaveTOTPSecret(ctx context.Context, userID uint, secret string) error {
+	res, err := s.db.ExecContext(ctx, `INSERT INTO totp_credentials (user_id, secret, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at
+		WHERE totp_credentials.confirmed_at IS NULL`, userID, secret, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	saved, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return apperrors.ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *Storage) GetTOTP(ctx context.Context, userID uint) (model.TOTP, error) {
+	var totp model.TOTP
+	err := s.db.GetContext(ctx, &totp, "SELECT user_id, secret, created_at, confirmed_at, last_used_step FROM totp_credentials WHERE user_id = $1", userID)
+	return totp, err
+}
+
+// EnableTOTP confirms the secret of the user with the code of step and replaces the recovery codes.
+func (s *Storage) EnableTOTP(ctx context.Context, userID uint, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+	res, err := tx.ExecContext(ctx, `UPDATE totp_credentials SET confirmed_at = $1, last_used_step = $2
+		WHERE user_id = $3 AND confirmed_at IS NULL`, time.Now().UTC(), step, userID)
+	if err != nil {
+		return err
+	}
+	enabled, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if enabled == 0 {
+		return apperrors.ErrTOTPAlreadyEnabled
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseTOTPStep accepts a code of step unless a code of the same or a later step was accepted before.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE totp_credentials SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1", step, userID)
+	if err != nil {
+		return false, err
+	}
+	used, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return used > 0, nil
+}
+
+// UseRecoveryCode marks the recovery code used. It returns false if the code is unknown or used.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	used, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return used > 0, nil
+}
+
+// DeleteTOTP turns two-factor authentication off and drops the recovery codes.
+func (s *Storage) DeleteTOTP(ctx context.Context, userID uint) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM totp_credentials WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const campaignColumns = `c.id, c.name, c.starts_at, c.ends_at, c.bonus_percent, c.bonus_points, c.tiers, c.per_user_cap,
+	(SELECT COALESCE(SUM(b.amount), 0) FROM campaign_bonuses b WHERE b.campaign_id = c.id) AS granted, c.created_by, c.created_at`
+
+func (s *Storage) AddCampaign(ctx context.Context, campaign model.Campaign) (model.Campaign, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Campaign{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	campaign.CreatedAt = time.Now().UTC()
+	if err := tx.GetContext(ctx, &campaign.ID, `INSERT INTO campaigns (name, starts_at, ends_at, bonus_percent, bonus_points, tiers, per_user_cap, created_by, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9) RETURNING id`,
+		campaign.Name, campaign.StartsAt.UTC(), campaign.EndsAt.UTC(), campaign.BonusPercent, campaign.BonusPoints, campaign.Tiers, campaign.PerUserCap,
+		campaign.CreatedBy, campaign.CreatedAt); err != nil {
+		return model.Campaign{}, err
+	}
+	for _, userID := range campaign.UserIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO campaign_users (campaign_id, user_id) VALUES (?1, ?2) ON CONFLICT DO NOTHING",
+			campaign.ID, userID); err != nil {
+			return model.Campaign{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Campaign{}, err
+	}
+	return campaign, nil
+}
+
+func (s *Storage) GetCampaign(ctx context.Context, id uint) (model.Campaign, error) {
+	var campaign model.Campaign
+	if err := s.db.GetContext(ctx, &campaign, "SELECT "+campaignColumns+" FROM campaigns c WHERE c.id = ?1", id); err != nil {
+		return model.Campaign{}, err
+	}
+	campaigns := []model.Campaign{campaign}
+	err := s.getCampaignUsers(ctx, campaigns)
+	return campaigns[0], err
+}
+
+func (s *Storage) GetCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	if err := s.db.SelectContext(ctx, &campaigns, "SELECT "+campaignColumns+" FROM campaigns c ORDER BY c.starts_at DESC, c.id DESC"); err != nil {
+		return nil, err
+	}
+	return campaigns, s.getCampaignUsers(ctx, campaigns)
+}
+
+// GetActiveCampaigns returns the campaigns that orders uploaded at the given time take part in.
+func (s *Storage) GetActiveCampaigns(ctx context.Context, at time.Time) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	if err := s.db.SelectContext(ctx, &campaigns, "SELECT "+campaignColumns+" FROM campaigns c WHERE c.starts_at <= ?1 AND c.ends_at > ?1 ORDER BY c.id",
+		at.UTC()); err != nil {
+		return nil, err
+	}
+	return campaigns, s.getCampaignUsers(ctx, campaigns)
+}
+
+// EndCampaign moves the end of the campaign to the given time unless it ends earlier already.
+func (s *Storage) EndCampaign(ctx context.Context, id uint, at time.Time) (model.Campaign, error) {
+	if _, err := s.db.ExecContext(ctx, "UPDATE campaigns SET ends_at = MAX(?1, starts_at) WHERE id = ?2 AND ends_at > ?1", at.UTC(), id); err != nil {
+		return model.Campaign{}, err
+	}
+	return s.GetCampaign(ctx, id)
+}
+
+// AddCampaignBonus credits the bonus for the order unless the campaign has credited it already or the order
+// is not processed, e.g. it has been clawed back. The bonus is reduced so that the bonuses of the campaign
+// credited to the user do not exceed perUserCap, if set. It returns the credited amount.
+func (s *Storage) AddCampaignBonus(ctx context.Context, bonus model.CampaignBonus, perUserCap model.Amount) (model.Amount, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:all
+	var status model.OrderState
+	if err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE order_number = ?1", bonus.OrderNumber); err != nil {
+		return 0, err
+	}
+	if status != model.OrderStateProcessed {
+		return 0, nil
+	}
+	if perUserCap > 0 {
+		var granted model.Amount
+		if err := tx.GetContext(ctx, &granted, "SELECT COALESCE(SUM(amount), 0) FROM campaign_bonuses WHERE campaign_id = ?1 AND user_id = ?2",
+			bonus.CampaignID, bonus.UserID); err != nil {
+			return 0, err
+		}
+		bonus.Amount = min(bonus.Amount, perUserCap-granted)
+	}
+	if bonus.Amount <= 0 {
+		return 0, nil
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO campaign_bonuses (campaign_id, user_id, order_number, amount, created_at) VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (campaign_id, order_number) DO NOTHING`,
+		bonus.CampaignID, bonus.UserID, bonus.OrderNumber, bonus.Amount, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if inserted == 0 {
+		return 0, nil
+	}
+	if err := s.updateUserBalanceByUserIDTx(ctx, bonus.UserID, bonus.Amount, tx); err != nil {
+		return 0, err
+	}
+	if err := s.addLedgerEntryTx(ctx, bonus.LedgerEntry(), tx); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return bonus.Amount, nil
+}
+
+func (s *Storage) getCampaignUsers(ctx context.Context, campaigns []model.Campaign) error {
+	for i := range campaigns {
+		if err := s.db.SelectContext(ctx, &campaigns[i].UserIDs, "SELECT user_id FROM campaign_users WHERE campaign_id = ?1 ORDER BY user_id",
+			campaigns[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+// ReserveIdempotencyKey stores record unless an unexpired record with the same key exists that has
+// a response or is locked by a request in progress, in which case that record is returned with created = false.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	var reserved []uint
+	if err := s.db.SelectContext(ctx, &reserved, `INSERT INTO idempotency_keys (user_id, "key", request_hash, created_at, locked_until, expires_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		ON CONFLICT (user_id, "key") DO UPDATE SET request_hash = excluded.request_hash, status_code = 0, content_type = '', response_body = x'',
+			created_at = excluded.created_at, locked_until = excluded.locked_until, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at < excluded.created_at
+			OR idempotency_keys.status_code = 0 AND idempotency_keys.locked_until < excluded.created_at
+		RETURNING user_id`,
+		record.UserID, record.Key, record.RequestHash, time.Now().UTC(), record.LockedUntil.UTC(), record.ExpiresAt.UTC()); err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	if len(reserved) > 0 {
+		return record, true, nil
+	}
+	var stored model.IdempotencyRecord
+	if err := s.db.GetContext(ctx, &stored, `SELECT user_id, "key", request_hash, status_code, content_type, response_body, locked_until, expires_at
+		FROM idempotency_keys WHERE user_id = ?1 AND "key" = ?2`, record.UserID, record.Key); err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	return stored, false, nil
+}
+
+func (s *Storage) SaveIdempotentResponse(ctx context.Context, record model.IdempotencyRecord) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET status_code = ?1, content_type = ?2, response_body = ?3 WHERE user_id = ?4 AND "key" = ?5`,
+		record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, userID uint, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ?1 AND "key" = ?2`, userID, key); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < ?1", time.Now().UTC()); err != nil {
+		return err
+	}
+	return nil
+}
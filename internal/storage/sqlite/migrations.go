@@ -0,0 +1,15 @@
+package sqlite
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// Migrations returns the gophermart schema migrations for SQLite.
+func Migrations() fs.FS {
+	sub, _ := fs.Sub(migrations, "migrations")
+	return sub
+}
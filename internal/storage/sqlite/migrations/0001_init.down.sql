@@ -0,0 +1,5 @@
+DROP TABLE idempotency_keys;
+DROP TABLE ledger_entries;
+DROP TABLE withdrawals;
+DROP TABLE orders;
+DROP TABLE users;
@@ -0,0 +1,58 @@
+-- SQLite counterpart of the postgres gophermart schema up to 0006_idempotency_keys.
+-- Amounts are integer hundredths of a point, timestamps are stored in UTC.
+CREATE TABLE users (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	login text NOT NULL,
+	"password" text NOT NULL,
+	created_at timestamp NOT NULL,
+	balance integer DEFAULT 0 NOT NULL,
+	CONSTRAINT users_login_unique UNIQUE (login),
+	CONSTRAINT users_balance_check CHECK (balance >= 0)
+);
+CREATE TABLE orders (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	order_number text NOT NULL,
+	user_id integer NOT NULL,
+	uploaded_at timestamp NOT NULL,
+	status text DEFAULT 'NEW' NOT NULL,
+	accrual integer DEFAULT 0 NOT NULL,
+	next_check_at timestamp NOT NULL,
+	leased_until timestamp,
+	CONSTRAINT orders_unique UNIQUE (order_number)
+);
+CREATE INDEX orders_user_idx ON orders (user_id);
+CREATE INDEX orders_pending_idx ON orders (next_check_at) WHERE status IN ('NEW', 'PROCESSING');
+CREATE TABLE withdrawals (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	amount integer NOT NULL,
+	processed_at timestamp NOT NULL,
+	order_number text NOT NULL,
+	user_id integer NOT NULL,
+	CONSTRAINT withdrawals_order_number_unique UNIQUE (order_number)
+);
+CREATE INDEX withdrawals_user_idx ON withdrawals (user_id);
+CREATE TABLE ledger_entries (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	entry_type text NOT NULL,
+	debit_account text NOT NULL,
+	credit_account text NOT NULL,
+	amount integer NOT NULL,
+	order_number text DEFAULT '' NOT NULL,
+	created_at timestamp NOT NULL,
+	CONSTRAINT ledger_entries_amount_check CHECK (amount > 0),
+	CONSTRAINT ledger_entries_accounts_check CHECK (debit_account <> credit_account)
+);
+CREATE INDEX ledger_entries_debit_idx ON ledger_entries (debit_account, created_at);
+CREATE INDEX ledger_entries_credit_idx ON ledger_entries (credit_account, created_at);
+CREATE TABLE idempotency_keys (
+	user_id integer NOT NULL,
+	"key" text NOT NULL,
+	request_hash text NOT NULL,
+	status_code integer DEFAULT 0 NOT NULL,
+	content_type text DEFAULT '' NOT NULL,
+	response_body blob DEFAULT x'' NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL,
+	CONSTRAINT idempotency_keys_pk PRIMARY KEY (user_id, "key")
+);
+CREATE INDEX idempotency_keys_expires_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+	id text NOT NULL,
+	user_id integer NOT NULL,
+	refresh_token_hash text NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL,
+	revoked_at timestamp,
+	CONSTRAINT sessions_pk PRIMARY KEY (id)
+);
+CREATE INDEX sessions_user_idx ON sessions (user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE password_reset_tokens (
+	token_hash text NOT NULL,
+	user_id integer NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL,
+	used_at timestamp,
+	CONSTRAINT password_reset_tokens_pk PRIMARY KEY (token_hash)
+);
+CREATE INDEX password_reset_tokens_user_idx ON password_reset_tokens (user_id);
@@ -0,0 +1,8 @@
+-- Failed logins per login or client IP, see model.LoginThrottleKey.
+CREATE TABLE login_attempts (
+	"key" text NOT NULL,
+	failures integer NOT NULL,
+	last_failure_at timestamp NOT NULL,
+	blocked_until timestamp,
+	CONSTRAINT login_attempts_pk PRIMARY KEY ("key")
+);
@@ -0,0 +1,15 @@
+CREATE TABLE totp_credentials (
+	user_id integer NOT NULL,
+	secret text NOT NULL,
+	created_at timestamp NOT NULL,
+	confirmed_at timestamp,
+	-- the last accepted TOTP time step, codes up to it can not be replayed
+	last_used_step integer NOT NULL DEFAULT 0,
+	CONSTRAINT totp_credentials_pk PRIMARY KEY (user_id)
+);
+CREATE TABLE recovery_codes (
+	user_id integer NOT NULL,
+	code_hash text NOT NULL,
+	used_at timestamp,
+	CONSTRAINT recovery_codes_pk PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE balance_adjustments (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL,
+	operator_id integer NOT NULL,
+	amount integer NOT NULL,
+	reason text NOT NULL,
+	created_at timestamp NOT NULL,
+	CONSTRAINT balance_adjustments_amount_check CHECK (amount <> 0)
+);
+CREATE INDEX balance_adjustments_user_idx ON balance_adjustments (user_id, created_at);
+
+-- The audit log is append-only.
+CREATE TRIGGER balance_adjustments_no_update BEFORE UPDATE ON balance_adjustments
+BEGIN
+	SELECT RAISE(ABORT, 'balance_adjustments is append-only');
+END;
+CREATE TRIGGER balance_adjustments_no_delete BEFORE DELETE ON balance_adjustments
+BEGIN
+	SELECT RAISE(ABORT, 'balance_adjustments is append-only');
+END;
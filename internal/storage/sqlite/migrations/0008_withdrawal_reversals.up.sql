@@ -0,0 +1,2 @@
+ALTER TABLE withdrawals ADD COLUMN status text DEFAULT 'PROCESSED' NOT NULL;
+ALTER TABLE withdrawals ADD COLUMN reversed_at timestamp;
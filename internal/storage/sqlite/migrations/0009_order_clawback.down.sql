@@ -0,0 +1,15 @@
+-- Outstanding debts are dropped: settle them with an adjustment first.
+CREATE TABLE users_new (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	login text NOT NULL,
+	"password" text NOT NULL,
+	created_at timestamp NOT NULL,
+	balance integer DEFAULT 0 NOT NULL,
+	"role" text DEFAULT 'user' NOT NULL,
+	CONSTRAINT users_login_unique UNIQUE (login),
+	CONSTRAINT users_balance_check CHECK (balance >= 0)
+);
+INSERT INTO users_new (id, login, "password", created_at, balance, "role")
+	SELECT id, login, "password", created_at, balance, "role" FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
@@ -0,0 +1 @@
+DROP TABLE point_lots;
@@ -0,0 +1,15 @@
+-- See 0015_point_lots in postgres.
+CREATE TABLE point_lots (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL,
+	amount integer NOT NULL,
+	remaining integer NOT NULL,
+	accrued_at timestamp NOT NULL,
+	CONSTRAINT point_lots_remaining_check CHECK (remaining >= 0 AND remaining <= amount)
+);
+CREATE INDEX point_lots_open_idx ON point_lots (user_id, accrued_at, id) WHERE remaining > 0;
+CREATE INDEX point_lots_expiry_idx ON point_lots (accrued_at) WHERE remaining > 0;
+
+-- Points accrued before lots were tracked count as accrued now.
+INSERT INTO point_lots (user_id, amount, remaining, accrued_at)
+	SELECT id, balance, balance, strftime('%Y-%m-%d %H:%M:%f', 'now') FROM users WHERE balance > 0;
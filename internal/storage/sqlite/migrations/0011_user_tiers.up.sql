@@ -0,0 +1,7 @@
+-- Users without a row are bronze with no tier points.
+CREATE TABLE user_tiers (
+	user_id integer PRIMARY KEY,
+	tier text NOT NULL,
+	points integer NOT NULL,
+	updated_at timestamp NOT NULL
+);
@@ -0,0 +1,19 @@
+CREATE TABLE referral_codes (
+	user_id integer PRIMARY KEY,
+	code text NOT NULL,
+	CONSTRAINT referral_codes_code_unique UNIQUE (code)
+);
+
+-- A user is referred at most once, at registration.
+CREATE TABLE referrals (
+	referred_id integer PRIMARY KEY,
+	referrer_id integer NOT NULL,
+	status text DEFAULT 'PENDING' NOT NULL,
+	reject_reason text DEFAULT '' NOT NULL,
+	order_number text DEFAULT '' NOT NULL,
+	referrer_bonus integer DEFAULT 0 NOT NULL,
+	referee_bonus integer DEFAULT 0 NOT NULL,
+	created_at timestamp NOT NULL,
+	settled_at timestamp
+);
+CREATE INDEX referrals_referrer_idx ON referrals (referrer_id, created_at);
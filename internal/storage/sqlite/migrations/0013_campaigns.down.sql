@@ -0,0 +1,3 @@
+DROP TABLE campaign_bonuses;
+DROP TABLE campaign_users;
+DROP TABLE campaigns;
@@ -0,0 +1,33 @@
+-- tiers is a comma-separated list, empty for every tier.
+CREATE TABLE campaigns (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	name text NOT NULL,
+	starts_at timestamp NOT NULL,
+	ends_at timestamp NOT NULL,
+	bonus_percent integer DEFAULT 0 NOT NULL,
+	bonus_points integer DEFAULT 0 NOT NULL,
+	tiers text DEFAULT '' NOT NULL,
+	per_user_cap integer DEFAULT 0 NOT NULL,
+	created_by integer NOT NULL,
+	created_at timestamp NOT NULL
+);
+CREATE INDEX campaigns_period_idx ON campaigns (starts_at, ends_at);
+
+-- A campaign without rows is open to every user.
+CREATE TABLE campaign_users (
+	campaign_id integer NOT NULL,
+	user_id integer NOT NULL,
+	PRIMARY KEY (campaign_id, user_id)
+);
+
+CREATE TABLE campaign_bonuses (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	campaign_id integer NOT NULL,
+	user_id integer NOT NULL,
+	order_number text NOT NULL,
+	amount integer NOT NULL,
+	created_at timestamp NOT NULL,
+	CONSTRAINT campaign_bonuses_order_unique UNIQUE (campaign_id, order_number)
+);
+CREATE INDEX campaign_bonuses_user_idx ON campaign_bonuses (campaign_id, user_id);
+CREATE INDEX campaign_bonuses_order_idx ON campaign_bonuses (order_number);
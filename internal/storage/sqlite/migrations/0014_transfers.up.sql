@@ -0,0 +1,17 @@
+CREATE TABLE transfers (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	sender_id integer NOT NULL,
+	recipient_id integer NOT NULL,
+	amount integer NOT NULL,
+	comment text DEFAULT '' NOT NULL,
+	status text NOT NULL,
+	created_at timestamp NOT NULL,
+	settled_at timestamp,
+	CONSTRAINT transfers_amount_check CHECK (amount > 0),
+	CONSTRAINT transfers_users_check CHECK (sender_id <> recipient_id)
+);
+CREATE INDEX transfers_sender_idx ON transfers (sender_id, created_at);
+CREATE INDEX transfers_recipient_idx ON transfers (recipient_id, created_at);
+
+-- Entries of a transfer refer to it, 0 for other entries.
+ALTER TABLE ledger_entries ADD COLUMN transfer_id integer DEFAULT 0 NOT NULL;
@@ -0,0 +1,2 @@
+-- A request in progress holds its key until locked_until, then another request may take it over.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until timestamp DEFAULT '1970-01-01 00:00:00+00:00' NOT NULL;
@@ -0,0 +1,2 @@
+-- The debt column now comes with 0009_order_clawback, see 0022_user_debt in postgres.
+SELECT 1;
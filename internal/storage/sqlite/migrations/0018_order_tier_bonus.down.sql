@@ -0,0 +1 @@
+ALTER TABLE orders DROP COLUMN tier_bonus;
@@ -0,0 +1,2 @@
+-- See 0023_order_tier_bonus in postgres.
+ALTER TABLE orders ADD COLUMN tier_bonus integer DEFAULT 0 NOT NULL;
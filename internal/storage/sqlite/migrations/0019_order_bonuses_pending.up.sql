@@ -0,0 +1,3 @@
+-- See 0024_order_bonuses_pending in postgres.
+ALTER TABLE orders ADD COLUMN bonuses_pending integer DEFAULT 0 NOT NULL;
+CREATE INDEX orders_bonuses_pending_idx ON orders (id) WHERE bonuses_pending;
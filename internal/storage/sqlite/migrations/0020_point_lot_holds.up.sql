@@ -0,0 +1,9 @@
+-- See 0025_point_lot_holds in postgres.
+CREATE TABLE point_lot_holds (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	order_number text DEFAULT '' NOT NULL,
+	transfer_id integer DEFAULT 0 NOT NULL,
+	amount integer NOT NULL,
+	accrued_at timestamp NOT NULL
+);
+CREATE INDEX point_lot_holds_source_idx ON point_lot_holds (order_number, transfer_id);
@@ -0,0 +1,2 @@
+-- See 0026_order_lease_token in postgres.
+ALTER TABLE orders ADD COLUMN lease_token text;
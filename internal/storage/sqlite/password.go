@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) UpdateUserPassword(ctx context.Context, userID uint, password string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET password = ?1 WHERE id = ?2", password, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Storage) CreatePasswordResetToken(ctx context.Context, token model.PasswordResetToken) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at) VALUES (?1, ?2, ?3, ?4)",
+		token.TokenHash, token.UserID, token.CreatedAt.UTC(), token.ExpiresAt.UTC()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResetPassword uses the token to set the password of its user. The token and all other
+// outstanding tokens of the user are marked used in the same transaction.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash, password string) (uint, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:all
+	now := time.Now().UTC()
+	var userIDs []uint
+	if err := tx.SelectContext(ctx, &userIDs, `UPDATE password_reset_tokens SET used_at = ?1
+		WHERE token_hash = ?2 AND used_at IS NULL AND expires_at > ?1 RETURNING user_id`, now, tokenHash); err != nil {
+		return 0, err
+	}
+	if len(userIDs) == 0 {
+		return 0, apperrors.ErrInvalidResetToken
+	}
+	userID := userIDs[0]
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ?1 WHERE id = ?2", password, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = ?1 WHERE user_id = ?2 AND used_at IS NULL", now, userID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const referralColumns = `r.referred_id, u.login AS referred_login, r.referrer_id, r.status, r.reject_reason, r.order_number,
+	r.referrer_bonus, r.referee_bonus, r.created_at, r.settled_at`
+
+// EnsureReferralCode stores code as the referral code of the user unless the user already has one,
+// and returns the code the user ends up with.
+func (s *Storage) EnsureReferralCode(ctx context.Context, userID uint, code string) (string, error) {
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO referral_codes (user_id, code) VALUES (?1, ?2) ON CONFLICT (user_id) DO NOTHING",
+		userID, code); err != nil {
+		return "", err
+	}
+	var stored string
+	err := s.db.GetContext(ctx, &stored, "SELECT code FROM referral_codes WHERE user_id = ?1", userID)
+	return stored, err
+}
+
+func (s *Storage) GetUserIDByReferralCode(ctx context.Context, code string) (userID uint, err error) {
+	err = s.db.GetContext(ctx, &userID, "SELECT user_id FROM referral_codes WHERE code = ?1", code)
+	return
+}
+
+func (s *Storage) AddReferral(ctx context.Context, referral model.Referral) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO referrals (referred_id, referrer_id, status, created_at) VALUES (?1, ?2, ?3, ?4)",
+		referral.ReferredID, referral.ReferrerID, model.ReferralStatusPending, time.Now().UTC())
+	return err
+}
+
+func (s *Storage) GetReferral(ctx context.Context, referredID uint) (referral model.Referral, err error) {
+	err = s.db.GetContext(ctx, &referral, "SELECT "+referralColumns+" FROM referrals r JOIN users u ON u.id = r.referred_id WHERE r.referred_id = ?1",
+		referredID)
+	return
+}
+
+func (s *Storage) GetReferralsByReferrer(ctx context.Context, referrerID uint) (referrals []model.Referral, err error) {
+	err = s.db.SelectContext(ctx, &referrals, "SELECT "+referralColumns+` FROM referrals r JOIN users u ON u.id = r.referred_id
+		WHERE r.referrer_id = ?1 ORDER BY r.created_at, r.referred_id`, referrerID)
+	return
+}
+
+// CreditReferral settles the pending referral with referral.OrderNumber and the bonuses of the referral
+// and credits the bonuses to both users. It reports false if the referral is settled already or the order
+// is not processed, e.g. it has been clawed back, and fails with apperrors.ErrReferralLimit if the referrer
+// has maxPerReferrer credited referrals already; 0 means no limit.
+func (s *Storage) CreditReferral(ctx context.Context, referral model.Referral, maxPerReferrer int) (bool, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() //nolint:all
+	var status model.OrderState
+	if err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE order_number = ?1", referral.OrderNumber); err != nil {
+		return false, err
+	}
+	if status != model.OrderStateProcessed {
+		return false, nil
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE referrals SET status = ?1, order_number = ?2, referrer_bonus = ?3, referee_bonus = ?4, settled_at = ?5
+		WHERE referred_id = ?6 AND status = ?7`,
+		model.ReferralStatusCredited, referral.OrderNumber, referral.ReferrerBonus, referral.RefereeBonus, time.Now().UTC(),
+		referral.ReferredID, model.ReferralStatusPending)
+	if err != nil {
+		return false, err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if updated == 0 {
+		return false, nil
+	}
+	// the count includes this referral, rolled back if it is over the limit
+	if maxPerReferrer > 0 {
+		var credited int
+		if err := tx.GetContext(ctx, &credited, "SELECT COUNT(*) FROM referrals WHERE referrer_id = ?1 AND status = ?2",
+			referral.ReferrerID, model.ReferralStatusCredited); err != nil {
+			return false, err
+		}
+		if credited > maxPerReferrer {
+			return false, apperrors.ErrReferralLimit
+		}
+	}
+	for _, bonus := range referral.Bonuses() {
+		if err := s.updateUserBalanceByUserIDTx(ctx, bonus.UserID, bonus.Amount, tx); err != nil {
+			return false, err
+		}
+		if err := s.addLedgerEntryTx(ctx, bonus.LedgerEntry(referral.OrderNumber), tx); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RejectReferral settles the pending referral without bonuses.
+func (s *Storage) RejectReferral(ctx context.Context, referredID uint, reason string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE referrals SET status = ?1, reject_reason = ?2, settled_at = ?3 WHERE referred_id = ?4 AND status = ?5",
+		model.ReferralStatusRejected, reason, time.Now().UTC(), referredID, model.ReferralStatusPending)
+	return err
+}
@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+func (s *Storage) CreateSession(ctx context.Context, session model.Session) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO sessions (id, user_id, refresh_token_hash, created_at, expires_at) VALUES (?1, ?2, ?3, ?4, ?5)",
+		session.ID, session.UserID, session.RefreshTokenHash, session.CreatedAt.UTC(), session.ExpiresAt.UTC()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (session model.Session, err error) {
+	err = s.db.GetContext(ctx, &session, "SELECT id, user_id, refresh_token_hash, created_at, expires_at, revoked_at FROM sessions WHERE id = ?1", id)
+	return
+}
+
+// RotateSession replaces the refresh token hash if the session is active and still has oldHash,
+// so of two concurrent refreshes with the same token only one succeeds.
+func (s *Storage) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET refresh_token_hash = ?1, expires_at = ?2
+		WHERE id = ?3 AND refresh_token_hash = ?4 AND revoked_at IS NULL AND expires_at > ?5`,
+		newHash, expiresAt.UTC(), id, oldHash, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = ?1 WHERE id = ?2 AND revoked_at IS NULL", time.Now().UTC(), id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all sessions of the user except keepSessionID, which may be empty.
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID uint, keepSessionID string) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = ?1 WHERE user_id = ?2 AND id <> ?3 AND revoked_at IS NULL",
+		time.Now().UTC(), userID, keepSessionID); err != nil {
+		return err
+	}
+	return nil
+}
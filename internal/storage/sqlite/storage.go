@@ -0,0 +1,450 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	server "github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+// Storage keeps gophermart data in a SQLite database. SQLite has a single writer,
+// so instead of row locks the connection pool is limited to one connection and
+// every transaction takes the write lock up front.
+type Storage struct {
+	db *sqlx.DB
+}
+
+// Connect opens the database of a sqlite://<path> URI, e.g. sqlite://gophermart.db.
+func Connect(uri string) (*sqlx.DB, error) {
+	dsn := strings.TrimPrefix(uri, "sqlite://")
+	if strings.Contains(dsn, "?") {
+		dsn += "&"
+	} else {
+		dsn += "?"
+	}
+	dsn += "_busy_timeout=5000&_txlock=immediate"
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func NewStorage(db *sqlx.DB) server.Storage {
+	return &Storage{db: db}
+}
+
+func (s *Storage) AddUser(ctx context.Context, login, password string) (uint, error) {
+	var ids []uint
+	if err := s.db.SelectContext(ctx, &ids, "INSERT INTO users (login, password, created_at) VALUES (?1, ?2, ?3) ON CONFLICT (login) DO NOTHING RETURNING id",
+		login, password, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, apperrors.ErrUserAlreadyExists
+	}
+	return ids[0], nil
+}
+
+func (s *Storage) GetUserByLogin(ctx context.Context, login string) (user model.User, err error) {
+	err = s.db.GetContext(ctx, &user, "SELECT id, login, password, role, created_at, balance FROM users WHERE login = ?1", login)
+	return
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, id uint) (user model.User, err error) {
+	err = s.db.GetContext(ctx, &user, "SELECT id, login, password, role, created_at, balance, debt FROM users WHERE id = ?1", id)
+	return
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userID uint, role model.Role) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET role = ?1 WHERE id = ?2", role, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Storage) UploadOrder(ctx context.Context, userID uint, number string) error {
+	now := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, "INSERT INTO orders (order_number, user_id, status, uploaded_at, next_check_at) VALUES (?1, ?2, ?3, ?4, ?4) ON CONFLICT (order_number) DO NOTHING",
+		number, userID, model.OrderStateNew, now)
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return apperrors.ErrOrderAlreadyUploaded
+	}
+	return nil
+}
+
+func (s *Storage) GetOrderByNumber(ctx context.Context, number string) (order model.Order, err error) {
+	err = s.db.GetContext(ctx, &order, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE order_number = ?1", number)
+	return
+}
+
+// SetOrderStatus leaves processed and reversed orders alone, so a worker holding a stale lease
+// can not reopen them.
+func (s *Storage) SetOrderStatus(ctx context.Context, orderNumber string, status model.OrderState) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET status = ?1 WHERE order_number = ?2 AND status NOT IN (?3, ?4)",
+		status, orderNumber, model.OrderStateProcessed, model.OrderStateReversed); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) GetOrdersByUserID(ctx context.Context, userID uint) (orders []model.Order, err error) {
+	err = s.db.SelectContext(ctx, &orders, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE user_id = ?1 ORDER BY uploaded_at, id", userID)
+	return
+}
+
+func (s *Storage) FinalizeOrderAndUpdateBalance(ctx context.Context, orderNumber string, accrual, tierBonus model.Amount) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+	finalized, err := s.setOrderAccrualTx(ctx, orderNumber, accrual, tierBonus, tx)
+	if err != nil {
+		return err
+	}
+	if !finalized {
+		// another worker has already credited this order
+		return nil
+	}
+	userID, err := s.updateUserBalanceByOrderNumberTx(ctx, orderNumber, accrual+tierBonus, tx)
+	if err != nil {
+		return err
+	}
+	order := model.Order{OrderNumber: orderNumber, UserID: userID, Accrual: accrual, TierBonus: tierBonus}
+	for _, entry := range order.AccrualEntries() {
+		if err := s.addLedgerEntryTx(ctx, entry, tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LeasePendingOrders marks up to limit due orders as taken for leaseTime under token. The statement
+// runs under the database write lock, so concurrent pollers never lease the same order.
+func (s *Storage) LeasePendingOrders(ctx context.Context, token string, limit int, leaseTime time.Duration) (orders []string, err error) {
+	now := time.Now().UTC()
+	err = s.db.SelectContext(ctx, &orders, `UPDATE orders SET leased_until = ?1, lease_token = ?2
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status IN (?3, ?4) AND next_check_at <= ?5 AND (leased_until IS NULL OR leased_until < ?5)
+			ORDER BY next_check_at
+			LIMIT ?6)
+		RETURNING order_number`,
+		now.Add(leaseTime), token, model.OrderStateNew, model.OrderStateProcessing, now, limit)
+	return
+}
+
+func (s *Storage) RenewOrderLeases(ctx context.Context, token string, leaseTime time.Duration) (orders []string, err error) {
+	err = s.db.SelectContext(ctx, &orders, `UPDATE orders SET leased_until = ?1
+		WHERE lease_token = ?2 AND leased_until IS NOT NULL
+		RETURNING order_number`,
+		time.Now().UTC().Add(leaseTime), token)
+	return
+}
+
+func (s *Storage) ReleaseOrder(ctx context.Context, orderNumber, token string, nextCheckIn time.Duration) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET leased_until = NULL, lease_token = NULL, next_check_at = ?1 WHERE order_number = ?2 AND lease_token = ?3",
+		time.Now().UTC().Add(nextCheckIn), orderNumber, token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetOrdersWithPendingBonuses returns up to limit finalized orders whose referral and campaign bonuses
+// have not been credited yet.
+func (s *Storage) GetOrdersWithPendingBonuses(ctx context.Context, limit int) (orders []string, err error) {
+	err = s.db.SelectContext(ctx, &orders, "SELECT order_number FROM orders WHERE bonuses_pending ORDER BY id LIMIT ?1", limit)
+	return
+}
+
+func (s *Storage) ClearOrderBonusesPending(ctx context.Context, orderNumber string) error {
+	if _, err := s.db.ExecContext(ctx, "UPDATE orders SET bonuses_pending = 0 WHERE order_number = ?1", orderNumber); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) ProcessWithdrawal(ctx context.Context, withdrawal model.Withdrawal) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:all
+	if err := s.addWithdrawalTx(ctx, withdrawal, tx); err != nil {
+		return err
+	}
+	lots, err := s.moveUserBalanceTx(ctx, withdrawal.UserID, -withdrawal.Amount, nil, tx)
+	if err != nil {
+		return err
+	}
+	if err := s.holdPointLotsTx(ctx, withdrawal.OrderNumber, 0, lots, tx); err != nil {
+		return err
+	}
+	if err := s.addLedgerEntryTx(ctx, model.LedgerEntry{
+		Type:          model.LedgerEntryWithdrawal,
+		DebitAccount:  model.UserAccount(withdrawal.UserID),
+		CreditAccount: model.SystemAccountWithdrawals,
+		Amount:        withdrawal.Amount,
+		OrderNumber:   withdrawal.OrderNumber,
+	}, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClawbackOrder takes the accrual, the tier bonus and the campaign bonuses of a processed order back from its owner and
+// the referral bonuses paid for the order back from both parties, and marks the order reversed. Unless
+// allowDebt is set, it fails with apperrors.ErrNotEnoughFunds if a balance does not cover them; otherwise
+// what the balance does not cover is recorded as the user's debt.
+func (s *Storage) ClawbackOrder(ctx context.Context, orderNumber string, allowDebt bool) (model.Order, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Order{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var order model.Order
+	if err := tx.GetContext(ctx, &order, "SELECT id, order_number, user_id, status, uploaded_at, accrual, tier_bonus FROM orders WHERE order_number = ?1",
+		orderNumber); err != nil {
+		return model.Order{}, err
+	}
+	switch order.Status {
+	case model.OrderStateProcessed:
+	case model.OrderStateReversed:
+		return model.Order{}, apperrors.ErrOrderAlreadyReversed
+	default:
+		return model.Order{}, apperrors.ErrOrderNotProcessed
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?1 WHERE id = ?2", model.OrderStateReversed, order.ID); err != nil {
+		return model.Order{}, err
+	}
+	order.Status = model.OrderStateReversed
+	var campaignBonuses model.Amount
+	if err := tx.GetContext(ctx, &campaignBonuses, "SELECT COALESCE(SUM(amount), 0) FROM campaign_bonuses WHERE order_number = ?1",
+		orderNumber); err != nil {
+		return model.Order{}, err
+	}
+	for _, entry := range order.ClawbackEntries(campaignBonuses) {
+		if err := s.clawbackTx(ctx, order.UserID, entry.Amount, allowDebt, tx); err != nil {
+			return model.Order{}, err
+		}
+		if err := s.addLedgerEntryTx(ctx, entry, tx); err != nil {
+			return model.Order{}, err
+		}
+	}
+	// the referral bonuses paid for the order go back as well
+	var referrals []model.Referral
+	if err := tx.SelectContext(ctx, &referrals, `UPDATE referrals SET status = ?1 WHERE order_number = ?2 AND status = ?3
+		RETURNING referred_id, referrer_id, referrer_bonus, referee_bonus`,
+		model.ReferralStatusReversed, orderNumber, model.ReferralStatusCredited); err != nil {
+		return model.Order{}, err
+	}
+	for _, referral := range referrals {
+		for _, bonus := range referral.Bonuses() {
+			if err := s.clawbackTx(ctx, bonus.UserID, bonus.Amount, allowDebt, tx); err != nil {
+				return model.Order{}, err
+			}
+			if err := s.addLedgerEntryTx(ctx, bonus.ReversalEntry(orderNumber), tx); err != nil {
+				return model.Order{}, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, err
+	}
+	return order, nil
+}
+
+// clawbackTx takes amount back from the user. Unless allowDebt is set, it fails with apperrors.ErrNotEnoughFunds
+// if the balance does not cover it; otherwise what the balance does not cover is recorded as the user's debt.
+func (s *Storage) clawbackTx(ctx context.Context, userID uint, amount model.Amount, allowDebt bool, tx *sqlx.Tx) error {
+	if !allowDebt {
+		return s.updateUserBalanceByUserIDTx(ctx, userID, -amount, tx)
+	}
+	var balance model.Amount
+	if err := tx.GetContext(ctx, &balance, `UPDATE users SET balance = max(balance - ?1, 0), debt = debt + max(?1 - balance, 0)
+		WHERE id = ?2 RETURNING balance`, amount, userID); err != nil {
+		return err
+	}
+	_, err := s.updatePointLotsTx(ctx, userID, -amount, balance, nil, tx)
+	return err
+}
+
+// ReverseWithdrawal returns the points of the withdrawal to the user and marks it reversed.
+// It fails with apperrors.ErrWithdrawalAlreadyReversed if the withdrawal is reversed already.
+func (s *Storage) ReverseWithdrawal(ctx context.Context, orderNumber string) (model.Withdrawal, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Withdrawal{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var withdrawal model.Withdrawal
+	if err := tx.GetContext(ctx, &withdrawal, "SELECT id, amount, processed_at, order_number, user_id, status, reversed_at FROM withdrawals WHERE order_number = ?1",
+		orderNumber); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if withdrawal.Status == model.WithdrawalStateReversed {
+		return model.Withdrawal{}, apperrors.ErrWithdrawalAlreadyReversed
+	}
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE withdrawals SET status = ?1, reversed_at = ?2 WHERE id = ?3",
+		model.WithdrawalStateReversed, now, withdrawal.ID); err != nil {
+		return model.Withdrawal{}, err
+	}
+	withdrawal.Status = model.WithdrawalStateReversed
+	withdrawal.ReversedAt = &now
+	lots, err := s.releasePointLotsTx(ctx, withdrawal.OrderNumber, 0, tx)
+	if err != nil {
+		return model.Withdrawal{}, err
+	}
+	if _, err := s.moveUserBalanceTx(ctx, withdrawal.UserID, withdrawal.Amount, lots, tx); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if err := s.addLedgerEntryTx(ctx, model.LedgerEntry{
+		Type:          model.LedgerEntryReversal,
+		DebitAccount:  model.SystemAccountWithdrawals,
+		CreditAccount: model.UserAccount(withdrawal.UserID),
+		Amount:        withdrawal.Amount,
+		OrderNumber:   withdrawal.OrderNumber,
+	}, tx); err != nil {
+		return model.Withdrawal{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Withdrawal{}, err
+	}
+	return withdrawal, nil
+}
+
+func (s *Storage) GetWithdrawalsSumByUserID(ctx context.Context, userID uint) (sum model.Amount, err error) {
+	err = s.db.GetContext(ctx, &sum, "SELECT COALESCE(SUM(amount), 0) FROM withdrawals WHERE user_id = ?1 AND status = ?2", userID, model.WithdrawalStateProcessed)
+	return
+}
+
+func (s *Storage) GetWithdrawalsByUserID(ctx context.Context, userID uint) (withdrawals []model.Withdrawal, err error) {
+	err = s.db.SelectContext(ctx, &withdrawals, "SELECT id, amount, processed_at, order_number, user_id, status, reversed_at FROM withdrawals WHERE user_id = ?1 ORDER BY processed_at, id", userID)
+	return
+}
+
+// GetBalanceAt reconstructs the user's balance from ledger entries created up to and including at.
+func (s *Storage) GetBalanceAt(ctx context.Context, userID uint, at time.Time) (balance model.Amount, err error) {
+	err = s.db.GetContext(ctx, &balance, `SELECT COALESCE(SUM(CASE WHEN credit_account = ?1 THEN amount ELSE -amount END), 0)
+		FROM ledger_entries WHERE (credit_account = ?1 OR debit_account = ?1) AND created_at <= ?2`, model.UserAccount(userID), at.UTC())
+	return
+}
+
+// GetBalanceDiscrepancies lists users whose stored balance, less the debt, does not match the sum of their ledger entries.
+func (s *Storage) GetBalanceDiscrepancies(ctx context.Context) (discrepancies []model.BalanceDiscrepancy, err error) {
+	err = s.db.SelectContext(ctx, &discrepancies, `SELECT u.id AS user_id, u.balance - u.debt AS balance, COALESCE(l.balance, 0) AS ledger_balance
+		FROM users u
+		LEFT JOIN (
+			SELECT account, SUM(amount) AS balance FROM (
+				SELECT credit_account AS account, amount FROM ledger_entries
+				UNION ALL
+				SELECT debit_account AS account, -amount FROM ledger_entries
+			) e GROUP BY account
+		) l ON l.account = 'user:' || u.id
+		WHERE u.balance - u.debt <> COALESCE(l.balance, 0)
+		ORDER BY u.id`)
+	return
+}
+
+// updateUserBalanceByOrderNumberTx adds amount to the balance of the order's owner
+// unless that would drive the balance below zero.
+func (s *Storage) updateUserBalanceByOrderNumberTx(ctx context.Context, orderNumber string, amount model.Amount, tx *sqlx.Tx) (uint, error) {
+	var userID uint
+	if err := tx.GetContext(ctx, &userID, "SELECT user_id FROM orders WHERE order_number = ?1", orderNumber); err != nil {
+		return 0, err
+	}
+	return userID, s.updateUserBalanceByUserIDTx(ctx, userID, amount, tx)
+}
+
+// updateUserBalanceByUserIDTx adds amount to the user's balance unless that would drive it below zero.
+// A credit pays off the debt left by a clawback first.
+func (s *Storage) updateUserBalanceByUserIDTx(ctx context.Context, userID uint, amount model.Amount, tx *sqlx.Tx) error {
+	_, err := s.moveUserBalanceTx(ctx, userID, amount, nil, tx)
+	return err
+}
+
+// moveUserBalanceTx adds amount to the user's balance like updateUserBalanceByUserIDTx. Points credited
+// keep the accrual time of the lots in from, and the lots consumed by a debit are returned, so that points
+// moved between balances or held and returned do not extend their expiry.
+func (s *Storage) moveUserBalanceTx(ctx context.Context, userID uint, amount model.Amount, from []model.PointLot, tx *sqlx.Tx) ([]model.PointLot, error) {
+	var balances []model.Amount
+	if err := tx.SelectContext(ctx, &balances, `UPDATE users SET balance = balance + ?1 - min(debt, max(?1, 0)), debt = debt - min(debt, max(?1, 0))
+		WHERE id = ?2 AND (?1 >= 0 OR balance + ?1 >= 0) RETURNING balance`, amount, userID); err != nil {
+		return nil, err
+	}
+	if len(balances) == 0 {
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id = ?1)", userID); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, sql.ErrNoRows
+		}
+		return nil, apperrors.ErrNotEnoughFunds
+	}
+	return s.updatePointLotsTx(ctx, userID, amount, balances[0], from, tx)
+}
+
+// setOrderAccrualTx finalizes the order and reports false if it has already been finalized or reversed.
+func (s *Storage) setOrderAccrualTx(ctx context.Context, orderNumber string, accrual, tierBonus model.Amount, tx *sqlx.Tx) (bool, error) {
+	res, err := tx.ExecContext(ctx, "UPDATE orders SET accrual = ?1, tier_bonus = ?5, status = ?2, bonuses_pending = 1 WHERE order_number = ?3 AND status NOT IN (?2, ?4)",
+		accrual, model.OrderStateProcessed, orderNumber, model.OrderStateReversed, tierBonus)
+	if err != nil {
+		return false, err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated > 0, nil
+}
+
+func (s *Storage) addWithdrawalTx(ctx context.Context, withdrawal model.Withdrawal, tx *sqlx.Tx) error {
+	res, err := tx.ExecContext(ctx, "INSERT INTO withdrawals (amount, processed_at, order_number, user_id) VALUES (?1, ?2, ?3, ?4) ON CONFLICT (order_number) DO NOTHING",
+		withdrawal.Amount, time.Now().UTC(), withdrawal.OrderNumber, withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return apperrors.ErrWithdrawalAlreadyExists
+	}
+	return nil
+}
+
+func (s *Storage) addLedgerEntryTx(ctx context.Context, entry model.LedgerEntry, tx *sqlx.Tx) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (entry_type, debit_account, credit_account, amount, order_number, transfer_id, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)`,
+		entry.Type, entry.DebitAccount, entry.CreditAccount, entry.Amount, entry.OrderNumber, entry.TransferID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/migrate"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+	"github.com/mrkovshik/yandex_diploma/internal/storage/storagetest"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	db, err := Connect("sqlite://" + filepath.Join(t.TempDir(), "gophermart.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrate.New(db, Migrations(), "schema_migrations")
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return &Storage{db: db}
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return newTestStorage(t)
+	})
+}
+
+func TestStorage_balanceAdjustmentsAreAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	userID := storagetest.NewUserWithBalance(t, s, 0)
+	operatorID := storagetest.NewUserWithBalance(t, s, 0)
+	adjustment, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: 100, Reason: "test"})
+	require.NoError(t, err)
+	_, err = s.db.ExecContext(ctx, "UPDATE balance_adjustments SET amount = 1000 WHERE id = ?1", adjustment.ID)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = s.db.ExecContext(ctx, "DELETE FROM balance_adjustments WHERE id = ?1", adjustment.ID)
+	assert.ErrorContains(t, err, "append-only")
+}
+
+func TestStorage_balanceCanNotGoNegative(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	userID := storagetest.NewUserWithBalance(t, s, 100)
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET balance = -1 WHERE id = ?1", userID)
+	assert.ErrorContains(t, err, "users_balance_check")
+	_, err = s.db.ExecContext(ctx, "UPDATE users SET debt = -1 WHERE id = ?1", userID)
+	assert.ErrorContains(t, err, "users_debt_check")
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+)
+
+const transferColumns = `t.id, t.sender_id, s.login AS sender_login, t.recipient_id, r.login AS recipient_login, t.amount, t.comment,
+	t.status, t.created_at, t.settled_at`
+
+const transferTables = "transfers t JOIN users s ON s.id = t.sender_id JOIN users r ON r.id = t.recipient_id"
+
+// CreateTransfer debits the sender and either credits the recipient or, for a pending transfer, holds
+// the points on the transfers account. It fails with apperrors.ErrTransferLimitExceeded if the pending
+// and completed transfers of the sender since limits.Since together with this one break the limits.
+func (s *Storage) CreateTransfer(ctx context.Context, transfer model.Transfer, limits model.TransferLimits) (model.Transfer, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var sent struct {
+		Amount model.Amount `db:"amount"`
+		Count  int          `db:"count"`
+	}
+	if err := tx.GetContext(ctx, &sent, `SELECT COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count FROM transfers
+		WHERE sender_id = ?1 AND created_at > ?2 AND status IN (?3, ?4)`,
+		transfer.SenderID, limits.Since.UTC(), model.TransferStatusPending, model.TransferStatusCompleted); err != nil {
+		return model.Transfer{}, err
+	}
+	if limits.Exceeded(sent.Amount, sent.Count, transfer.Amount) {
+		return model.Transfer{}, apperrors.ErrTransferLimitExceeded
+	}
+	now := time.Now().UTC()
+	var settledAt *time.Time
+	if transfer.Status != model.TransferStatusPending {
+		settledAt = &now
+	}
+	if err := tx.GetContext(ctx, &transfer.ID, `INSERT INTO transfers (sender_id, recipient_id, amount, comment, status, created_at, settled_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7) RETURNING id`,
+		transfer.SenderID, transfer.RecipientID, transfer.Amount, transfer.Comment, transfer.Status, now, settledAt); err != nil {
+		return model.Transfer{}, err
+	}
+	lots, err := s.moveUserBalanceTx(ctx, transfer.SenderID, -transfer.Amount, nil, tx)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if transfer.Status == model.TransferStatusCompleted {
+		if _, err := s.moveUserBalanceTx(ctx, transfer.RecipientID, transfer.Amount, lots, tx); err != nil {
+			return model.Transfer{}, err
+		}
+	} else if err := s.holdPointLotsTx(ctx, "", transfer.ID, lots, tx); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := s.addLedgerEntryTx(ctx, transfer.LedgerEntry(""), tx); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := tx.GetContext(ctx, &transfer, "SELECT "+transferColumns+" FROM "+transferTables+" WHERE t.id = ?1", transfer.ID); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Transfer{}, err
+	}
+	return transfer, nil
+}
+
+func (s *Storage) GetTransfer(ctx context.Context, id uint) (transfer model.Transfer, err error) {
+	err = s.db.GetContext(ctx, &transfer, "SELECT "+transferColumns+" FROM "+transferTables+" WHERE t.id = ?1", id)
+	return
+}
+
+// GetTransfersByUserID returns the transfers sent and received by the user, the latest first.
+func (s *Storage) GetTransfersByUserID(ctx context.Context, userID uint) (transfers []model.Transfer, err error) {
+	err = s.db.SelectContext(ctx, &transfers, "SELECT "+transferColumns+" FROM "+transferTables+`
+		WHERE t.sender_id = ?1 OR t.recipient_id = ?1 ORDER BY t.created_at DESC, t.id DESC`, userID)
+	return
+}
+
+// SettleTransfer completes a pending transfer, crediting the recipient, or declines or cancels it, returning
+// the points to the sender. It fails with apperrors.ErrTransferNotPending if the transfer is settled already.
+func (s *Storage) SettleTransfer(ctx context.Context, id uint, status model.TransferStatus) (model.Transfer, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	defer tx.Rollback() //nolint:all
+	var transfer model.Transfer
+	if err := tx.GetContext(ctx, &transfer, "SELECT "+transferColumns+" FROM "+transferTables+" WHERE t.id = ?1", id); err != nil {
+		return model.Transfer{}, err
+	}
+	if transfer.Status != model.TransferStatusPending {
+		return model.Transfer{}, apperrors.ErrTransferNotPending
+	}
+	settledAt := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE transfers SET status = ?1, settled_at = ?2 WHERE id = ?3", status, settledAt, id); err != nil {
+		return model.Transfer{}, err
+	}
+	transfer.Status = status
+	transfer.SettledAt = &settledAt
+	entry := transfer.LedgerEntry(model.TransferStatusPending)
+	userID := transfer.SenderID
+	if status == model.TransferStatusCompleted {
+		userID = transfer.RecipientID
+	}
+	lots, err := s.releasePointLotsTx(ctx, "", transfer.ID, tx)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if _, err := s.moveUserBalanceTx(ctx, userID, transfer.Amount, lots, tx); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := s.addLedgerEntryTx(ctx, entry, tx); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return model.Transfer{}, err
+	}
+	return transfer, nil
+}
+
+// GetTransactions returns the ledger entries of the user matching the filter, the latest first.
+func (s *Storage) GetTransactions(ctx context.Context, filter model.TransactionFilter) (transactions []model.Transaction, err error) {
+	var after sql.NullTime
+	var afterID uint
+	if filter.After != nil {
+		after = sql.NullTime{Time: filter.After.CreatedAt.UTC(), Valid: true}
+		afterID = filter.After.ID
+	}
+	types := make([]string, len(filter.Types))
+	for i, t := range filter.Types {
+		types[i] = string(t)
+	}
+	err = s.db.SelectContext(ctx, &transactions, `SELECT l.id, l.entry_type,
+			CASE WHEN l.credit_account = ?1 THEN l.amount ELSE -l.amount END AS amount,
+			l.order_number, l.transfer_id, COALESCE(u.login, '') AS counterparty, l.created_at
+		FROM ledger_entries l
+		LEFT JOIN transfers t ON t.id = l.transfer_id
+		LEFT JOIN users u ON u.id = CASE WHEN t.sender_id = ?2 THEN t.recipient_id ELSE t.sender_id END
+		WHERE (l.credit_account = ?1 OR l.debit_account = ?1)
+			AND (?3 = '' OR instr(',' || ?3 || ',', ',' || l.entry_type || ',') > 0)
+			AND (?4 IS NULL OR l.created_at >= ?4)
+			AND (?5 IS NULL OR l.created_at < ?5)
+			AND (?6 IS NULL OR l.created_at < ?6 OR l.created_at = ?6 AND l.id < ?7)
+		ORDER BY l.created_at DESC, l.id DESC
+		LIMIT CASE WHEN ?8 > 0 THEN ?8 ELSE -1 END`,
+		model.UserAccount(filter.UserID), filter.UserID, strings.Join(types, ","),
+		nullTime(filter.From), nullTime(filter.To), after, afterID, filter.Limit)
+	return
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
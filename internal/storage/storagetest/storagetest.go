@@ -0,0 +1,1377 @@
+// Package storagetest is a conformance suite for service.Storage implementations.
+// Tests only rely on data they create themselves, so they can run against a shared database.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mrkovshik/yandex_diploma/internal/apperrors"
+	"github.com/mrkovshik/yandex_diploma/internal/model"
+	"github.com/mrkovshik/yandex_diploma/internal/service"
+)
+
+var seq atomic.Int64
+
+// unique returns a string that has not been returned before, neither in this nor in previous runs.
+func unique() string {
+	return fmt.Sprintf("%d%03d", time.Now().UnixNano(), seq.Add(1)%1000)
+}
+
+func Run(t *testing.T, newStorage func(t *testing.T) service.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s service.Storage)
+	}{
+		{"users", testUsers},
+		{"orders", testOrders},
+		{"finalize_order", testFinalizeOrder},
+		{"pending_bonuses", testPendingBonuses},
+		{"lease_orders", testLeaseOrders},
+		{"withdrawals", testWithdrawals},
+		{"concurrent_withdrawals", testConcurrentWithdrawals},
+		{"ledger", testLedger},
+		{"idempotency_keys", testIdempotencyKeys},
+		{"sessions", testSessions},
+		{"passwords", testPasswords},
+		{"login_attempts", testLoginAttempts},
+		{"totp", testTOTP},
+		{"balance_adjustments", testBalanceAdjustments},
+		{"withdrawal_reversals", testWithdrawalReversals},
+		{"order_clawbacks", testOrderClawbacks},
+		{"point_lots", testPointLots},
+		{"point_lot_moves", testPointLotMoves},
+		{"user_tiers", testUserTiers},
+		{"tier_bonuses", testTierBonuses},
+		{"referrals", testReferrals},
+		{"referral_clawbacks", testReferralClawbacks},
+		{"campaigns", testCampaigns},
+		{"transfers", testTransfers},
+		{"transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// NewUserWithBalance registers a user and credits balance through a processed order.
+func NewUserWithBalance(t *testing.T, s service.Storage, balance model.Amount) uint {
+	ctx := context.Background()
+	userID, err := s.AddUser(ctx, "user-"+unique(), "hash")
+	require.NoError(t, err)
+	if balance > 0 {
+		orderNumber := unique()
+		require.NoError(t, s.UploadOrder(ctx, userID, orderNumber))
+		require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, orderNumber, balance, 0))
+	}
+	return userID
+}
+
+func testUsers(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	login := "user-" + unique()
+	userID, err := s.AddUser(ctx, login, "hash")
+	require.NoError(t, err)
+
+	_, err = s.AddUser(ctx, login, "other")
+	assert.ErrorIs(t, err, apperrors.ErrUserAlreadyExists)
+
+	user, err := s.GetUserByLogin(ctx, login)
+	require.NoError(t, err)
+	assert.Equal(t, userID, user.ID)
+	assert.Equal(t, "hash", user.Password)
+	assert.Equal(t, model.RoleUser, user.Role)
+	assert.Equal(t, model.Amount(0), user.Balance)
+
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, login, user.Login)
+
+	_, err = s.GetUserByLogin(ctx, "user-"+unique())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, s.SetUserRole(ctx, userID, model.RoleSupport))
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleSupport, user.Role)
+	assert.ErrorIs(t, s.SetUserRole(ctx, userID+1000000, model.RoleAdmin), sql.ErrNoRows)
+}
+
+func testOrders(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	first, second := unique(), unique()
+	require.NoError(t, s.UploadOrder(ctx, userID, first))
+	require.NoError(t, s.UploadOrder(ctx, userID, second))
+	assert.ErrorIs(t, s.UploadOrder(ctx, NewUserWithBalance(t, s, 0), first), apperrors.ErrOrderAlreadyUploaded)
+
+	order, err := s.GetOrderByNumber(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, userID, order.UserID)
+	assert.Equal(t, model.OrderStateNew, order.Status)
+
+	require.NoError(t, s.SetOrderStatus(ctx, second, model.OrderStateInvalid))
+	orders, err := s.GetOrdersByUserID(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	statuses := map[string]model.OrderState{}
+	for _, o := range orders {
+		statuses[o.OrderNumber] = o.Status
+	}
+	assert.Equal(t, map[string]model.OrderState{first: model.OrderStateNew, second: model.OrderStateInvalid}, statuses)
+
+	_, err = s.GetOrderByNumber(ctx, unique())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testFinalizeOrder(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	orderNumber := unique()
+	require.NoError(t, s.UploadOrder(ctx, userID, orderNumber))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, orderNumber, 72998, 0))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, orderNumber, 72998, 0))
+
+	order, err := s.GetOrderByNumber(ctx, orderNumber)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStateProcessed, order.Status)
+	assert.Equal(t, model.Amount(72998), order.Accrual)
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(72998), user.Balance)
+}
+
+func testPendingBonuses(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	// orders finalized by other tests are pending too
+	for {
+		pending, err := s.GetOrdersWithPendingBonuses(ctx, 1000)
+		require.NoError(t, err)
+		if len(pending) == 0 {
+			break
+		}
+		for _, orderNumber := range pending {
+			require.NoError(t, s.ClearOrderBonusesPending(ctx, orderNumber))
+		}
+	}
+	userID := NewUserWithBalance(t, s, 0)
+	first, second, processing := unique(), unique(), unique()
+	for _, n := range []string{first, second, processing} {
+		require.NoError(t, s.UploadOrder(ctx, userID, n))
+	}
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, first, 100, 0))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, second, 100, 0))
+	require.NoError(t, s.SetOrderStatus(ctx, processing, model.OrderStateProcessing))
+
+	pending, err := s.GetOrdersWithPendingBonuses(ctx, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, pending)
+	pending, err = s.GetOrdersWithPendingBonuses(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, pending)
+
+	// finalizing an order again does not mark it pending once its bonuses are credited
+	require.NoError(t, s.ClearOrderBonusesPending(ctx, first))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, first, 100, 0))
+	pending, err = s.GetOrdersWithPendingBonuses(ctx, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []string{second}, pending)
+}
+
+func testLeaseOrders(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	pending, processing, processed := unique(), unique(), unique()
+	for _, n := range []string{pending, processing, processed} {
+		require.NoError(t, s.UploadOrder(ctx, userID, n))
+	}
+	require.NoError(t, s.SetOrderStatus(ctx, processing, model.OrderStateProcessing))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, processed, 100, 0))
+
+	leased, err := s.LeasePendingOrders(ctx, "first", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, leased, pending)
+	assert.Contains(t, leased, processing)
+	assert.NotContains(t, leased, processed)
+
+	// leased orders are not handed out twice
+	leased, err = s.LeasePendingOrders(ctx, "second", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, leased, pending)
+
+	// only the holder of the lease releases it
+	require.NoError(t, s.ReleaseOrder(ctx, pending, "second", 0))
+	leased, err = s.LeasePendingOrders(ctx, "second", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, leased, pending)
+
+	require.NoError(t, s.ReleaseOrder(ctx, pending, "first", 0))
+	require.NoError(t, s.ReleaseOrder(ctx, processing, "first", time.Hour))
+	leased, err = s.LeasePendingOrders(ctx, "second", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, leased, pending)
+	assert.NotContains(t, leased, processing)
+
+	// renewed leases are not handed out
+	_, err = s.LeasePendingOrders(ctx, "third", 1000, -time.Second)
+	require.NoError(t, err)
+	held, err := s.RenewOrderLeases(ctx, "second", time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, held, pending)
+	leased, err = s.LeasePendingOrders(ctx, "third", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, leased, pending)
+
+	// an expired lease is handed out again, and its former holder can neither renew nor release it
+	require.NoError(t, s.ReleaseOrder(ctx, pending, "second", 0))
+	_, err = s.LeasePendingOrders(ctx, "third", 1000, -time.Second)
+	require.NoError(t, err)
+	leased, err = s.LeasePendingOrders(ctx, "fourth", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, leased, pending)
+	held, err = s.RenewOrderLeases(ctx, "third", time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, held, pending)
+	require.NoError(t, s.ReleaseOrder(ctx, pending, "third", 0))
+	leased, err = s.LeasePendingOrders(ctx, "fifth", 1000, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, leased, pending)
+}
+
+func testWithdrawals(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 100000)
+	first := model.Withdrawal{Amount: 30000, OrderNumber: unique(), UserID: userID}
+	require.NoError(t, s.ProcessWithdrawal(ctx, first))
+	assert.ErrorIs(t, s.ProcessWithdrawal(ctx, first), apperrors.ErrWithdrawalAlreadyExists)
+	assert.ErrorIs(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 70001, OrderNumber: unique(), UserID: userID}), apperrors.ErrNotEnoughFunds)
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 55555, OrderNumber: unique(), UserID: userID}))
+
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(14445), user.Balance)
+	sum, err := s.GetWithdrawalsSumByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(85555), sum)
+	withdrawals, err := s.GetWithdrawalsByUserID(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 2)
+	assert.False(t, withdrawals[0].ProcessedAt.IsZero())
+	assert.Equal(t, model.WithdrawalStateProcessed, withdrawals[0].Status)
+	assert.Nil(t, withdrawals[0].ReversedAt)
+
+	sum, err = s.GetWithdrawalsSumByUserID(ctx, NewUserWithBalance(t, s, 0))
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), sum)
+}
+
+func testConcurrentWithdrawals(t *testing.T, s service.Storage) {
+	const (
+		workers  = 50
+		withdraw = model.Amount(1000)
+		balance  = model.Amount(10000)
+	)
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, balance)
+
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: withdraw, OrderNumber: unique(), UserID: userID})
+			if err != nil && !errors.Is(err, apperrors.ErrNotEnoughFunds) {
+				t.Error(err)
+				return
+			}
+			if err == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(balance/withdraw), succeeded.Load())
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), user.Balance)
+	withdrawn, err := s.GetWithdrawalsSumByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, balance, withdrawn)
+}
+
+func testLedger(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	before := time.Now().UTC().Add(-time.Second)
+	userID := NewUserWithBalance(t, s, 50000)
+	credited := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 20000, OrderNumber: unique(), UserID: userID}))
+
+	balance, err := s.GetBalanceAt(ctx, userID, before)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), balance)
+	balance, err = s.GetBalanceAt(ctx, userID, credited)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(50000), balance)
+	balance, err = s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(30000), balance)
+
+	discrepancies, err := s.GetBalanceDiscrepancies(ctx)
+	require.NoError(t, err)
+	for _, d := range discrepancies {
+		assert.NotEqual(t, userID, d.UserID)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	record := model.IdempotencyRecord{
+		UserID:      userID,
+		Key:         unique(),
+		RequestHash: "hash",
+		LockedUntil: time.Now().Add(time.Minute).UTC(),
+		ExpiresAt:   time.Now().Add(time.Hour).UTC(),
+	}
+	_, created, err := s.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	stored, created, err := s.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, 0, stored.StatusCode)
+
+	record.StatusCode = 202
+	record.ContentType = "application/json"
+	record.Body = []byte(`{}`)
+	require.NoError(t, s.SaveIdempotentResponse(ctx, record))
+	stored, created, err = s.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, 202, stored.StatusCode)
+	assert.Equal(t, "application/json", stored.ContentType)
+	assert.Equal(t, []byte(`{}`), stored.Body)
+	assert.Equal(t, "hash", stored.RequestHash)
+
+	require.NoError(t, s.DeleteIdempotencyKey(ctx, userID, record.Key))
+	_, created, err = s.ReserveIdempotencyKey(ctx, record)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// an expired key can be reserved again
+	expired := model.IdempotencyRecord{UserID: userID, Key: unique(), RequestHash: "old", ExpiresAt: time.Now().Add(-time.Minute).UTC()}
+	_, created, err = s.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	assert.True(t, created)
+	expired.RequestHash = "new"
+	expired.ExpiresAt = time.Now().Add(time.Hour).UTC()
+	stored, created, err = s.ReserveIdempotencyKey(ctx, expired)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "new", stored.RequestHash)
+
+	// a request that never finished releases the key once its lock is over
+	stale := model.IdempotencyRecord{UserID: userID, Key: unique(), RequestHash: "stale",
+		LockedUntil: time.Now().Add(-time.Second).UTC(), ExpiresAt: time.Now().Add(time.Hour).UTC()}
+	_, created, err = s.ReserveIdempotencyKey(ctx, stale)
+	require.NoError(t, err)
+	assert.True(t, created)
+	stale.RequestHash = "retry"
+	stale.LockedUntil = time.Now().Add(time.Minute).UTC()
+	_, created, err = s.ReserveIdempotencyKey(ctx, stale)
+	require.NoError(t, err)
+	assert.True(t, created)
+	stored, created, err = s.ReserveIdempotencyKey(ctx, stale)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "retry", stored.RequestHash)
+	require.NoError(t, s.DeleteExpiredIdempotencyKeys(ctx))
+}
+
+func testSessions(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	now := time.Now().UTC()
+	newSession := func() model.Session {
+		session := model.Session{ID: unique(), UserID: userID, RefreshTokenHash: "first", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		require.NoError(t, s.CreateSession(ctx, session))
+		return session
+	}
+	current, other := newSession(), newSession()
+
+	session, err := s.GetSession(ctx, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, session.UserID)
+	assert.True(t, session.Active(time.Now()))
+	_, err = s.GetSession(ctx, unique())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	rotated, err := s.RotateSession(ctx, current.ID, "first", "second", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, rotated)
+	// the old refresh token cannot be used again
+	rotated, err = s.RotateSession(ctx, current.ID, "first", "third", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	session, err = s.GetSession(ctx, current.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", session.RefreshTokenHash)
+	assert.WithinDuration(t, now.Add(2*time.Hour), session.ExpiresAt, time.Second)
+
+	require.NoError(t, s.RevokeUserSessions(ctx, userID, current.ID))
+	session, err = s.GetSession(ctx, other.ID)
+	require.NoError(t, err)
+	assert.False(t, session.Active(time.Now()))
+	session, err = s.GetSession(ctx, current.ID)
+	require.NoError(t, err)
+	assert.True(t, session.Active(time.Now()))
+
+	require.NoError(t, s.RevokeSession(ctx, current.ID))
+	session, err = s.GetSession(ctx, current.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+	rotated, err = s.RotateSession(ctx, current.ID, "second", "third", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	third := newSession()
+	require.NoError(t, s.RevokeUserSessions(ctx, userID, ""))
+	session, err = s.GetSession(ctx, third.ID)
+	require.NoError(t, err)
+	assert.False(t, session.Active(time.Now()))
+}
+
+func testPasswords(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	require.NoError(t, s.UpdateUserPassword(ctx, userID, "changed"))
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", user.Password)
+
+	now := time.Now().UTC()
+	newToken := func(expiresAt time.Time) string {
+		hash := unique()
+		require.NoError(t, s.CreatePasswordResetToken(ctx, model.PasswordResetToken{TokenHash: hash, UserID: userID, CreatedAt: now, ExpiresAt: expiresAt}))
+		return hash
+	}
+	first, second, expired := newToken(now.Add(time.Hour)), newToken(now.Add(time.Hour)), newToken(now.Add(-time.Second))
+
+	_, err = s.ResetPassword(ctx, expired, "expired")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidResetToken)
+	_, err = s.ResetPassword(ctx, unique(), "unknown")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidResetToken)
+
+	resetUserID, err := s.ResetPassword(ctx, first, "reset")
+	require.NoError(t, err)
+	assert.Equal(t, userID, resetUserID)
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "reset", user.Password)
+
+	// tokens are single-use and a reset invalidates the other tokens of the user
+	_, err = s.ResetPassword(ctx, first, "again")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidResetToken)
+	_, err = s.ResetPassword(ctx, second, "again")
+	assert.ErrorIs(t, err, apperrors.ErrInvalidResetToken)
+}
+
+func testLoginAttempts(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	key := model.LoginThrottleKey(unique())
+	until, err := s.GetLoginBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	failures, previous, err := s.RecordLoginFailure(ctx, key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+	assert.True(t, previous.IsZero())
+	for i := 2; i <= 3; i++ {
+		failures, previous, err = s.RecordLoginFailure(ctx, key, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, i, failures)
+		assert.WithinDuration(t, time.Now(), previous, time.Second)
+	}
+	// a forgotten failure is taken back from the counter
+	require.NoError(t, s.ForgetLoginFailure(ctx, key))
+	failures, _, err = s.RecordLoginFailure(ctx, key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	// failures older than the window are forgotten
+	time.Sleep(10 * time.Millisecond)
+	failures, _, err = s.RecordLoginFailure(ctx, key, 5*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	blockedUntil := time.Now().Add(time.Hour).UTC()
+	require.NoError(t, s.BlockLogin(ctx, key, blockedUntil))
+	// a shorter block does not shorten the current one
+	require.NoError(t, s.BlockLogin(ctx, key, time.Now().Add(time.Minute)))
+	until, err = s.GetLoginBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.WithinDuration(t, blockedUntil, until, time.Second)
+
+	require.NoError(t, s.ResetLoginAttempts(ctx, key))
+	until, err = s.GetLoginBlockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+	failures, _, err = s.RecordLoginFailure(ctx, key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+}
+
+func testTOTP(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	_, err := s.GetTOTP(ctx, userID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// the secret can be replaced until it is confirmed
+	require.NoError(t, s.SaveTOTPSecret(ctx, userID, "first"))
+	require.NoError(t, s.SaveTOTPSecret(ctx, userID, "second"))
+	totp, err := s.GetTOTP(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", totp.Secret)
+	assert.False(t, totp.Enabled())
+
+	require.NoError(t, s.EnableTOTP(ctx, userID, 100, []string{"code1", "code2"}))
+	assert.ErrorIs(t, s.EnableTOTP(ctx, userID, 101, nil), apperrors.ErrTOTPAlreadyEnabled)
+	assert.ErrorIs(t, s.SaveTOTPSecret(ctx, userID, "third"), apperrors.ErrTOTPAlreadyEnabled)
+	totp, err = s.GetTOTP(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "second", totp.Secret)
+	assert.True(t, totp.Enabled())
+	assert.Equal(t, int64(100), totp.LastUsedStep)
+
+	// codes can not be replayed
+	for step, want := range map[int64]bool{100: false, 99: false, 101: true} {
+		used, err := s.UseTOTPStep(ctx, userID, step)
+		require.NoError(t, err)
+		assert.Equal(t, want, used, step)
+	}
+	used, err := s.UseRecoveryCode(ctx, userID, "code1")
+	require.NoError(t, err)
+	assert.True(t, used)
+	used, err = s.UseRecoveryCode(ctx, userID, "code1")
+	require.NoError(t, err)
+	assert.False(t, used)
+	used, err = s.UseRecoveryCode(ctx, NewUserWithBalance(t, s, 0), "code2")
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	require.NoError(t, s.DeleteTOTP(ctx, userID))
+	_, err = s.GetTOTP(ctx, userID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	used, err = s.UseRecoveryCode(ctx, userID, "code2")
+	require.NoError(t, err)
+	assert.False(t, used)
+}
+
+func testBalanceAdjustments(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 1000)
+	operatorID := NewUserWithBalance(t, s, 0)
+
+	credit, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: 500, Reason: "compensation"})
+	require.NoError(t, err)
+	assert.NotZero(t, credit.ID)
+	assert.False(t, credit.CreatedAt.IsZero())
+	debit, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: -1200, Reason: "wrong accrual"})
+	require.NoError(t, err)
+	_, err = s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: -301, Reason: "too much"})
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+	_, err = s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID + 1000000, OperatorID: operatorID, Amount: 1, Reason: "nobody"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(300), user.Balance)
+	balance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(300), balance)
+
+	adjustments, err := s.GetBalanceAdjustments(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, adjustments, 2)
+	assert.Equal(t, credit.ID, adjustments[0].ID)
+	assert.Equal(t, debit.ID, adjustments[1].ID)
+	assert.Equal(t, model.Amount(-1200), adjustments[1].Amount)
+	assert.Equal(t, "wrong accrual", adjustments[1].Reason)
+	assert.Equal(t, operatorID, adjustments[1].OperatorID)
+}
+
+func testWithdrawalReversals(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 10000)
+	order := unique()
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 7000, OrderNumber: order, UserID: userID}))
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: unique(), UserID: userID}))
+
+	reversed, err := s.ReverseWithdrawal(ctx, order)
+	require.NoError(t, err)
+	assert.Equal(t, userID, reversed.UserID)
+	assert.Equal(t, model.Amount(7000), reversed.Amount)
+	assert.Equal(t, model.WithdrawalStateReversed, reversed.Status)
+	require.NotNil(t, reversed.ReversedAt)
+	_, err = s.ReverseWithdrawal(ctx, order)
+	assert.ErrorIs(t, err, apperrors.ErrWithdrawalAlreadyReversed)
+	_, err = s.ReverseWithdrawal(ctx, unique())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(9000), user.Balance)
+	balance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(9000), balance)
+	sum, err := s.GetWithdrawalsSumByUserID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(1000), sum)
+	withdrawals, err := s.GetWithdrawalsByUserID(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 2)
+	for _, w := range withdrawals {
+		if w.OrderNumber == order {
+			assert.Equal(t, model.WithdrawalStateReversed, w.Status)
+			require.NotNil(t, w.ReversedAt)
+			assert.WithinDuration(t, *reversed.ReversedAt, *w.ReversedAt, time.Second)
+		} else {
+			assert.Equal(t, model.WithdrawalStateProcessed, w.Status)
+		}
+	}
+	// a reversed order can not be paid with points again
+	assert.ErrorIs(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: order, UserID: userID}), apperrors.ErrWithdrawalAlreadyExists)
+}
+
+func testOrderClawbacks(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID, err := s.AddUser(ctx, "user-"+unique(), "hash")
+	require.NoError(t, err)
+	first, second, pending := unique(), unique(), unique()
+	for _, number := range []string{first, second, pending} {
+		require.NoError(t, s.UploadOrder(ctx, userID, number))
+	}
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, first, 5000, 0))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, second, 3000, 0))
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 4000, OrderNumber: unique(), UserID: userID}))
+
+	order, err := s.ClawbackOrder(ctx, second, false)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStateReversed, order.Status)
+	assert.Equal(t, model.Amount(3000), order.Accrual)
+	assert.Equal(t, userID, order.UserID)
+	_, err = s.ClawbackOrder(ctx, second, false)
+	assert.ErrorIs(t, err, apperrors.ErrOrderAlreadyReversed)
+	_, err = s.ClawbackOrder(ctx, pending, false)
+	assert.ErrorIs(t, err, apperrors.ErrOrderNotProcessed)
+	_, err = s.ClawbackOrder(ctx, unique(), false)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// a stale worker can neither reopen nor credit a reversed order
+	require.NoError(t, s.SetOrderStatus(ctx, second, model.OrderStateProcessing))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, second, 3000, 0))
+	order, err = s.GetOrderByNumber(ctx, second)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStateReversed, order.Status)
+
+	// 1000 points are left, the first order's 5000 can only be taken back as a debt
+	_, err = s.ClawbackOrder(ctx, first, false)
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+	order, err = s.GetOrderByNumber(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStateProcessed, order.Status)
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(1000), user.Balance)
+	assert.Equal(t, model.Amount(0), user.Debt)
+	_, err = s.ClawbackOrder(ctx, first, true)
+	require.NoError(t, err)
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), user.Balance)
+	assert.Equal(t, model.Amount(4000), user.Debt)
+
+	// the debt blocks withdrawals, accruals pay it off
+	err = s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 100, OrderNumber: unique(), UserID: userID})
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, pending, 4500, 0))
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(500), user.Balance)
+	assert.Equal(t, model.Amount(0), user.Debt)
+
+	orders, err := s.GetOrdersByUserID(ctx, userID)
+	require.NoError(t, err)
+	statuses := make(map[string]model.OrderState)
+	for _, o := range orders {
+		statuses[o.OrderNumber] = o.Status
+	}
+	assert.Equal(t, map[string]model.OrderState{
+		first:   model.OrderStateReversed,
+		second:  model.OrderStateReversed,
+		pending: model.OrderStateProcessed,
+	}, statuses)
+	balance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(500), balance)
+	discrepancies, err := s.GetBalanceDiscrepancies(ctx)
+	require.NoError(t, err)
+	for _, d := range discrepancies {
+		assert.NotEqual(t, userID, d.UserID)
+	}
+}
+
+func testPointLots(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 5000)
+	operatorID := NewUserWithBalance(t, s, 0)
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	_, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: 2000, Reason: "test"})
+	require.NoError(t, err)
+	// the oldest lot pays for the withdrawal
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: unique(), UserID: userID}))
+
+	lots, err := s.GetPointLots(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, lots, 2)
+	assert.Equal(t, model.Amount(5000), lots[0].Amount)
+	assert.Equal(t, model.Amount(4000), lots[0].Remaining)
+	assert.Equal(t, model.Amount(2000), lots[1].Remaining)
+	lots, err = s.GetPointLots(ctx, userID, cutoff)
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, model.Amount(4000), lots[0].Remaining)
+
+	userIDs, err := s.GetUsersWithExpiredPoints(ctx, cutoff, 0, 1000)
+	require.NoError(t, err)
+	assert.Contains(t, userIDs, userID)
+	userIDs, err = s.GetUsersWithExpiredPoints(ctx, cutoff, userID, 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, userIDs, userID)
+	expired, err := s.ExpirePoints(ctx, userID, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(4000), expired)
+	expired, err = s.ExpirePoints(ctx, userID, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), expired)
+	userIDs, err = s.GetUsersWithExpiredPoints(ctx, cutoff, 0, 1000)
+	require.NoError(t, err)
+	assert.NotContains(t, userIDs, userID)
+
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(2000), user.Balance)
+	balance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(2000), balance)
+	lots, err = s.GetPointLots(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, model.Amount(2000), lots[0].Remaining)
+
+	// a debt is paid off before a new lot is opened
+	order := unique()
+	require.NoError(t, s.UploadOrder(ctx, userID, order))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, order, 3000, 0))
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 4000, OrderNumber: unique(), UserID: userID}))
+	_, err = s.ClawbackOrder(ctx, order, true)
+	require.NoError(t, err)
+	lots, err = s.GetPointLots(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Empty(t, lots)
+	_, err = s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: 2500, Reason: "test"})
+	require.NoError(t, err)
+	lots, err = s.GetPointLots(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, lots, 1)
+	assert.Equal(t, model.Amount(500), lots[0].Amount)
+	assert.Equal(t, model.Amount(500), lots[0].Remaining)
+}
+
+func testPointLotMoves(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	senderID := NewUserWithBalance(t, s, 5000)
+	ownerID := NewUserWithBalance(t, s, 3000)
+	recipientID := NewUserWithBalance(t, s, 0)
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	_, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: senderID, OperatorID: ownerID, Amount: 2000, Reason: "test"})
+	require.NoError(t, err)
+	accruedBefore := func(userID uint, at time.Time) model.Amount {
+		lots, err := s.GetPointLots(ctx, userID, at)
+		require.NoError(t, err)
+		var sum model.Amount
+		for _, lot := range lots {
+			sum += lot.Remaining
+		}
+		return sum
+	}
+
+	// a transfer does not extend the expiry of the points, splitting the lots they come from
+	_, err = s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 6000,
+		Status: model.TransferStatusCompleted}, model.TransferLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(5000), accruedBefore(recipientID, cutoff))
+	assert.Equal(t, model.Amount(6000), accruedBefore(recipientID, time.Now().UTC()))
+	assert.Equal(t, model.Amount(1000), accruedBefore(senderID, time.Now().UTC()))
+
+	// nor do points returned by a declined transfer or a reversed withdrawal, or held by a pending transfer
+	declined, err := s.CreateTransfer(ctx, model.Transfer{SenderID: ownerID, RecipientID: recipientID, Amount: 1000,
+		Status: model.TransferStatusPending}, model.TransferLimits{})
+	require.NoError(t, err)
+	_, err = s.SettleTransfer(ctx, declined.ID, model.TransferStatusDeclined)
+	require.NoError(t, err)
+	withdrawal := unique()
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: withdrawal, UserID: ownerID}))
+	_, err = s.ReverseWithdrawal(ctx, withdrawal)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(3000), accruedBefore(ownerID, cutoff))
+	completed, err := s.CreateTransfer(ctx, model.Transfer{SenderID: ownerID, RecipientID: recipientID, Amount: 500,
+		Status: model.TransferStatusPending}, model.TransferLimits{})
+	require.NoError(t, err)
+	_, err = s.SettleTransfer(ctx, completed.ID, model.TransferStatusCompleted)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(2500), accruedBefore(ownerID, cutoff))
+
+	expired, err := s.ExpirePoints(ctx, recipientID, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(5500), expired)
+	user, err := s.GetUserByID(ctx, recipientID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(1000), user.Balance)
+}
+
+func testUserTiers(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	since := time.Now().UTC().Add(-time.Second)
+	userID := NewUserWithBalance(t, s, 5000)
+	order := unique()
+	require.NoError(t, s.UploadOrder(ctx, userID, order))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, order, 3000, 0))
+	_, err := s.ClawbackOrder(ctx, order, false)
+	require.NoError(t, err)
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: unique(), UserID: userID}))
+
+	turnoverOf := func(account string, since time.Time) (model.Amount, bool) {
+		turnover, err := s.GetUserTurnover(ctx, account, since)
+		require.NoError(t, err)
+		for _, tt := range turnover {
+			if tt.UserID == userID {
+				return tt.Amount, true
+			}
+		}
+		return 0, false
+	}
+	accrued, ok := turnoverOf(model.SystemAccountAccruals, since)
+	assert.True(t, ok)
+	assert.Equal(t, model.Amount(5000), accrued)
+	withdrawn, ok := turnoverOf(model.SystemAccountWithdrawals, since)
+	assert.True(t, ok)
+	assert.Equal(t, model.Amount(-1000), withdrawn)
+	_, ok = turnoverOf(model.SystemAccountAccruals, time.Now().UTC().Add(time.Hour))
+	assert.False(t, ok)
+
+	_, err = s.GetUserTier(ctx, userID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	tier := model.UserTier{UserID: userID, Tier: model.TierGold, Points: 5000, UpdatedAt: time.Now().UTC()}
+	require.NoError(t, s.ReplaceUserTiers(ctx, []model.UserTier{tier}))
+	got, err := s.GetUserTier(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, tier.Tier, got.Tier)
+	assert.Equal(t, tier.Points, got.Points)
+	assert.WithinDuration(t, tier.UpdatedAt, got.UpdatedAt, time.Millisecond)
+	require.NoError(t, s.ReplaceUserTiers(ctx, nil))
+	_, err = s.GetUserTier(ctx, userID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testTierBonuses(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	since := time.Now().UTC().Add(-time.Second)
+	userID := NewUserWithBalance(t, s, 0)
+	order := unique()
+	require.NoError(t, s.UploadOrder(ctx, userID, order))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, order, 3000, 300))
+	processed, err := s.GetOrderByNumber(ctx, order)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(3000), processed.Accrual)
+	assert.Equal(t, model.Amount(300), processed.TierBonus)
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(3300), user.Balance)
+	transactions, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID, Types: []model.LedgerEntryType{model.LedgerEntryTier}})
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, model.Amount(300), transactions[0].Amount)
+	assert.Equal(t, order, transactions[0].OrderNumber)
+	// the bonus does not count as accrued points
+	turnover, err := s.GetUserTurnover(ctx, model.SystemAccountAccruals, since)
+	require.NoError(t, err)
+	for _, tt := range turnover {
+		if tt.UserID == userID {
+			assert.Equal(t, model.Amount(3000), tt.Amount)
+		}
+	}
+
+	// a clawback takes the bonus back too
+	_, err = s.ClawbackOrder(ctx, order, false)
+	require.NoError(t, err)
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), user.Balance)
+	balance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(0), balance)
+}
+
+func testReferrals(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	referrerID := NewUserWithBalance(t, s, 0)
+	code := unique()
+	stored, err := s.EnsureReferralCode(ctx, referrerID, code)
+	require.NoError(t, err)
+	assert.Equal(t, code, stored)
+	stored, err = s.EnsureReferralCode(ctx, referrerID, unique())
+	require.NoError(t, err)
+	assert.Equal(t, code, stored)
+	userID, err := s.GetUserIDByReferralCode(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, referrerID, userID)
+	_, err = s.GetUserIDByReferralCode(ctx, unique())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	login := "user-" + unique()
+	referredID, err := s.AddUser(ctx, login, "hash")
+	require.NoError(t, err)
+	rejectedID := NewUserWithBalance(t, s, 0)
+	require.NoError(t, s.AddReferral(ctx, model.Referral{ReferredID: referredID, ReferrerID: referrerID}))
+	require.NoError(t, s.AddReferral(ctx, model.Referral{ReferredID: rejectedID, ReferrerID: referrerID}))
+	referral, err := s.GetReferral(ctx, referredID)
+	require.NoError(t, err)
+	assert.Equal(t, referrerID, referral.ReferrerID)
+	assert.Equal(t, login, referral.ReferredLogin)
+	assert.Equal(t, model.ReferralStatusPending, referral.Status)
+	assert.Nil(t, referral.SettledAt)
+	_, err = s.GetReferral(ctx, referrerID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	order, rejectedOrder := unique(), unique()
+	require.NoError(t, s.UploadOrder(ctx, referredID, order))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, order, 1000, 0))
+	require.NoError(t, s.UploadOrder(ctx, rejectedID, rejectedOrder))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, rejectedOrder, 1000, 0))
+	referral.OrderNumber = order
+	referral.ReferrerBonus = 10000
+	referral.RefereeBonus = 5000
+	credited, err := s.CreditReferral(ctx, referral, 1)
+	require.NoError(t, err)
+	assert.True(t, credited)
+	credited, err = s.CreditReferral(ctx, referral, 1)
+	require.NoError(t, err)
+	assert.False(t, credited)
+	// the referrer has used up the limit
+	_, err = s.CreditReferral(ctx, model.Referral{ReferredID: rejectedID, ReferrerID: referrerID, OrderNumber: rejectedOrder,
+		ReferrerBonus: 10000, RefereeBonus: 5000}, 1)
+	assert.ErrorIs(t, err, apperrors.ErrReferralLimit)
+	require.NoError(t, s.RejectReferral(ctx, referredID, "test"))
+	require.NoError(t, s.RejectReferral(ctx, rejectedID, "test"))
+
+	referrals, err := s.GetReferralsByReferrer(ctx, referrerID)
+	require.NoError(t, err)
+	require.Len(t, referrals, 2)
+	assert.Equal(t, referredID, referrals[0].ReferredID)
+	assert.Equal(t, model.ReferralStatusCredited, referrals[0].Status)
+	assert.Equal(t, order, referrals[0].OrderNumber)
+	assert.Equal(t, model.Amount(10000), referrals[0].ReferrerBonus)
+	assert.Equal(t, model.Amount(5000), referrals[0].RefereeBonus)
+	require.NotNil(t, referrals[0].SettledAt)
+	assert.Equal(t, model.ReferralStatusRejected, referrals[1].Status)
+	assert.Equal(t, "test", referrals[1].RejectReason)
+
+	for userID, balance := range map[uint]model.Amount{referrerID: 10000, referredID: 6000, rejectedID: 1000} {
+		user, err := s.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, balance, user.Balance)
+		ledgerBalance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, balance, ledgerBalance)
+	}
+}
+
+func testReferralClawbacks(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	referrerID := NewUserWithBalance(t, s, 0)
+	referredID := NewUserWithBalance(t, s, 0)
+	require.NoError(t, s.AddReferral(ctx, model.Referral{ReferredID: referredID, ReferrerID: referrerID}))
+	order := unique()
+	require.NoError(t, s.UploadOrder(ctx, referredID, order))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, order, 5000, 0))
+	credited, err := s.CreditReferral(ctx, model.Referral{ReferredID: referredID, ReferrerID: referrerID, OrderNumber: order,
+		ReferrerBonus: 1000, RefereeBonus: 500}, 0)
+	require.NoError(t, err)
+	require.True(t, credited)
+	require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 1000, OrderNumber: unique(), UserID: referrerID}))
+	referralStatus := func() model.ReferralStatus {
+		referral, err := s.GetReferral(ctx, referredID)
+		require.NoError(t, err)
+		return referral.Status
+	}
+
+	// the referrer has spent the bonus, so nothing is taken back unless a debt is allowed
+	_, err = s.ClawbackOrder(ctx, order, false)
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+	assert.Equal(t, model.ReferralStatusCredited, referralStatus())
+	user, err := s.GetUserByID(ctx, referredID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(5500), user.Balance)
+
+	_, err = s.ClawbackOrder(ctx, order, true)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReferralStatusReversed, referralStatus())
+	for userID, want := range map[uint]model.User{
+		referrerID: {Balance: 0, Debt: 1000},
+		referredID: {Balance: 0, Debt: 0},
+	} {
+		user, err := s.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, want.Balance, user.Balance)
+		assert.Equal(t, want.Debt, user.Debt)
+	}
+	transactions, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: referrerID})
+	require.NoError(t, err)
+	require.NotEmpty(t, transactions)
+	assert.Equal(t, model.LedgerEntryReversal, transactions[0].Type)
+	assert.Equal(t, model.Amount(-1000), transactions[0].Amount)
+	assert.Equal(t, order, transactions[0].OrderNumber)
+
+	_, err = s.ClawbackOrder(ctx, order, true)
+	assert.ErrorIs(t, err, apperrors.ErrOrderAlreadyReversed)
+
+	// a referral is not credited with an order clawed back before it, e.g. by a retry
+	lateID := NewUserWithBalance(t, s, 0)
+	require.NoError(t, s.AddReferral(ctx, model.Referral{ReferredID: lateID, ReferrerID: referrerID}))
+	lateOrder := unique()
+	require.NoError(t, s.UploadOrder(ctx, lateID, lateOrder))
+	require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, lateOrder, 5000, 0))
+	_, err = s.ClawbackOrder(ctx, lateOrder, false)
+	require.NoError(t, err)
+	credited, err = s.CreditReferral(ctx, model.Referral{ReferredID: lateID, ReferrerID: referrerID, OrderNumber: lateOrder,
+		ReferrerBonus: 1000, RefereeBonus: 500}, 0)
+	require.NoError(t, err)
+	assert.False(t, credited)
+	referral, err := s.GetReferral(ctx, lateID)
+	require.NoError(t, err)
+	assert.Equal(t, model.ReferralStatusPending, referral.Status)
+	for userID, balance := range map[uint]model.Amount{referrerID: 0, lateID: 0} {
+		user, err := s.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, balance, user.Balance)
+	}
+
+	discrepancies, err := s.GetBalanceDiscrepancies(ctx)
+	require.NoError(t, err)
+	for _, d := range discrepancies {
+		assert.NotContains(t, []uint{referrerID, referredID, lateID}, d.UserID)
+	}
+}
+
+func testCampaigns(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 0)
+	adminID := NewUserWithBalance(t, s, 0)
+	now := time.Now().UTC().Truncate(time.Second)
+	campaign, err := s.AddCampaign(ctx, model.Campaign{
+		Name:         "campaign-" + unique(),
+		StartsAt:     now.Add(-time.Hour),
+		EndsAt:       now.Add(time.Hour),
+		BonusPercent: 1000,
+		BonusPoints:  500,
+		Tiers:        model.Tiers{model.TierSilver, model.TierGold},
+		UserIDs:      []uint{userID},
+		PerUserCap:   1500,
+		CreatedBy:    adminID,
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, campaign.ID)
+	future, err := s.AddCampaign(ctx, model.Campaign{
+		Name:        "campaign-" + unique(),
+		StartsAt:    now.Add(2 * time.Hour),
+		EndsAt:      now.Add(3 * time.Hour),
+		BonusPoints: 100,
+		CreatedBy:   adminID,
+	})
+	require.NoError(t, err)
+
+	stored, err := s.GetCampaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, campaign.Name, stored.Name)
+	assert.True(t, campaign.StartsAt.Equal(stored.StartsAt))
+	assert.True(t, campaign.EndsAt.Equal(stored.EndsAt))
+	assert.Equal(t, model.Amount(1000), stored.BonusPercent)
+	assert.Equal(t, model.Amount(500), stored.BonusPoints)
+	assert.Equal(t, model.Tiers{model.TierSilver, model.TierGold}, stored.Tiers)
+	assert.Equal(t, []uint{userID}, stored.UserIDs)
+	assert.Equal(t, model.Amount(1500), stored.PerUserCap)
+	assert.Equal(t, adminID, stored.CreatedBy)
+	stored, err = s.GetCampaign(ctx, future.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Tiers)
+	assert.Empty(t, stored.UserIDs)
+	_, err = s.GetCampaign(ctx, future.ID+1000000)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	campaigns, err := s.GetCampaigns(ctx)
+	require.NoError(t, err)
+	assert.Subset(t, campaignIDs(campaigns), []uint{campaign.ID, future.ID})
+	campaigns, err = s.GetActiveCampaigns(ctx, now)
+	require.NoError(t, err)
+	assert.Contains(t, campaignIDs(campaigns), campaign.ID)
+	assert.NotContains(t, campaignIDs(campaigns), future.ID)
+
+	first, second, third := unique(), unique(), unique()
+	for _, number := range []string{first, second, third} {
+		require.NoError(t, s.UploadOrder(ctx, userID, number))
+		require.NoError(t, s.FinalizeOrderAndUpdateBalance(ctx, number, 2000, 0))
+	}
+	bonus := model.CampaignBonus{CampaignID: campaign.ID, UserID: userID, OrderNumber: first, Amount: 1000}
+	credited, err := s.AddCampaignBonus(ctx, bonus, campaign.PerUserCap)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(1000), credited)
+	credited, err = s.AddCampaignBonus(ctx, bonus, campaign.PerUserCap)
+	require.NoError(t, err)
+	assert.Zero(t, credited)
+	// the cap leaves only 500 for the second order and nothing for the third one
+	bonus.OrderNumber = second
+	credited, err = s.AddCampaignBonus(ctx, bonus, campaign.PerUserCap)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(500), credited)
+	bonus.OrderNumber = third
+	credited, err = s.AddCampaignBonus(ctx, bonus, campaign.PerUserCap)
+	require.NoError(t, err)
+	assert.Zero(t, credited)
+	stored, err = s.GetCampaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(1500), stored.Granted)
+
+	// a clawback takes the campaign bonus of the order back together with the accrual
+	_, err = s.ClawbackOrder(ctx, first, false)
+	require.NoError(t, err)
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(4500), user.Balance)
+	ledgerBalance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(4500), ledgerBalance)
+	// nor is a bonus credited for an order clawed back before it, e.g. by a retry
+	_, err = s.ClawbackOrder(ctx, third, false)
+	require.NoError(t, err)
+	credited, err = s.AddCampaignBonus(ctx, model.CampaignBonus{CampaignID: future.ID, UserID: userID, OrderNumber: third, Amount: 100}, 0)
+	require.NoError(t, err)
+	assert.Zero(t, credited)
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Amount(2500), user.Balance)
+	stored, err = s.GetCampaign(ctx, future.ID)
+	require.NoError(t, err)
+	assert.Zero(t, stored.Granted)
+
+	ended, err := s.EndCampaign(ctx, campaign.ID, now)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(ended.EndsAt))
+	campaigns, err = s.GetActiveCampaigns(ctx, now)
+	require.NoError(t, err)
+	assert.NotContains(t, campaignIDs(campaigns), campaign.ID)
+	// a campaign that has not started yet ends at its start
+	ended, err = s.EndCampaign(ctx, future.ID, now)
+	require.NoError(t, err)
+	assert.True(t, future.StartsAt.Equal(ended.EndsAt))
+	_, err = s.EndCampaign(ctx, future.ID+1000000, now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func campaignIDs(campaigns []model.Campaign) []uint {
+	var ids []uint
+	for _, c := range campaigns {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func testTransfers(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	senderID := NewUserWithBalance(t, s, 10000)
+	recipientID := NewUserWithBalance(t, s, 0)
+	sender, err := s.GetUserByID(ctx, senderID)
+	require.NoError(t, err)
+	recipient, err := s.GetUserByID(ctx, recipientID)
+	require.NoError(t, err)
+	limits := model.TransferLimits{Since: time.Now().Add(-time.Hour), Amount: 6000, Count: 3}
+
+	direct, err := s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 3000,
+		Comment: "lunch", Status: model.TransferStatusCompleted}, limits)
+	require.NoError(t, err)
+	assert.NotZero(t, direct.ID)
+	assert.Equal(t, sender.Login, direct.SenderLogin)
+	assert.Equal(t, recipient.Login, direct.RecipientLogin)
+	assert.Equal(t, "lunch", direct.Comment)
+	assert.Equal(t, model.TransferStatusCompleted, direct.Status)
+	assert.NotNil(t, direct.SettledAt)
+	declined, err := s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 2000,
+		Status: model.TransferStatusPending}, limits)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusPending, declined.Status)
+	assert.Nil(t, declined.SettledAt)
+
+	_, err = s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 2000,
+		Status: model.TransferStatusCompleted}, limits)
+	assert.ErrorIs(t, err, apperrors.ErrTransferLimitExceeded)
+	_, err = s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 100,
+		Status: model.TransferStatusCompleted}, model.TransferLimits{Since: limits.Since, Count: 2})
+	assert.ErrorIs(t, err, apperrors.ErrTransferLimitExceeded)
+	_, err = s.CreateTransfer(ctx, model.Transfer{SenderID: recipientID, RecipientID: senderID, Amount: 5000,
+		Status: model.TransferStatusCompleted}, limits)
+	assert.ErrorIs(t, err, apperrors.ErrNotEnoughFunds)
+
+	// a declined transfer returns to the sender and no longer counts towards the limits
+	settled, err := s.SettleTransfer(ctx, declined.ID, model.TransferStatusDeclined)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusDeclined, settled.Status)
+	assert.NotNil(t, settled.SettledAt)
+	_, err = s.SettleTransfer(ctx, declined.ID, model.TransferStatusCompleted)
+	assert.ErrorIs(t, err, apperrors.ErrTransferNotPending)
+	accepted, err := s.CreateTransfer(ctx, model.Transfer{SenderID: senderID, RecipientID: recipientID, Amount: 1000,
+		Status: model.TransferStatusPending}, limits)
+	require.NoError(t, err)
+	_, err = s.SettleTransfer(ctx, accepted.ID, model.TransferStatusCompleted)
+	require.NoError(t, err)
+	_, err = s.GetTransfer(ctx, accepted.ID+1000000)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.SettleTransfer(ctx, accepted.ID+1000000, model.TransferStatusCompleted)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	transfer, err := s.GetTransfer(ctx, accepted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TransferStatusCompleted, transfer.Status)
+	transfers, err := s.GetTransfersByUserID(ctx, recipientID)
+	require.NoError(t, err)
+	require.Len(t, transfers, 3)
+	assert.Equal(t, []uint{accepted.ID, declined.ID, direct.ID}, []uint{transfers[0].ID, transfers[1].ID, transfers[2].ID})
+
+	for userID, balance := range map[uint]model.Amount{senderID: 6000, recipientID: 4000} {
+		user, err := s.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, balance, user.Balance)
+		ledgerBalance, err := s.GetBalanceAt(ctx, userID, time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, balance, ledgerBalance)
+		transactions, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID})
+		require.NoError(t, err)
+		var sum model.Amount
+		for _, transaction := range transactions {
+			sum += transaction.Amount
+		}
+		assert.Equal(t, balance, sum)
+	}
+	transactions, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: recipientID})
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	assert.Equal(t, model.LedgerEntryTransfer, transactions[0].Type)
+	assert.Equal(t, model.Amount(1000), transactions[0].Amount)
+	assert.Equal(t, accepted.ID, transactions[0].TransferID)
+	assert.Equal(t, sender.Login, transactions[0].Counterparty)
+	assert.Equal(t, model.Amount(3000), transactions[1].Amount)
+	transactions, err = s.GetTransactions(ctx, model.TransactionFilter{UserID: senderID})
+	require.NoError(t, err)
+	// accrual, direct transfer, hold and return of the declined one, hold of the accepted one
+	require.Len(t, transactions, 5)
+	assert.Equal(t, model.Amount(-1000), transactions[0].Amount)
+	assert.Equal(t, recipient.Login, transactions[0].Counterparty)
+	assert.Equal(t, model.Amount(2000), transactions[1].Amount)
+	assert.Equal(t, declined.ID, transactions[1].TransferID)
+	assert.Equal(t, model.LedgerEntryAccrual, transactions[4].Type)
+	assert.Empty(t, transactions[4].Counterparty)
+}
+
+func testTransactions(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := NewUserWithBalance(t, s, 10000)
+	operatorID := NewUserWithBalance(t, s, 0)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.ProcessWithdrawal(ctx, model.Withdrawal{Amount: 100, OrderNumber: unique(), UserID: userID}))
+		if i > 0 {
+			_, err := s.AdjustBalance(ctx, model.BalanceAdjustment{UserID: userID, OperatorID: operatorID, Amount: 50, Reason: "bonus"})
+			require.NoError(t, err)
+		}
+	}
+
+	all, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID})
+	require.NoError(t, err)
+	require.Len(t, all, 6)
+	for i := 1; i < len(all); i++ {
+		assert.True(t, model.TransactionCursor{CreatedAt: all[i-1].CreatedAt, ID: all[i-1].ID}.Before(all[i]), "transaction %v is out of order", i)
+	}
+	assert.Equal(t, model.LedgerEntryAccrual, all[5].Type)
+
+	// pages follow each other without gaps or repeats
+	var paged []model.Transaction
+	filter := model.TransactionFilter{UserID: userID, Limit: 4}
+	for {
+		page, err := s.GetTransactions(ctx, filter)
+		require.NoError(t, err)
+		paged = append(paged, page...)
+		if len(page) < filter.Limit {
+			break
+		}
+		cursor, err := model.ParseTransactionCursor(page[len(page)-1].Cursor().String())
+		require.NoError(t, err)
+		filter.After = &cursor
+	}
+	assert.Equal(t, all, paged)
+
+	withdrawals, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID, Types: []model.LedgerEntryType{model.LedgerEntryWithdrawal}})
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 3)
+	assert.Equal(t, model.Amount(-100), withdrawals[0].Amount)
+	movements, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID,
+		Types: []model.LedgerEntryType{model.LedgerEntryWithdrawal, model.LedgerEntryAdjustment}})
+	require.NoError(t, err)
+	assert.Len(t, movements, 5)
+
+	// From is inclusive and To is exclusive
+	earlier := 0
+	for _, transaction := range all {
+		if transaction.CreatedAt.Before(all[0].CreatedAt) {
+			earlier++
+		}
+	}
+	ranged, err := s.GetTransactions(ctx, model.TransactionFilter{UserID: userID, From: all[5].CreatedAt, To: all[0].CreatedAt})
+	require.NoError(t, err)
+	assert.Len(t, ranged, earlier)
+	ranged, err = s.GetTransactions(ctx, model.TransactionFilter{UserID: userID, From: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, ranged)
+	ranged, err = s.GetTransactions(ctx, model.TransactionFilter{UserID: userID, To: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, ranged)
+}
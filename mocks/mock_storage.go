@@ -7,6 +7,7 @@ package mock_service
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/mrkovshik/yandex_diploma/internal/model"
@@ -35,6 +36,50 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// AddCampaign mocks base method.
+func (m *MockStorage) AddCampaign(arg0 context.Context, arg1 model.Campaign) (model.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCampaign", arg0, arg1)
+	ret0, _ := ret[0].(model.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddCampaign indicates an expected call of AddCampaign.
+func (mr *MockStorageMockRecorder) AddCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCampaign", reflect.TypeOf((*MockStorage)(nil).AddCampaign), arg0, arg1)
+}
+
+// AddCampaignBonus mocks base method.
+func (m *MockStorage) AddCampaignBonus(arg0 context.Context, arg1 model.CampaignBonus, arg2 model.Amount) (model.Amount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCampaignBonus", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Amount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddCampaignBonus indicates an expected call of AddCampaignBonus.
+func (mr *MockStorageMockRecorder) AddCampaignBonus(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCampaignBonus", reflect.TypeOf((*MockStorage)(nil).AddCampaignBonus), arg0, arg1, arg2)
+}
+
+// AddReferral mocks base method.
+func (m *MockStorage) AddReferral(arg0 context.Context, arg1 model.Referral) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReferral", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddReferral indicates an expected call of AddReferral.
+func (mr *MockStorageMockRecorder) AddReferral(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReferral", reflect.TypeOf((*MockStorage)(nil).AddReferral), arg0, arg1)
+}
+
 // AddUser mocks base method.
 func (m *MockStorage) AddUser(arg0 context.Context, arg1, arg2 string) (uint, error) {
 	m.ctrl.T.Helper()
@@ -50,18 +95,354 @@ func (mr *MockStorageMockRecorder) AddUser(arg0, arg1, arg2 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockStorage)(nil).AddUser), arg0, arg1, arg2)
 }
 
+// AdjustBalance mocks base method.
+func (m *MockStorage) AdjustBalance(arg0 context.Context, arg1 model.BalanceAdjustment) (model.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", arg0, arg1)
+	ret0, _ := ret[0].(model.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockStorageMockRecorder) AdjustBalance(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockStorage)(nil).AdjustBalance), arg0, arg1)
+}
+
+// BlockLogin mocks base method.
+func (m *MockStorage) BlockLogin(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockLogin", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BlockLogin indicates an expected call of BlockLogin.
+func (mr *MockStorageMockRecorder) BlockLogin(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockLogin", reflect.TypeOf((*MockStorage)(nil).BlockLogin), arg0, arg1, arg2)
+}
+
+// ClawbackOrder mocks base method.
+func (m *MockStorage) ClawbackOrder(arg0 context.Context, arg1 string, arg2 bool) (model.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClawbackOrder", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClawbackOrder indicates an expected call of ClawbackOrder.
+func (mr *MockStorageMockRecorder) ClawbackOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClawbackOrder", reflect.TypeOf((*MockStorage)(nil).ClawbackOrder), arg0, arg1, arg2)
+}
+
+// ClearOrderBonusesPending mocks base method.
+func (m *MockStorage) ClearOrderBonusesPending(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearOrderBonusesPending", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearOrderBonusesPending indicates an expected call of ClearOrderBonusesPending.
+func (mr *MockStorageMockRecorder) ClearOrderBonusesPending(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearOrderBonusesPending", reflect.TypeOf((*MockStorage)(nil).ClearOrderBonusesPending), arg0, arg1)
+}
+
+// CreatePasswordResetToken mocks base method.
+func (m *MockStorage) CreatePasswordResetToken(arg0 context.Context, arg1 model.PasswordResetToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockStorageMockRecorder) CreatePasswordResetToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockStorage)(nil).CreatePasswordResetToken), arg0, arg1)
+}
+
+// CreateSession mocks base method.
+func (m *MockStorage) CreateSession(arg0 context.Context, arg1 model.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockStorageMockRecorder) CreateSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockStorage)(nil).CreateSession), arg0, arg1)
+}
+
+// CreateTransfer mocks base method.
+func (m *MockStorage) CreateTransfer(arg0 context.Context, arg1 model.Transfer, arg2 model.TransferLimits) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTransfer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTransfer indicates an expected call of CreateTransfer.
+func (mr *MockStorageMockRecorder) CreateTransfer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTransfer", reflect.TypeOf((*MockStorage)(nil).CreateTransfer), arg0, arg1, arg2)
+}
+
+// CreditReferral mocks base method.
+func (m *MockStorage) CreditReferral(arg0 context.Context, arg1 model.Referral, arg2 int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreditReferral", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreditReferral indicates an expected call of CreditReferral.
+func (mr *MockStorageMockRecorder) CreditReferral(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreditReferral", reflect.TypeOf((*MockStorage)(nil).CreditReferral), arg0, arg1, arg2)
+}
+
+// DeleteExpiredIdempotencyKeys mocks base method.
+func (m *MockStorage) DeleteExpiredIdempotencyKeys(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredIdempotencyKeys", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExpiredIdempotencyKeys indicates an expected call of DeleteExpiredIdempotencyKeys.
+func (mr *MockStorageMockRecorder) DeleteExpiredIdempotencyKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredIdempotencyKeys", reflect.TypeOf((*MockStorage)(nil).DeleteExpiredIdempotencyKeys), arg0)
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *MockStorage) DeleteIdempotencyKey(arg0 context.Context, arg1 uint, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockStorageMockRecorder) DeleteIdempotencyKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*MockStorage)(nil).DeleteIdempotencyKey), arg0, arg1, arg2)
+}
+
+// DeleteTOTP mocks base method.
+func (m *MockStorage) DeleteTOTP(arg0 context.Context, arg1 uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTOTP", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTOTP indicates an expected call of DeleteTOTP.
+func (mr *MockStorageMockRecorder) DeleteTOTP(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTOTP", reflect.TypeOf((*MockStorage)(nil).DeleteTOTP), arg0, arg1)
+}
+
+// EnableTOTP mocks base method.
+func (m *MockStorage) EnableTOTP(arg0 context.Context, arg1 uint, arg2 int64, arg3 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP.
+func (mr *MockStorageMockRecorder) EnableTOTP(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockStorage)(nil).EnableTOTP), arg0, arg1, arg2, arg3)
+}
+
+// EndCampaign mocks base method.
+func (m *MockStorage) EndCampaign(arg0 context.Context, arg1 uint, arg2 time.Time) (model.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EndCampaign", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EndCampaign indicates an expected call of EndCampaign.
+func (mr *MockStorageMockRecorder) EndCampaign(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndCampaign", reflect.TypeOf((*MockStorage)(nil).EndCampaign), arg0, arg1, arg2)
+}
+
+// EnsureReferralCode mocks base method.
+func (m *MockStorage) EnsureReferralCode(arg0 context.Context, arg1 uint, arg2 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureReferralCode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnsureReferralCode indicates an expected call of EnsureReferralCode.
+func (mr *MockStorageMockRecorder) EnsureReferralCode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureReferralCode", reflect.TypeOf((*MockStorage)(nil).EnsureReferralCode), arg0, arg1, arg2)
+}
+
+// ExpirePoints mocks base method.
+func (m *MockStorage) ExpirePoints(arg0 context.Context, arg1 uint, arg2 time.Time) (model.Amount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpirePoints", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Amount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpirePoints indicates an expected call of ExpirePoints.
+func (mr *MockStorageMockRecorder) ExpirePoints(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpirePoints", reflect.TypeOf((*MockStorage)(nil).ExpirePoints), arg0, arg1, arg2)
+}
+
 // FinalizeOrderAndUpdateBalance mocks base method.
-func (m *MockStorage) FinalizeOrderAndUpdateBalance(arg0 context.Context, arg1 string, arg2 float64) error {
+func (m *MockStorage) FinalizeOrderAndUpdateBalance(arg0 context.Context, arg1 string, arg2, arg3 model.Amount) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FinalizeOrderAndUpdateBalance", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "FinalizeOrderAndUpdateBalance", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // FinalizeOrderAndUpdateBalance indicates an expected call of FinalizeOrderAndUpdateBalance.
-func (mr *MockStorageMockRecorder) FinalizeOrderAndUpdateBalance(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) FinalizeOrderAndUpdateBalance(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinalizeOrderAndUpdateBalance", reflect.TypeOf((*MockStorage)(nil).FinalizeOrderAndUpdateBalance), arg0, arg1, arg2, arg3)
+}
+
+// ForgetLoginFailure mocks base method.
+func (m *MockStorage) ForgetLoginFailure(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgetLoginFailure", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForgetLoginFailure indicates an expected call of ForgetLoginFailure.
+func (mr *MockStorageMockRecorder) ForgetLoginFailure(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgetLoginFailure", reflect.TypeOf((*MockStorage)(nil).ForgetLoginFailure), arg0, arg1)
+}
+
+// GetActiveCampaigns mocks base method.
+func (m *MockStorage) GetActiveCampaigns(arg0 context.Context, arg1 time.Time) ([]model.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveCampaigns", arg0, arg1)
+	ret0, _ := ret[0].([]model.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveCampaigns indicates an expected call of GetActiveCampaigns.
+func (mr *MockStorageMockRecorder) GetActiveCampaigns(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveCampaigns", reflect.TypeOf((*MockStorage)(nil).GetActiveCampaigns), arg0, arg1)
+}
+
+// GetBalanceAdjustments mocks base method.
+func (m *MockStorage) GetBalanceAdjustments(arg0 context.Context, arg1 uint) ([]model.BalanceAdjustment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceAdjustments", arg0, arg1)
+	ret0, _ := ret[0].([]model.BalanceAdjustment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceAdjustments indicates an expected call of GetBalanceAdjustments.
+func (mr *MockStorageMockRecorder) GetBalanceAdjustments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceAdjustments", reflect.TypeOf((*MockStorage)(nil).GetBalanceAdjustments), arg0, arg1)
+}
+
+// GetBalanceAt mocks base method.
+func (m *MockStorage) GetBalanceAt(arg0 context.Context, arg1 uint, arg2 time.Time) (model.Amount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Amount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceAt indicates an expected call of GetBalanceAt.
+func (mr *MockStorageMockRecorder) GetBalanceAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceAt", reflect.TypeOf((*MockStorage)(nil).GetBalanceAt), arg0, arg1, arg2)
+}
+
+// GetBalanceDiscrepancies mocks base method.
+func (m *MockStorage) GetBalanceDiscrepancies(arg0 context.Context) ([]model.BalanceDiscrepancy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceDiscrepancies", arg0)
+	ret0, _ := ret[0].([]model.BalanceDiscrepancy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceDiscrepancies indicates an expected call of GetBalanceDiscrepancies.
+func (mr *MockStorageMockRecorder) GetBalanceDiscrepancies(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceDiscrepancies", reflect.TypeOf((*MockStorage)(nil).GetBalanceDiscrepancies), arg0)
+}
+
+// GetCampaign mocks base method.
+func (m *MockStorage) GetCampaign(arg0 context.Context, arg1 uint) (model.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaign", arg0, arg1)
+	ret0, _ := ret[0].(model.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaign indicates an expected call of GetCampaign.
+func (mr *MockStorageMockRecorder) GetCampaign(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaign", reflect.TypeOf((*MockStorage)(nil).GetCampaign), arg0, arg1)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockStorage) GetCampaigns(arg0 context.Context) ([]model.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", arg0)
+	ret0, _ := ret[0].([]model.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockStorageMockRecorder) GetCampaigns(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockStorage)(nil).GetCampaigns), arg0)
+}
+
+// GetLoginBlockedUntil mocks base method.
+func (m *MockStorage) GetLoginBlockedUntil(arg0 context.Context, arg1 string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginBlockedUntil", arg0, arg1)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginBlockedUntil indicates an expected call of GetLoginBlockedUntil.
+func (mr *MockStorageMockRecorder) GetLoginBlockedUntil(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinalizeOrderAndUpdateBalance", reflect.TypeOf((*MockStorage)(nil).FinalizeOrderAndUpdateBalance), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginBlockedUntil", reflect.TypeOf((*MockStorage)(nil).GetLoginBlockedUntil), arg0, arg1)
 }
 
 // GetOrderByNumber mocks base method.
@@ -94,19 +475,139 @@ func (mr *MockStorageMockRecorder) GetOrdersByUserID(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersByUserID", reflect.TypeOf((*MockStorage)(nil).GetOrdersByUserID), arg0, arg1)
 }
 
-// GetPendingOrders mocks base method.
-func (m *MockStorage) GetPendingOrders(arg0 context.Context) ([]string, error) {
+// GetOrdersWithPendingBonuses mocks base method.
+func (m *MockStorage) GetOrdersWithPendingBonuses(arg0 context.Context, arg1 int) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPendingOrders", arg0)
+	ret := m.ctrl.Call(m, "GetOrdersWithPendingBonuses", arg0, arg1)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetPendingOrders indicates an expected call of GetPendingOrders.
-func (mr *MockStorageMockRecorder) GetPendingOrders(arg0 interface{}) *gomock.Call {
+// GetOrdersWithPendingBonuses indicates an expected call of GetOrdersWithPendingBonuses.
+func (mr *MockStorageMockRecorder) GetOrdersWithPendingBonuses(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersWithPendingBonuses", reflect.TypeOf((*MockStorage)(nil).GetOrdersWithPendingBonuses), arg0, arg1)
+}
+
+// GetPointLots mocks base method.
+func (m *MockStorage) GetPointLots(arg0 context.Context, arg1 uint, arg2 time.Time) ([]model.PointLot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPointLots", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.PointLot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPointLots indicates an expected call of GetPointLots.
+func (mr *MockStorageMockRecorder) GetPointLots(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPointLots", reflect.TypeOf((*MockStorage)(nil).GetPointLots), arg0, arg1, arg2)
+}
+
+// GetReferral mocks base method.
+func (m *MockStorage) GetReferral(arg0 context.Context, arg1 uint) (model.Referral, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReferral", arg0, arg1)
+	ret0, _ := ret[0].(model.Referral)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReferral indicates an expected call of GetReferral.
+func (mr *MockStorageMockRecorder) GetReferral(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReferral", reflect.TypeOf((*MockStorage)(nil).GetReferral), arg0, arg1)
+}
+
+// GetReferralsByReferrer mocks base method.
+func (m *MockStorage) GetReferralsByReferrer(arg0 context.Context, arg1 uint) ([]model.Referral, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReferralsByReferrer", arg0, arg1)
+	ret0, _ := ret[0].([]model.Referral)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReferralsByReferrer indicates an expected call of GetReferralsByReferrer.
+func (mr *MockStorageMockRecorder) GetReferralsByReferrer(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingOrders", reflect.TypeOf((*MockStorage)(nil).GetPendingOrders), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReferralsByReferrer", reflect.TypeOf((*MockStorage)(nil).GetReferralsByReferrer), arg0, arg1)
+}
+
+// GetSession mocks base method.
+func (m *MockStorage) GetSession(arg0 context.Context, arg1 string) (model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSession", arg0, arg1)
+	ret0, _ := ret[0].(model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSession indicates an expected call of GetSession.
+func (mr *MockStorageMockRecorder) GetSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSession", reflect.TypeOf((*MockStorage)(nil).GetSession), arg0, arg1)
+}
+
+// GetTOTP mocks base method.
+func (m *MockStorage) GetTOTP(arg0 context.Context, arg1 uint) (model.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", arg0, arg1)
+	ret0, _ := ret[0].(model.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTP indicates an expected call of GetTOTP.
+func (mr *MockStorageMockRecorder) GetTOTP(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockStorage)(nil).GetTOTP), arg0, arg1)
+}
+
+// GetTransactions mocks base method.
+func (m *MockStorage) GetTransactions(arg0 context.Context, arg1 model.TransactionFilter) ([]model.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransactions", arg0, arg1)
+	ret0, _ := ret[0].([]model.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransactions indicates an expected call of GetTransactions.
+func (mr *MockStorageMockRecorder) GetTransactions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockStorage)(nil).GetTransactions), arg0, arg1)
+}
+
+// GetTransfer mocks base method.
+func (m *MockStorage) GetTransfer(arg0 context.Context, arg1 uint) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfer", arg0, arg1)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfer indicates an expected call of GetTransfer.
+func (mr *MockStorageMockRecorder) GetTransfer(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfer", reflect.TypeOf((*MockStorage)(nil).GetTransfer), arg0, arg1)
+}
+
+// GetTransfersByUserID mocks base method.
+func (m *MockStorage) GetTransfersByUserID(arg0 context.Context, arg1 uint) ([]model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTransfersByUserID", arg0, arg1)
+	ret0, _ := ret[0].([]model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTransfersByUserID indicates an expected call of GetTransfersByUserID.
+func (mr *MockStorageMockRecorder) GetTransfersByUserID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransfersByUserID", reflect.TypeOf((*MockStorage)(nil).GetTransfersByUserID), arg0, arg1)
 }
 
 // GetUserByID mocks base method.
@@ -139,6 +640,66 @@ func (mr *MockStorageMockRecorder) GetUserByLogin(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockStorage)(nil).GetUserByLogin), arg0, arg1)
 }
 
+// GetUserIDByReferralCode mocks base method.
+func (m *MockStorage) GetUserIDByReferralCode(arg0 context.Context, arg1 string) (uint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIDByReferralCode", arg0, arg1)
+	ret0, _ := ret[0].(uint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIDByReferralCode indicates an expected call of GetUserIDByReferralCode.
+func (mr *MockStorageMockRecorder) GetUserIDByReferralCode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIDByReferralCode", reflect.TypeOf((*MockStorage)(nil).GetUserIDByReferralCode), arg0, arg1)
+}
+
+// GetUserTier mocks base method.
+func (m *MockStorage) GetUserTier(arg0 context.Context, arg1 uint) (model.UserTier, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserTier", arg0, arg1)
+	ret0, _ := ret[0].(model.UserTier)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserTier indicates an expected call of GetUserTier.
+func (mr *MockStorageMockRecorder) GetUserTier(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserTier", reflect.TypeOf((*MockStorage)(nil).GetUserTier), arg0, arg1)
+}
+
+// GetUserTurnover mocks base method.
+func (m *MockStorage) GetUserTurnover(arg0 context.Context, arg1 string, arg2 time.Time) ([]model.Turnover, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserTurnover", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]model.Turnover)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserTurnover indicates an expected call of GetUserTurnover.
+func (mr *MockStorageMockRecorder) GetUserTurnover(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserTurnover", reflect.TypeOf((*MockStorage)(nil).GetUserTurnover), arg0, arg1, arg2)
+}
+
+// GetUsersWithExpiredPoints mocks base method.
+func (m *MockStorage) GetUsersWithExpiredPoints(arg0 context.Context, arg1 time.Time, arg2 uint, arg3 int) ([]uint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsersWithExpiredPoints", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]uint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsersWithExpiredPoints indicates an expected call of GetUsersWithExpiredPoints.
+func (mr *MockStorageMockRecorder) GetUsersWithExpiredPoints(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersWithExpiredPoints", reflect.TypeOf((*MockStorage)(nil).GetUsersWithExpiredPoints), arg0, arg1, arg2, arg3)
+}
+
 // GetWithdrawalsByUserID mocks base method.
 func (m *MockStorage) GetWithdrawalsByUserID(arg0 context.Context, arg1 uint) ([]model.Withdrawal, error) {
 	m.ctrl.T.Helper()
@@ -155,10 +716,10 @@ func (mr *MockStorageMockRecorder) GetWithdrawalsByUserID(arg0, arg1 interface{}
 }
 
 // GetWithdrawalsSumByUserID mocks base method.
-func (m *MockStorage) GetWithdrawalsSumByUserID(arg0 context.Context, arg1 uint) (float64, error) {
+func (m *MockStorage) GetWithdrawalsSumByUserID(arg0 context.Context, arg1 uint) (model.Amount, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetWithdrawalsSumByUserID", arg0, arg1)
-	ret0, _ := ret[0].(float64)
+	ret0, _ := ret[0].(model.Amount)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -169,6 +730,21 @@ func (mr *MockStorageMockRecorder) GetWithdrawalsSumByUserID(arg0, arg1 interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawalsSumByUserID", reflect.TypeOf((*MockStorage)(nil).GetWithdrawalsSumByUserID), arg0, arg1)
 }
 
+// LeasePendingOrders mocks base method.
+func (m *MockStorage) LeasePendingOrders(arg0 context.Context, arg1 string, arg2 int, arg3 time.Duration) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeasePendingOrders", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeasePendingOrders indicates an expected call of LeasePendingOrders.
+func (mr *MockStorageMockRecorder) LeasePendingOrders(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeasePendingOrders", reflect.TypeOf((*MockStorage)(nil).LeasePendingOrders), arg0, arg1, arg2, arg3)
+}
+
 // ProcessWithdrawal mocks base method.
 func (m *MockStorage) ProcessWithdrawal(arg0 context.Context, arg1 model.Withdrawal) error {
 	m.ctrl.T.Helper()
@@ -183,6 +759,210 @@ func (mr *MockStorageMockRecorder) ProcessWithdrawal(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessWithdrawal", reflect.TypeOf((*MockStorage)(nil).ProcessWithdrawal), arg0, arg1)
 }
 
+// RecordLoginFailure mocks base method.
+func (m *MockStorage) RecordLoginFailure(arg0 context.Context, arg1 string, arg2 time.Duration) (int, time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginFailure", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RecordLoginFailure indicates an expected call of RecordLoginFailure.
+func (mr *MockStorageMockRecorder) RecordLoginFailure(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginFailure", reflect.TypeOf((*MockStorage)(nil).RecordLoginFailure), arg0, arg1, arg2)
+}
+
+// RejectReferral mocks base method.
+func (m *MockStorage) RejectReferral(arg0 context.Context, arg1 uint, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RejectReferral", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RejectReferral indicates an expected call of RejectReferral.
+func (mr *MockStorageMockRecorder) RejectReferral(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RejectReferral", reflect.TypeOf((*MockStorage)(nil).RejectReferral), arg0, arg1, arg2)
+}
+
+// ReleaseOrder mocks base method.
+func (m *MockStorage) ReleaseOrder(arg0 context.Context, arg1, arg2 string, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseOrder", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseOrder indicates an expected call of ReleaseOrder.
+func (mr *MockStorageMockRecorder) ReleaseOrder(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseOrder", reflect.TypeOf((*MockStorage)(nil).ReleaseOrder), arg0, arg1, arg2, arg3)
+}
+
+// RenewOrderLeases mocks base method.
+func (m *MockStorage) RenewOrderLeases(arg0 context.Context, arg1 string, arg2 time.Duration) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewOrderLeases", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewOrderLeases indicates an expected call of RenewOrderLeases.
+func (mr *MockStorageMockRecorder) RenewOrderLeases(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewOrderLeases", reflect.TypeOf((*MockStorage)(nil).RenewOrderLeases), arg0, arg1, arg2)
+}
+
+// ReplaceUserTiers mocks base method.
+func (m *MockStorage) ReplaceUserTiers(arg0 context.Context, arg1 []model.UserTier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceUserTiers", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceUserTiers indicates an expected call of ReplaceUserTiers.
+func (mr *MockStorageMockRecorder) ReplaceUserTiers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceUserTiers", reflect.TypeOf((*MockStorage)(nil).ReplaceUserTiers), arg0, arg1)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *MockStorage) ReserveIdempotencyKey(arg0 context.Context, arg1 model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(model.IdempotencyRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockStorageMockRecorder) ReserveIdempotencyKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*MockStorage)(nil).ReserveIdempotencyKey), arg0, arg1)
+}
+
+// ResetLoginAttempts mocks base method.
+func (m *MockStorage) ResetLoginAttempts(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginAttempts", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginAttempts indicates an expected call of ResetLoginAttempts.
+func (mr *MockStorageMockRecorder) ResetLoginAttempts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginAttempts", reflect.TypeOf((*MockStorage)(nil).ResetLoginAttempts), arg0, arg1)
+}
+
+// ResetPassword mocks base method.
+func (m *MockStorage) ResetPassword(arg0 context.Context, arg1, arg2 string) (uint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(uint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockStorageMockRecorder) ResetPassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockStorage)(nil).ResetPassword), arg0, arg1, arg2)
+}
+
+// ReverseWithdrawal mocks base method.
+func (m *MockStorage) ReverseWithdrawal(arg0 context.Context, arg1 string) (model.Withdrawal, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReverseWithdrawal", arg0, arg1)
+	ret0, _ := ret[0].(model.Withdrawal)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReverseWithdrawal indicates an expected call of ReverseWithdrawal.
+func (mr *MockStorageMockRecorder) ReverseWithdrawal(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseWithdrawal", reflect.TypeOf((*MockStorage)(nil).ReverseWithdrawal), arg0, arg1)
+}
+
+// RevokeSession mocks base method.
+func (m *MockStorage) RevokeSession(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockStorageMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockStorage)(nil).RevokeSession), arg0, arg1)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockStorage) RevokeUserSessions(arg0 context.Context, arg1 uint, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockStorageMockRecorder) RevokeUserSessions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockStorage)(nil).RevokeUserSessions), arg0, arg1, arg2)
+}
+
+// RotateSession mocks base method.
+func (m *MockStorage) RotateSession(arg0 context.Context, arg1, arg2, arg3 string, arg4 time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockStorageMockRecorder) RotateSession(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockStorage)(nil).RotateSession), arg0, arg1, arg2, arg3, arg4)
+}
+
+// SaveIdempotentResponse mocks base method.
+func (m *MockStorage) SaveIdempotentResponse(arg0 context.Context, arg1 model.IdempotencyRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotentResponse", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotentResponse indicates an expected call of SaveIdempotentResponse.
+func (mr *MockStorageMockRecorder) SaveIdempotentResponse(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotentResponse", reflect.TypeOf((*MockStorage)(nil).SaveIdempotentResponse), arg0, arg1)
+}
+
+// SaveTOTPSecret mocks base method.
+func (m *MockStorage) SaveTOTPSecret(arg0 context.Context, arg1 uint, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTPSecret", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTPSecret indicates an expected call of SaveTOTPSecret.
+func (mr *MockStorageMockRecorder) SaveTOTPSecret(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTPSecret", reflect.TypeOf((*MockStorage)(nil).SaveTOTPSecret), arg0, arg1, arg2)
+}
+
 // SetOrderStatus mocks base method.
 func (m *MockStorage) SetOrderStatus(arg0 context.Context, arg1 string, arg2 model.OrderState) error {
 	m.ctrl.T.Helper()
@@ -197,6 +977,49 @@ func (mr *MockStorageMockRecorder) SetOrderStatus(arg0, arg1, arg2 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrderStatus", reflect.TypeOf((*MockStorage)(nil).SetOrderStatus), arg0, arg1, arg2)
 }
 
+// SetUserRole mocks base method.
+func (m *MockStorage) SetUserRole(arg0 context.Context, arg1 uint, arg2 model.Role) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockStorageMockRecorder) SetUserRole(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockStorage)(nil).SetUserRole), arg0, arg1, arg2)
+}
+
+// SettleTransfer mocks base method.
+func (m *MockStorage) SettleTransfer(arg0 context.Context, arg1 uint, arg2 model.TransferStatus) (model.Transfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SettleTransfer", arg0, arg1, arg2)
+	ret0, _ := ret[0].(model.Transfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SettleTransfer indicates an expected call of SettleTransfer.
+func (mr *MockStorageMockRecorder) SettleTransfer(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SettleTransfer", reflect.TypeOf((*MockStorage)(nil).SettleTransfer), arg0, arg1, arg2)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockStorage) UpdateUserPassword(arg0 context.Context, arg1 uint, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockStorageMockRecorder) UpdateUserPassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockStorage)(nil).UpdateUserPassword), arg0, arg1, arg2)
+}
+
 // UploadOrder mocks base method.
 func (m *MockStorage) UploadOrder(arg0 context.Context, arg1 uint, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -210,3 +1033,33 @@ func (mr *MockStorageMockRecorder) UploadOrder(arg0, arg1, arg2 interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadOrder", reflect.TypeOf((*MockStorage)(nil).UploadOrder), arg0, arg1, arg2)
 }
+
+// UseRecoveryCode mocks base method.
+func (m *MockStorage) UseRecoveryCode(arg0 context.Context, arg1 uint, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStorageMockRecorder) UseRecoveryCode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStorage)(nil).UseRecoveryCode), arg0, arg1, arg2)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStorage) UseTOTPStep(arg0 context.Context, arg1 uint, arg2 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStorageMockRecorder) UseTOTPStep(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStorage)(nil).UseTOTPStep), arg0, arg1, arg2)
+}